@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// apiVersionPattern matches anthropic-version values such as 2023-06-01
+var apiVersionPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// apiVersion returns the anthropic-version to send: the model profile's if it
+// declares one, otherwise the client default
+func (c *AnthropicClient) apiVersion() string {
+	if c.model != nil && c.model.Version != "" {
+		return c.model.Version
+	}
+	return c.version
+}
+
+// activeBetas returns the beta features the model profile enables
+func (c *AnthropicClient) activeBetas() []string {
+	if c.model == nil {
+		return nil
+	}
+	return c.model.Betas
+}
+
+// addVersionHeaders sets anthropic-version and, when betas are enabled,
+// anthropic-beta
+func (c *AnthropicClient) addVersionHeaders(req *http.Request) {
+	req.Header.Set("anthropic-version", c.apiVersion())
+	if betas := c.activeBetas(); len(betas) > 0 {
+		req.Header.Set("anthropic-beta", strings.Join(betas, ","))
+	}
+}
+
+// validateBetas checks the version and beta names declared by a model
+func (m *ModelDefinition) validateBetas() error {
+	if m.Version != "" && !apiVersionPattern.MatchString(m.Version) {
+		return fmt.Errorf("version must be a date such as 2023-06-01, got %q", m.Version)
+	}
+	seen := make(map[string]bool)
+	for _, beta := range m.Betas {
+		if beta == "" || strings.ContainsAny(beta, ", ") {
+			return fmt.Errorf("invalid beta name %q", beta)
+		}
+		if seen[beta] {
+			return fmt.Errorf("beta %q is listed twice", beta)
+		}
+		seen[beta] = true
+	}
+	return nil
+}
+
+// explainAPIError turns a failed API response into an error, pointing at
+// the model profile when the API rejected its betas or version
+func (c *AnthropicClient) explainAPIError(status int, body []byte) error {
+	var apiErr struct {
+		Error AnthropicError `json:"error"`
+	}
+	message := string(body)
+	if err := json.Unmarshal(body, &apiErr); err == nil && apiErr.Error.Message != "" {
+		message = apiErr.Error.Message
+	}
+
+	if status == http.StatusBadRequest {
+		switch {
+		case strings.Contains(message, "anthropic-beta"):
+			return fmt.Errorf("the API rejected the beta features %s: %s\nCheck the \"betas\" list in the model profile", strings.Join(c.activeBetas(), ", "), message)
+		case strings.Contains(message, "anthropic-version"):
+			return fmt.Errorf("the API rejected API version %s: %s\nCheck the \"version\" in the model profile", c.apiVersion(), message)
+		}
+	}
+	return fmt.Errorf("API request failed with status %d: %s", status, string(body))
+}
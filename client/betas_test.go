@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplainAPIError(t *testing.T) {
+	c := &AnthropicClient{version: "2023-06-01", model: &ModelDefinition{Betas: []string{"files-api-2025-04-14", "bogus-beta"}}}
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   []string
+	}{
+		{
+			name:   "rejected beta",
+			status: 400,
+			body:   `{"type": "error", "error": {"type": "invalid_request_error", "message": "Unexpected value(s) ` + "`bogus-beta`" + ` for the ` + "`anthropic-beta`" + ` header."}}`,
+			want:   []string{"the API rejected the beta features files-api-2025-04-14, bogus-beta: Unexpected value(s)", `Check the "betas" list in the model profile`},
+		},
+		{
+			name:   "rejected version",
+			status: 400,
+			body:   `{"error": {"type": "invalid_request_error", "message": "anthropic-version: invalid version"}}`,
+			want:   []string{"the API rejected API version 2023-06-01: anthropic-version: invalid version", `Check the "version" in the model profile`},
+		},
+		{
+			name:   "other bad request",
+			status: 400,
+			body:   `{"error": {"type": "invalid_request_error", "message": "max_tokens: too large"}}`,
+			want:   []string{"API request failed with status 400: {\"error\""},
+		},
+		{
+			name:   "beta named outside a bad request",
+			status: 500,
+			body:   `{"error": {"type": "api_error", "message": "anthropic-beta handling failed"}}`,
+			want:   []string{"API request failed with status 500"},
+		},
+		{
+			name:   "body that isn't JSON",
+			status: 400,
+			body:   "bad anthropic-beta header",
+			want:   []string{"the API rejected the beta features", "bad anthropic-beta header"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.explainAPIError(tt.status, []byte(tt.body))
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("err = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+
+	c.model.Version = "2099-01-01"
+	err := c.explainAPIError(400, []byte(`{"error": {"message": "unknown anthropic-version"}}`))
+	if !strings.Contains(err.Error(), "API version 2099-01-01") {
+		t.Errorf("err = %q, want the model profile's version", err)
+	}
+}
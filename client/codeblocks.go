@@ -0,0 +1,480 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// CodeBlock is a fenced code block extracted from an assistant response
+type CodeBlock struct {
+	Language string // Language name as returned by detectFileLanguage
+	Filename string // File the block appears to belong to, if any
+	Content  string
+}
+
+var (
+	fenceInfoFilePattern = regexp.MustCompile(`(?:title|file|filename)=["']?([^"'\s]+)`)
+	filenamePattern      = regexp.MustCompile(`[\w./-]+\.[A-Za-z0-9]+`)
+)
+
+// extractCodeBlocks returns the fenced code blocks in a markdown document in
+// the order they appear. Unterminated blocks are included up to the end of
+// the text.
+func extractCodeBlocks(text string) []CodeBlock {
+	var blocks []CodeBlock
+	var current *CodeBlock
+	var body strings.Builder
+	var fence, previous string
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if current != nil {
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				current.Content = body.String()
+				blocks = append(blocks, *current)
+				current = nil
+				body.Reset()
+				continue
+			}
+			body.WriteString(line)
+			body.WriteString("\n")
+			continue
+		}
+
+		if m := fenceOpenPattern.FindStringSubmatch(line); m != nil {
+			fence = m[1]
+			info := strings.TrimSpace(strings.TrimLeft(trimmed, fence[:1]))
+			current = &CodeBlock{}
+			current.Language, current.Filename = parseFenceInfo(info)
+			if current.Filename == "" {
+				current.Filename = filenameFromLine(previous)
+			}
+			if current.Language == "plaintext" && current.Filename != "" {
+				current.Language = detectFileLanguage(current.Filename)
+			}
+			previous = ""
+			continue
+		}
+
+		if trimmed != "" {
+			previous = trimmed
+		}
+	}
+
+	if current != nil {
+		current.Content = body.String()
+		blocks = append(blocks, *current)
+	}
+	return blocks
+}
+
+// parseFenceInfo splits a fence info string such as "go", "go main.go",
+// "go:main.go" or "go title=main.go" into a language and optional filename
+func parseFenceInfo(info string) (language, filename string) {
+	if m := fenceInfoFilePattern.FindStringSubmatch(info); m != nil {
+		filename = m[1]
+		info = strings.TrimSpace(strings.Replace(info, m[0], "", 1))
+	}
+
+	fields := strings.Fields(strings.Replace(info, ":", " ", 1))
+	if len(fields) == 0 {
+		return "plaintext", filename
+	}
+	if filename == "" && len(fields) > 1 && filenamePattern.MatchString(fields[1]) {
+		filename = fields[1]
+	}
+	if filename == "" && strings.Contains(fields[0], ".") {
+		// A bare filename used as the info string
+		return detectFileLanguage(fields[0]), fields[0]
+	}
+	return codeBlockLanguage(fields[0]), filename
+}
+
+// filenameFromLine picks the last filename-looking token from the line that
+// introduces a code block, e.g. "File: main.go" or "Update `server/main.go`:"
+func filenameFromLine(line string) string {
+	matches := filenamePattern.FindAllString(line, -1)
+	for i := len(matches) - 1; i >= 0; i-- {
+		name := strings.Trim(matches[i], "./")
+		if name != "" && !strings.HasPrefix(name, "http") && detectFileLanguage(name) != "plaintext" {
+			return matches[i]
+		}
+	}
+	return ""
+}
+
+// lastAssistantBlocks returns the code blocks in the most recent assistant message
+func (c *AnthropicClient) lastAssistantBlocks() ([]CodeBlock, error) {
+	if c.history != nil {
+		for i := len(c.history.Messages) - 1; i >= 0; i-- {
+			if c.history.Messages[i].Role == "assistant" {
+				blocks := extractCodeBlocks(c.history.Messages[i].Content)
+				if len(blocks) == 0 {
+					return nil, fmt.Errorf("the last response contains no code blocks")
+				}
+				return blocks, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no assistant response yet")
+}
+
+// codeBlockAt returns the 1-based block n from the last assistant message
+func (c *AnthropicClient) codeBlockAt(n string) (CodeBlock, error) {
+	blocks, err := c.lastAssistantBlocks()
+	if err != nil {
+		return CodeBlock{}, err
+	}
+	var index int
+	if _, err := fmt.Sscanf(n, "%d", &index); err != nil || index < 1 || index > len(blocks) {
+		return CodeBlock{}, fmt.Errorf("invalid block number %q (last response has %d blocks)", n, len(blocks))
+	}
+	return blocks[index-1], nil
+}
+
+// showCodeBlocks lists the code blocks in the last assistant message
+func (c *AnthropicClient) showCodeBlocks() error {
+	blocks, err := c.lastAssistantBlocks()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("\nCode blocks in last response:")
+	for i, block := range blocks {
+		lines := strings.Count(block.Content, "\n")
+		target := ""
+		if block.Filename != "" {
+			target = " " + block.Filename
+			if file, _ := c.findContextFile(block.Filename); file != nil {
+				target += " (loaded)"
+			}
+		}
+		firstLine := strings.TrimSpace(strings.SplitN(block.Content, "\n", 2)[0])
+		if len(firstLine) > 60 {
+			firstLine = firstLine[:60] + "..."
+		}
+		fmt.Printf("  %d. [%s]%s, %d lines: %s\n", i+1, block.Language, target, lines, firstLine)
+	}
+	fmt.Println()
+	return nil
+}
+
+// saveCodeBlock writes block n of the last assistant message to path
+func (c *AnthropicClient) saveCodeBlock(n, path string) error {
+	block, err := c.codeBlockAt(n)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(block.Content), 0644); err != nil {
+		return fmt.Errorf("failed to write block: %v", err)
+	}
+	return nil
+}
+
+// findContextFile returns the loaded context file at the given path. A
+// bare file name, without a directory, may also name the only loaded file
+// with that base name; a path never matches a file in another directory.
+func (c *AnthropicClient) findContextFile(name string) (*ContextFile, error) {
+	if abs, err := filepath.Abs(name); err == nil {
+		for i := range c.context {
+			if path, err := filepath.Abs(c.context[i].Path); err == nil && path == abs {
+				return &c.context[i], nil
+			}
+		}
+	}
+	var found *ContextFile
+	if filepath.Base(name) == name {
+		for i := range c.context {
+			if c.context[i].Name != name {
+				continue
+			}
+			if found != nil {
+				return nil, fmt.Errorf("more than one loaded file is called %s; give the path of the one you mean", name)
+			}
+			found = &c.context[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%s is not loaded into context (use /load first)", name)
+	}
+	return found, nil
+}
+
+// applyCodeBlock replaces a loaded context file with a code block from the
+// last assistant message after showing a diff and asking for confirmation.
+// args is "[n] [file]": with no block number the first block that names a
+// loaded file is used, and file overrides the block's own filename.
+func (c *AnthropicClient) applyCodeBlock(args []string) error {
+	blocks, err := c.lastAssistantBlocks()
+	if err != nil {
+		return err
+	}
+
+	var block CodeBlock
+	var target *ContextFile
+	switch {
+	case len(args) == 0:
+		for _, b := range blocks {
+			if b.Filename != "" {
+				if target, _ = c.findContextFile(b.Filename); target != nil {
+					block = b
+					break
+				}
+			}
+		}
+		if target == nil {
+			return fmt.Errorf("no code block in the last response names a loaded file; use /apply <n> <file>")
+		}
+	default:
+		if block, err = c.codeBlockAt(args[0]); err != nil {
+			return err
+		}
+		name := block.Filename
+		if len(args) > 1 {
+			name = args[1]
+		}
+		if name == "" {
+			return fmt.Errorf("block %s does not name a file; use /apply %s <file>", args[0], args[0])
+		}
+		if target, err = c.findContextFile(name); err != nil {
+			return err
+		}
+	}
+
+	current, err := os.ReadFile(target.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", target.Path, err)
+	}
+
+	diff := unifiedDiff(target.Path, string(current), block.Content)
+	if diff == "" {
+		fmt.Printf("%s is already up to date\n", target.Path)
+		return nil
+	}
+	printDiff(diff)
+
+	ok, err := c.confirm(fmt.Sprintf("Write changes to %s?", target.Path), false)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Println("Apply cancelled.")
+		return nil
+	}
+
+	if err := os.WriteFile(target.Path, []byte(block.Content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", target.Path, err)
+	}
+	target.Content = block.Content
+	fmt.Printf("Updated %s (context refreshed)\n", target.Path)
+	return nil
+}
+
+// printDiff prints a unified diff, coloured when the terminal supports it
+func printDiff(diff string) {
+	styled := terminalSupportsMarkdown()
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		if styled {
+			switch {
+			case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+				line = ansiBold + line + ansiReset
+			case strings.HasPrefix(line, "@@"):
+				line = ansiCyan + line + ansiReset
+			case strings.HasPrefix(line, "+"):
+				line = ansiGreen + line + ansiReset
+			case strings.HasPrefix(line, "-"):
+				line = ansiRed + line + ansiReset
+			}
+		}
+		fmt.Println(line)
+	}
+}
+
+// diffOp is a single line-level edit in a diff
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// maxDiffCells bounds the size of the LCS table; larger inputs are shown as
+// a whole-file replacement
+const maxDiffCells = 16 << 20
+
+// unifiedDiff returns a unified diff between two versions of a file with
+// three lines of context, or "" when they are identical
+func unifiedDiff(name, before, after string) string {
+	if before == after {
+		return ""
+	}
+	a := diffLines(before)
+	b := diffLines(after)
+
+	ops := lineDiff(a, b)
+
+	const contextLines = 3
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("--- a/%s\n+++ b/%s\n", name, name))
+
+	// Walk the edit script emitting hunks around each run of changes
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			// Merge changes separated by less than two context windows
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*contextLines {
+				break
+			}
+			end = run
+		}
+		stop := end + contextLines
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		aStart, bStart := 1, 1
+		for _, op := range ops[:start] {
+			if op.kind != '+' {
+				aStart++
+			}
+			if op.kind != '-' {
+				bStart++
+			}
+		}
+		var aCount, bCount int
+		for _, op := range ops[start:stop] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		out.WriteString(fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount)))
+		for _, op := range ops[start:stop] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.text)
+			if strings.HasSuffix(op.text, "\n") {
+				out.WriteString(noNewlineMarker)
+			}
+			out.WriteString("\n")
+		}
+		i = stop
+	}
+	return out.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// noNewlineMarker follows the last line of a file that doesn't end in a
+// newline, as in diff(1)
+const noNewlineMarker = "\\ No newline at end of file"
+
+// diffLines splits text into lines for diffing. A last line without a
+// newline keeps a "\n" of its own, so that it differs from the same line
+// with one and unifiedDiff can mark it.
+func diffLines(s string) []string {
+	lines := splitLines(s)
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		lines[len(lines)-1] += "\n"
+	}
+	return lines
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// lineDiff computes a line edit script using a longest common subsequence
+func lineDiff(a, b []string) []diffOp {
+	// Trim the common prefix and suffix to keep the table small
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+	if (len(midA)+1)*(len(midB)+1) > maxDiffCells {
+		for _, line := range midA {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range midB {
+			ops = append(ops, diffOp{'+', line})
+		}
+	} else {
+		n, m := len(midA), len(midB)
+		lcs := make([][]int32, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < n || j < m {
+			switch {
+			case i < n && j < m && midA[i] == midB[j]:
+				ops = append(ops, diffOp{' ', midA[i]})
+				i++
+				j++
+			case j < m && (i == n || lcs[i][j+1] > lcs[i+1][j]):
+				ops = append(ops, diffOp{'+', midB[j]})
+				j++
+			default:
+				ops = append(ops, diffOp{'-', midA[i]})
+				i++
+			}
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		want          string
+	}{
+		{name: "same", before: "a\nb\n", after: "a\nb\n", want: ""},
+		{
+			name:   "changed line",
+			before: "a\nb\nc\n",
+			after:  "a\nB\nc\n",
+			want:   "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name:   "newline removed",
+			before: "a\nb\n",
+			after:  "a\nb",
+			want:   "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-b\n+b\n\\ No newline at end of file\n",
+		},
+		{
+			name:   "newline added",
+			before: "a\nb",
+			after:  "a\nb\n",
+			want:   "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			name:   "neither ends in a newline",
+			before: "a\nb",
+			after:  "A\nb",
+			want:   "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n-a\n+A\n b\n\\ No newline at end of file\n",
+		},
+		{
+			name:   "new file",
+			before: "",
+			after:  "a\n",
+			want:   "--- a/f\n+++ b/f\n@@ -0,0 +1 @@\n+a\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff("f", tt.before, tt.after); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindContextFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	for _, path := range []string{"a/main.go", "b/main.go", "c/util.go"} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("package x\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := &AnthropicClient{}
+	c.context = []ContextFile{
+		{Name: "main.go", Path: "a/main.go"},
+		{Name: "main.go", Path: filepath.Join(dir, "b/main.go")},
+		{Name: "util.go", Path: "c/util.go"},
+	}
+
+	tests := []struct {
+		name     string
+		wantPath string
+		wantErr  string
+	}{
+		{name: "a/main.go", wantPath: "a/main.go"},
+		{name: "./b/main.go", wantPath: filepath.Join(dir, "b/main.go")},
+		{name: filepath.Join(dir, "a/main.go"), wantPath: "a/main.go"},
+		{name: "util.go", wantPath: "c/util.go"},
+		{name: "pkg/util.go", wantErr: "not loaded"},
+		{name: "c/../c/util.go", wantPath: "c/util.go"},
+		{name: "main.go", wantErr: "more than one loaded file is called main.go"},
+		{name: "other.go", wantErr: "not loaded"},
+	}
+	for _, tt := range tests {
+		file, err := c.findContextFile(tt.name)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("findContextFile(%s) error = %v, want one containing %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("findContextFile(%s): %v", tt.name, err)
+			continue
+		}
+		if file.Path != tt.wantPath {
+			t.Errorf("findContextFile(%s) = %s, want %s", tt.name, file.Path, tt.wantPath)
+		}
+	}
+}
@@ -0,0 +1,511 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// errExit is returned by the exit command to end the REPL
+var errExit = errors.New("exit")
+
+// argCompletion is what Tab completes for a command argument
+type argCompletion int
+
+const (
+	completeNothing argCompletion = iota
+	completeFiles
+	completeTools
+	completeProfiles
+	completeResources
+	completeCommands
+)
+
+// commandArg describes one argument of a command
+type commandArg struct {
+	name     string
+	optional bool
+	rest     bool // Takes the rest of the line, spaces included
+	words    bool // Takes the rest of the line as words; quotes keep spaces in a word
+	complete argCompletion
+}
+
+// replCommand is a command typed at the REPL prompt, built in or loaded
+// from a plugin or prompt macro
+type replCommand struct {
+	name    string // As typed, e.g. "/load"
+	aliases []string
+	args    []commandArg
+	help    string
+	group   string // Heading /help lists the command under; "" for built-in commands
+	source  string // File a plugin or macro command was loaded from
+
+	// run carries out the command with its parsed arguments. Text it
+	// returns is sent to the model as the prompt.
+	run func(c *AnthropicClient, args []string) (string, error)
+}
+
+// usage returns the command's syntax, e.g. "/save-block <n> <path>"
+func (cmd *replCommand) usage() string {
+	parts := []string{cmd.name}
+	for _, arg := range cmd.args {
+		name := arg.name
+		if arg.rest || arg.words {
+			name += "..."
+		}
+		if arg.optional {
+			parts = append(parts, "["+name+"]")
+		} else {
+			parts = append(parts, "<"+name+">")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseArgs splits the text after the command's name into its arguments.
+// Missing optional arguments are left out of the result.
+func (cmd *replCommand) parseArgs(text string) ([]string, error) {
+	var args []string
+	text = strings.TrimSpace(text)
+	for _, arg := range cmd.args {
+		if text == "" {
+			if !arg.optional {
+				return nil, fmt.Errorf("usage: %s", cmd.usage())
+			}
+			break
+		}
+		if arg.rest {
+			args = append(args, text)
+			text = ""
+			break
+		}
+		if arg.words {
+			words, err := splitWords(text)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, words...)
+			text = ""
+			break
+		}
+		word, rest, _ := strings.Cut(text, " ")
+		args = append(args, word)
+		text = strings.TrimSpace(rest)
+	}
+	if text != "" {
+		return nil, fmt.Errorf("usage: %s", cmd.usage())
+	}
+	return args, nil
+}
+
+// splitWords splits text into words at spaces, as a shell would: single
+// quotes keep everything up to the next single quote, double quotes keep
+// spaces but let a backslash escape " and \, and outside quotes a
+// backslash escapes the next character
+func splitWords(text string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range text {
+		switch {
+		case escaped:
+			if quote == '"' && r != '"' && r != '\\' {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		word.WriteRune('\\')
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// argAt returns the argument a word at position i of the line fills, or
+// nil if the command takes no more
+func (cmd *replCommand) argAt(i int) *commandArg {
+	for j := range cmd.args {
+		if j == i || (cmd.args[j].rest || cmd.args[j].words) && j < i {
+			return &cmd.args[j]
+		}
+	}
+	return nil
+}
+
+// commandRegistry holds the REPL's commands in the order /help lists them
+type commandRegistry struct {
+	commands []*replCommand
+	byName   map[string]*replCommand // Names and aliases
+}
+
+func newCommandRegistry(commands []*replCommand) *commandRegistry {
+	r := &commandRegistry{byName: make(map[string]*replCommand)}
+	for _, cmd := range commands {
+		if err := r.add(cmd); err != nil {
+			panic(err) // The built-in commands are fixed
+		}
+	}
+	return r
+}
+
+// add registers a command under its name and aliases, which must all be
+// unused
+func (r *commandRegistry) add(cmd *replCommand) error {
+	for _, name := range append([]string{cmd.name}, cmd.aliases...) {
+		if existing, ok := r.byName[name]; ok {
+			return fmt.Errorf("%s is already a command (%s)", name, existing.describeSource())
+		}
+	}
+	r.commands = append(r.commands, cmd)
+	r.byName[cmd.name] = cmd
+	for _, alias := range cmd.aliases {
+		r.byName[alias] = cmd
+	}
+	return nil
+}
+
+// lookup finds a command by name or alias
+func (r *commandRegistry) lookup(name string) *replCommand {
+	return r.byName[name]
+}
+
+// names returns the names of all commands, for completion
+func (r *commandRegistry) names() []string {
+	names := make([]string, 0, len(r.commands))
+	for _, cmd := range r.commands {
+		names = append(names, cmd.name)
+	}
+	return names
+}
+
+// describeSource says where a command comes from
+func (cmd *replCommand) describeSource() string {
+	if cmd.source == "" {
+		return "built in"
+	}
+	return "from " + cmd.source
+}
+
+// runCommand runs the command on a line of input. It reports whether the
+// line was a command and returns any prompt the command produced. Lines
+// that start with an unknown name are prompts, as are lines starting with
+// a command that isn't a slash command, e.g. "exit strategies for...".
+func (c *AnthropicClient) runCommand(line string) (string, bool, error) {
+	name, rest, _ := strings.Cut(line, " ")
+	cmd := c.commands.lookup(name)
+	if cmd == nil || (!strings.HasPrefix(name, "/") && strings.TrimSpace(rest) != "") {
+		return "", false, nil
+	}
+	args, err := cmd.parseArgs(rest)
+	if err != nil {
+		return "", true, err
+	}
+	prompt, err := cmd.run(c, args)
+	return prompt, true, err
+}
+
+// showCommands prints the commands, generated from the registry. Plugins
+// and macros are listed after the built-in commands, under their own
+// headings.
+func (c *AnthropicClient) showCommands() {
+	var groups []string
+	grouped := make(map[string][]*replCommand)
+	width := 0
+	for _, cmd := range c.commands.commands {
+		if _, ok := grouped[cmd.group]; !ok {
+			groups = append(groups, cmd.group)
+		}
+		grouped[cmd.group] = append(grouped[cmd.group], cmd)
+		width = max(width, len(cmd.usage()))
+	}
+
+	for _, group := range groups {
+		if group == "" {
+			fmt.Println("Available commands:")
+		} else {
+			fmt.Printf("\n%s:\n", group)
+		}
+		for _, cmd := range grouped[group] {
+			fmt.Printf("  %-*s - %s", width, cmd.usage(), cmd.help)
+			if len(cmd.aliases) > 0 {
+				fmt.Printf(" (also %s)", strings.Join(cmd.aliases, ", "))
+			}
+			fmt.Println()
+		}
+	}
+	fmt.Println()
+	fmt.Println("End a line with \\ to continue it, or put a block between two \"\"\" lines.")
+	fmt.Println("Press Tab to complete commands, files, profiles, resources and tools.")
+	fmt.Println()
+}
+
+// showCommand prints the details of one command
+func (c *AnthropicClient) showCommand(name string) error {
+	cmd := c.commands.lookup(name)
+	if cmd == nil && !strings.HasPrefix(name, "/") {
+		cmd = c.commands.lookup("/" + name)
+	}
+	if cmd == nil {
+		return fmt.Errorf("unknown command %s", name)
+	}
+	fmt.Printf("Usage: %s\n", cmd.usage())
+	fmt.Println(cmd.help)
+	if len(cmd.aliases) > 0 {
+		fmt.Printf("Aliases: %s\n", strings.Join(cmd.aliases, ", "))
+	}
+	if cmd.source != "" {
+		fmt.Printf("Source: %s\n", cmd.source)
+	}
+	return nil
+}
+
+// useModel loads a model profile for the rest of the session. A profile
+// with a system prompt starts a new conversation.
+func (c *AnthropicClient) useModel(nameOrPath string) error {
+	if err := c.loadModel(nameOrPath); err != nil {
+		return fmt.Errorf("failed to load model: %v", err)
+	}
+	fmt.Printf("Loaded and created model: %s\n", c.model.Name)
+	// Update system prompt in history if present
+	if c.model.System != "" {
+		c.history = NewConversationHistory(c.model.System)
+		fmt.Printf("System prompt: %s\n", c.model.System)
+	}
+	return nil
+}
+
+// builtinCommands returns the commands the client always has
+func builtinCommands() []*replCommand {
+	return []*replCommand{
+		{
+			name:    "/help",
+			aliases: []string{"/?"},
+			args:    []commandArg{{name: "command", optional: true, complete: completeCommands}},
+			help:    "Show this help message, or the details of a command",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				if len(args) == 1 {
+					return "", c.showCommand(args[0])
+				}
+				c.showCommands()
+				return "", nil
+			},
+		},
+		{
+			name: "/load",
+			args: []commandArg{{name: "file", rest: true, complete: completeFiles}},
+			help: "Load a file into context",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				if err := c.loadFile(args[0]); err != nil {
+					return "", fmt.Errorf("failed to load file: %v", err)
+				}
+				fmt.Printf("Loaded file: %s\n", filepath.Base(args[0]))
+				return "", nil
+			},
+		},
+		{
+			name: "/edit-prompt",
+			args: []commandArg{{name: "text", optional: true, rest: true}},
+			help: "Write the prompt in $EDITOR and send it",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				text, err := editPrompt(strings.Join(args, ""))
+				if err == nil && text == "" {
+					fmt.Println("Prompt is empty; nothing sent")
+				}
+				return text, err
+			},
+		},
+		{
+			name: "/model",
+			args: []commandArg{{name: "name|file", complete: completeProfiles}},
+			help: "Load a model profile by name or from a file",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				return "", c.useModel(args[0])
+			},
+		},
+		{
+			name: "/models",
+			help: "List available model profiles",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				c.showProfiles()
+				return "", nil
+			},
+		},
+		{
+			name: "/status",
+			help: "Show current model and context status",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				c.showStatus()
+				return "", nil
+			},
+		},
+		{
+			name: "/tools",
+			args: []commandArg{{name: "tool", optional: true, complete: completeTools}},
+			help: "List tools offered to the model, or show a tool's input schema",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				if len(args) == 1 {
+					return "", c.showTool(args[0])
+				}
+				c.showTools()
+				return "", nil
+			},
+		},
+		{
+			name: "/call",
+			args: []commandArg{{name: "tool", complete: completeTools}, {name: "json", optional: true, rest: true}},
+			help: "Call a tool directly and print its result",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				return "", c.callCommand(strings.Join(args, " "))
+			},
+		},
+		{
+			name: "/resources",
+			help: "List resources offered by MCP servers",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				c.showResources()
+				return "", nil
+			},
+		},
+		{
+			name: "/resource",
+			args: []commandArg{{name: "uri", complete: completeResources}},
+			help: "Load an MCP resource into context",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				name, err := c.loadResource(args[0])
+				if err != nil {
+					return "", fmt.Errorf("failed to load resource: %v", err)
+				}
+				fmt.Printf("Loaded resource: %s\n", name)
+				return "", nil
+			},
+		},
+		{
+			name: "/prompts",
+			help: "List prompts offered by MCP servers",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				c.showPrompts()
+				return "", nil
+			},
+		},
+		{
+			name: "/history",
+			help: "Show conversation history",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				fmt.Println("\nConversation History:")
+				caser := cases.Title(language.English)
+				for _, msg := range c.history.Messages {
+					role := caser.String(msg.Role)
+					fmt.Printf("%s: %s\n", role, msg.Content)
+				}
+				fmt.Printf("\nEstimated tokens: %d\n", c.history.EstimateTokenCount())
+				return "", nil
+			},
+		},
+		{
+			name: "/search-history",
+			args: []commandArg{{name: "query", rest: true}},
+			help: "Fuzzy find typed lines and conversation text",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				return "", c.searchHistoryCommand(args[0])
+			},
+		},
+		{
+			name: "/clear",
+			help: "Clear conversation history",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				systemPrompt := ""
+				if c.model != nil {
+					systemPrompt = c.model.System
+				}
+				c.history = NewConversationHistory(systemPrompt)
+				fmt.Println("Conversation history cleared.")
+				return "", nil
+			},
+		},
+		{
+			name: "/dump",
+			help: "Dump context to file",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				if err := c.dumpContextToFile("context-dump.txt"); err != nil {
+					return "", err
+				}
+				fmt.Println("Context dumped to context-dump.txt")
+				return "", nil
+			},
+		},
+		{
+			name: "/blocks",
+			help: "List code blocks in the last response",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				return "", c.showCodeBlocks()
+			},
+		},
+		{
+			name: "/save-block",
+			args: []commandArg{{name: "n"}, {name: "path", complete: completeFiles}},
+			help: "Write code block n to a file",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				if err := c.saveCodeBlock(args[0], args[1]); err != nil {
+					return "", err
+				}
+				fmt.Printf("Saved block %s to %s\n", args[0], args[1])
+				return "", nil
+			},
+		},
+		{
+			name: "/apply",
+			args: []commandArg{{name: "n", optional: true}, {name: "file", optional: true, complete: completeFiles}},
+			help: "Apply a code block to a loaded file after showing a diff",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				return "", c.applyCodeBlock(args)
+			},
+		},
+		{
+			name:    "exit",
+			aliases: []string{"/exit", "/quit"},
+			help:    "Exit the program",
+			run: func(c *AnthropicClient, args []string) (string, error) {
+				return "", errExit
+			},
+		},
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    []string
+		wantErr string
+	}{
+		{text: "", want: nil},
+		{text: "  a  b\tc ", want: []string{"a", "b", "c"}},
+		{text: `"two words" one`, want: []string{"two words", "one"}},
+		{text: `'single $quoted' x`, want: []string{"single $quoted", "x"}},
+		{text: `a"b c"d`, want: []string{"ab cd"}},
+		{text: `""`, want: []string{""}},
+		{text: `"say \"hi\"" C:\\dir`, want: []string{`say "hi"`, `C:\dir`}},
+		{text: `"keep \n"`, want: []string{`keep \n`}},
+		{text: `it\'s two\ words`, want: []string{"it's", "two words"}},
+		{text: `'back\slash'`, want: []string{`back\slash`}},
+		{text: `don't`, wantErr: "unterminated ' quote"},
+		{text: `"open`, wantErr: `unterminated " quote`},
+	}
+	for _, tt := range tests {
+		got, err := splitWords(tt.text)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("splitWords(%q) error = %v, want %q", tt.text, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("splitWords(%q): %v", tt.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitWords(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []commandArg
+		text    string
+		want    []string
+		wantErr string
+	}{
+		{name: "required word", args: []commandArg{{name: "n"}}, text: " 3 ", want: []string{"3"}},
+		{name: "missing required word", args: []commandArg{{name: "n"}}, text: "", wantErr: "usage: /cmd <n>"},
+		{name: "too many words", args: []commandArg{{name: "n"}}, text: "1 2", wantErr: "usage: /cmd <n>"},
+		{name: "missing optional word", args: []commandArg{{name: "n", optional: true}}, text: "", want: nil},
+		{
+			name: "rest keeps the text as typed",
+			args: []commandArg{{name: "tool"}, {name: "json", optional: true, rest: true}},
+			text: `t {"a":  "b c"}`,
+			want: []string{"t", `{"a":  "b c"}`},
+		},
+		{
+			name: "words are split with quotes",
+			args: []commandArg{{name: "args", optional: true, words: true}},
+			text: `--title "two words" -v`,
+			want: []string{"--title", "two words", "-v"},
+		},
+		{name: "unterminated quote", args: []commandArg{{name: "args", words: true}}, text: `"x`, wantErr: "unterminated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &replCommand{name: "/cmd", args: tt.args}
+			got, err := cmd.parseArgs(tt.text)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("args = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
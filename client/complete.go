@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// replCompleter completes words at the REPL prompt: command names, and
+// the arguments of commands as their specs say
+type replCompleter struct {
+	client *AnthropicClient
+}
+
+// Do returns the completions of the word before the cursor, in the form
+// readline wants: the rest of each candidate and the length of the word
+func (r replCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	text := string(line[:pos])
+	name, rest, hasArgs := strings.Cut(text, " ")
+	if !hasArgs {
+		if strings.HasPrefix(name, "/") || strings.HasPrefix("exit", name) {
+			return completeWord(name, r.client.commands.names())
+		}
+		return nil, 0
+	}
+	cmd := r.client.commands.lookup(name)
+	if cmd == nil {
+		return nil, 0
+	}
+
+	// Only the word being typed is completed
+	word := rest[strings.LastIndexAny(rest, " \t")+1:]
+	arg := cmd.argAt(len(strings.Fields(rest[:len(rest)-len(word)])))
+	if arg == nil {
+		return nil, 0
+	}
+	switch arg.complete {
+	case completeFiles:
+		return completePath(word)
+	case completeTools:
+		return completeWord(word, r.client.toolNames())
+	case completeProfiles:
+		return completeWord(word, r.client.profileNames())
+	case completeResources:
+		return completeWord(word, r.client.resourceURIs())
+	case completeCommands:
+		return completeWord(word, r.client.commands.names())
+	}
+	return nil, 0
+}
+
+// completeWord returns the candidates that start with word
+func completeWord(word string, candidates []string) ([][]rune, int) {
+	var completions [][]rune
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			completions = append(completions, []rune(candidate[len(word):]+" "))
+		}
+	}
+	return completions, len([]rune(word))
+}
+
+// completePath returns the files and directories that start with word.
+// Hidden files are offered only once the word starts with a dot.
+func completePath(word string) ([][]rune, int) {
+	dir, base := filepath.Split(word)
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	} else if strings.HasPrefix(readDir, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			readDir = filepath.Join(home, readDir[2:])
+		}
+	}
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil, 0
+	}
+
+	var completions [][]rune
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		suffix := name[len(base):]
+		if entry.IsDir() {
+			suffix += string(filepath.Separator)
+		} else {
+			suffix += " "
+		}
+		completions = append(completions, []rune(suffix))
+	}
+	return completions, len([]rune(base))
+}
+
+// profileNames returns the names of the model profiles in the profile
+// directories
+func (c *AnthropicClient) profileNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, dir := range c.profileDirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		for _, path := range matches {
+			if name := profileName(path); !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resourceURIs returns the URIs of the resources of all connected servers
+func (c *AnthropicClient) resourceURIs() []string {
+	var uris []string
+	for _, server := range c.mcpServers {
+		for _, resource := range server.resources {
+			uris = append(uris, resource.Uri)
+		}
+	}
+	return uris
+}
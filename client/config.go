@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the client settings that can come from config files,
+// environment variables and flags. Settings are layered with the precedence
+// flags > environment > project config > user config > defaults.
+type Config struct {
+	Provider     string            `json:"provider,omitempty"`      // "direct" or "bedrock"
+	URL          string            `json:"url,omitempty"`           // Anthropic API base URL
+	Region       string            `json:"region,omitempty"`        // AWS region for Bedrock
+	Model        string            `json:"model,omitempty"`         // Model profile name or file to load at startup
+	DefaultModel string            `json:"default_model,omitempty"` // Model used when no profile is loaded
+	MCPServers   []MCPServerConfig `json:"mcp_servers,omitempty"`
+	LocalTools   bool              `json:"local_tools"` // Offer the model the client's own tools, such as load_file
+	History      HistoryConfig     `json:"history"`
+	Retry        RetryConfig       `json:"retry"`
+	UI           UIConfig          `json:"ui"`
+	Credentials  CredentialsConfig `json:"credentials"`
+	HTTP         HTTPConfig        `json:"http"`
+	Telemetry    TelemetryConfig   `json:"telemetry"`
+	ToolPolicy   ToolPolicyConfig  `json:"tool_policy"`
+	ToolCalls    ToolCallsConfig   `json:"tool_calls"`
+
+	// Project directories whose .gchai/config.json may run programs or
+	// change where the API key goes; only read from the user config
+	TrustedProjects []string `json:"trusted_projects,omitempty"`
+
+	sources []string // Config files that were loaded, lowest precedence first
+}
+
+// MCPServerConfig describes an MCP server the client connects to, either
+// over HTTP at URL or by running Command and talking to it over stdio
+type MCPServerConfig struct {
+	Name    string            `json:"name"`
+	URL     string            `json:"url,omitempty"`
+	Command string            `json:"command,omitempty"` // Program to run, e.g. the server with -transport stdio
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"` // Extra environment for Command; values may reference $VARS
+
+	// Which of the server's tools the model sees, and under what names.
+	// Tools are named server__tool unless given an alias.
+	Aliases      map[string]string `json:"aliases,omitempty"`       // Tool name to the name the model sees
+	IncludeTools []string          `json:"include_tools,omitempty"` // Offer only tools matching one of these globs
+	ExcludeTools []string          `json:"exclude_tools,omitempty"` // Don't offer tools matching any of these globs
+
+	// Authentication for servers reached over HTTPS
+	Token      string `json:"token,omitempty"`       // Bearer token; may reference $VARS
+	CABundle   string `json:"ca_bundle,omitempty"`   // PEM file with CAs to trust for the server's certificate
+	ClientCert string `json:"client_cert,omitempty"` // Client certificate for mTLS
+	ClientKey  string `json:"client_key,omitempty"`  // Key for client_cert
+}
+
+// HistoryConfig controls the readline command history
+type HistoryConfig struct {
+	File           string   `json:"file,omitempty"`
+	Limit          int      `json:"limit,omitempty"`
+	PerProject     bool     `json:"per_project"`               // Keep a separate history for each project
+	ExcludeSecrets bool     `json:"exclude_secrets"`           // Don't save lines that look like they hold secrets
+	SecretPatterns []string `json:"secret_patterns,omitempty"` // More regular expressions for secrets
+}
+
+// RetryConfig controls how failed API requests are retried. Requests are
+// retried on connection errors, rate limiting and server errors, before
+// any of the response has been received.
+type RetryConfig struct {
+	MaxAttempts    int      `json:"max_attempts,omitempty"` // Total attempts, including the first
+	InitialBackoff Duration `json:"initial_backoff,omitempty"`
+	MaxBackoff     Duration `json:"max_backoff,omitempty"`
+}
+
+// UIConfig holds interactive display options
+type UIConfig struct {
+	Prompt      string `json:"prompt,omitempty"`       // Input prompt
+	Markdown    *bool  `json:"markdown,omitempty"`     // Force markdown rendering on or off
+	ShowContext *bool  `json:"show_context,omitempty"` // Show prompts and context before sending
+}
+
+// Duration is a time.Duration written as a string such as "500ms" or "2s"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"2s\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// projectConfigDirName is the directory holding project configuration and
+// model profiles
+const projectConfigDirName = ".gchai"
+
+// defaultConfig returns the built-in settings
+func defaultConfig() *Config {
+	showContext := false
+	return &Config{
+		Provider:     "direct",
+		URL:          "https://api.anthropic.com",
+		Region:       "us-east-1",
+		DefaultModel: "claude-3-5-sonnet-20241022",
+		History: HistoryConfig{
+			File:           defaultHistoryFile(),
+			Limit:          1000,
+			ExcludeSecrets: true,
+		},
+		Retry: RetryConfig{
+			MaxAttempts:    3,
+			InitialBackoff: Duration(time.Second),
+			MaxBackoff:     Duration(30 * time.Second),
+		},
+		UI: UIConfig{
+			Prompt:      "> ",
+			ShowContext: &showContext,
+		},
+		Credentials: CredentialsConfig{
+			File: defaultCredentialsFile(),
+		},
+		LocalTools: true,
+		ToolPolicy: defaultToolPolicy(),
+		ToolCalls: ToolCallsConfig{
+			MaxParallel: 4,
+			Timeout:     Duration(mcpRequestLimit),
+		},
+	}
+}
+
+// userConfigPath returns the user-level config file, which GCHAI_CONFIG
+// overrides
+func userConfigPath() string {
+	if path := os.Getenv("GCHAI_CONFIG"); path != "" {
+		return path
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "gchai", "config.json")
+}
+
+// findProjectDir walks up from the working directory looking for a .gchai
+// directory and returns its path, or "" if there is none
+func findProjectDir() string {
+	return findUp(projectConfigDirName)
+}
+
+// findUp walks up from the working directory looking for a directory with
+// the given name and returns its path, or "" if there is none
+func findUp(name string) string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		candidate := filepath.Join(dir, name)
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			return candidate
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// loadConfig builds the configuration from the defaults, the user config
+// file and the project config file, in that order. A project config comes
+// with the repository, so unless the user config trusts the project it
+// can't set what would run a program or send the API key elsewhere.
+func loadConfig() (*Config, error) {
+	cfg := defaultConfig()
+	if path := userConfigPath(); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if dir := findProjectDir(); dir != "" {
+		path := filepath.Join(dir, "config.json")
+		user := *cfg
+		// Decoding adds to maps in place
+		cfg.HTTP.Headers = maps.Clone(cfg.HTTP.Headers)
+		cfg.ToolCalls.Timeouts = maps.Clone(cfg.ToolCalls.Timeouts)
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+		cfg.TrustedProjects = user.TrustedProjects
+		if !cfg.trusts(filepath.Dir(dir)) {
+			if ignored := cfg.restoreTrusted(&user); len(ignored) > 0 {
+				fmt.Fprintf(os.Stderr, "⚠️  Ignoring %s in %s, as the project isn't in trusted_projects in %s\n",
+					strings.Join(ignored, ", "), path, userConfigPath())
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// trusts reports whether a project directory is in trusted_projects
+func (cfg *Config) trusts(projectDir string) bool {
+	resolved, err := filepath.EvalSymlinks(projectDir)
+	if err != nil {
+		return false
+	}
+	for _, dir := range cfg.TrustedProjects {
+		if trusted, err := filepath.EvalSymlinks(dir); err == nil && trusted == resolved {
+			return true
+		}
+	}
+	return false
+}
+
+// loadFile layers a config file over cfg. Only keys present in the file
+// change; a missing file is not an error. Relative paths in the file are
+// resolved against its directory.
+func (cfg *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	// Decoding onto cfg overwrites only the keys the file sets. Lists are
+	// cleared first, as encoding/json decodes into the elements already in
+	// a slice and an entry would keep the keys of the lower layer's entry
+	// at the same index; they are put back if the file doesn't set them.
+	before := *cfg
+	cfg.MCPServers, cfg.ToolPolicy.Rules, cfg.History.SecretPatterns, cfg.TrustedProjects = nil, nil, nil, nil
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		*cfg = before
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	if cfg.MCPServers == nil {
+		cfg.MCPServers = before.MCPServers
+	}
+	if cfg.ToolPolicy.Rules == nil {
+		cfg.ToolPolicy.Rules = before.ToolPolicy.Rules
+	}
+	if cfg.History.SecretPatterns == nil {
+		cfg.History.SecretPatterns = before.History.SecretPatterns
+	}
+	if cfg.TrustedProjects == nil {
+		cfg.TrustedProjects = before.TrustedProjects
+	}
+
+	dir := filepath.Dir(path)
+	if cfg.Model != before.Model && isModelPath(cfg.Model) && !filepath.IsAbs(cfg.Model) {
+		cfg.Model = filepath.Join(dir, cfg.Model)
+	}
+	if cfg.History.File != before.History.File && !filepath.IsAbs(cfg.History.File) {
+		cfg.History.File = filepath.Join(dir, cfg.History.File)
+	}
+	if cfg.Credentials.File != before.Credentials.File && !filepath.IsAbs(cfg.Credentials.File) {
+		cfg.Credentials.File = filepath.Join(dir, cfg.Credentials.File)
+	}
+	for i := range cfg.MCPServers {
+		server := &cfg.MCPServers[i]
+		if strings.ContainsRune(server.Command, os.PathSeparator) && !filepath.IsAbs(server.Command) {
+			server.Command = filepath.Join(dir, server.Command)
+		}
+		for _, p := range []*string{&server.CABundle, &server.ClientCert, &server.ClientKey} {
+			if *p != "" && !filepath.IsAbs(*p) {
+				*p = filepath.Join(dir, *p)
+			}
+		}
+	}
+	if cfg.HTTP.CABundle != before.HTTP.CABundle && !filepath.IsAbs(cfg.HTTP.CABundle) {
+		cfg.HTTP.CABundle = filepath.Join(dir, cfg.HTTP.CABundle)
+	}
+	for i, project := range cfg.TrustedProjects {
+		if !filepath.IsAbs(project) {
+			cfg.TrustedProjects[i] = filepath.Join(dir, project)
+		}
+	}
+
+	cfg.sources = append(cfg.sources, path)
+	return nil
+}
+
+// restoreTrusted puts back the user's settings for what an untrusted
+// project config may not change, and returns what the project tried to set.
+// Besides where requests go, that is which tools exist and which run
+// without asking, so MCP servers the user didn't configure are left out.
+func (cfg *Config) restoreTrusted(user *Config) []string {
+	var ignored []string
+	for _, setting := range []struct {
+		name           string
+		value, trusted *string
+	}{
+		{"url", &cfg.URL, &user.URL},
+		{"credentials.process", &cfg.Credentials.Process, &user.Credentials.Process},
+		{"credentials.file", &cfg.Credentials.File, &user.Credentials.File},
+		{"http.proxy", &cfg.HTTP.Proxy, &user.HTTP.Proxy},
+		{"http.ca_bundle", &cfg.HTTP.CABundle, &user.HTTP.CABundle},
+	} {
+		if *setting.value != *setting.trusted {
+			*setting.value = *setting.trusted
+			ignored = append(ignored, setting.name)
+		}
+	}
+	if !maps.Equal(cfg.HTTP.Headers, user.HTTP.Headers) {
+		cfg.HTTP.Headers = user.HTTP.Headers
+		ignored = append(ignored, "http.headers")
+	}
+	if cfg.LocalTools != user.LocalTools {
+		cfg.LocalTools = user.LocalTools
+		ignored = append(ignored, "local_tools")
+	}
+	if !reflect.DeepEqual(cfg.ToolPolicy, user.ToolPolicy) {
+		cfg.ToolPolicy = user.ToolPolicy
+		ignored = append(ignored, "tool_policy")
+	}
+	if !reflect.DeepEqual(cfg.ToolCalls, user.ToolCalls) {
+		cfg.ToolCalls = user.ToolCalls
+		ignored = append(ignored, "tool_calls")
+	}
+
+	var servers []MCPServerConfig
+	for _, server := range cfg.MCPServers {
+		fromUser := false
+		for _, userServer := range user.MCPServers {
+			fromUser = fromUser || reflect.DeepEqual(server, userServer)
+		}
+		if !fromUser {
+			ignored = append(ignored, fmt.Sprintf("mcp_servers %q", server.Name))
+			continue
+		}
+		servers = append(servers, server)
+	}
+	if len(servers) < len(cfg.MCPServers) {
+		cfg.MCPServers = servers
+	}
+	return ignored
+}
+
+// applyEnv overrides settings from environment variables
+func (cfg *Config) applyEnv() error {
+	if v := os.Getenv("GCHAI_PROVIDER"); v != "" {
+		cfg.Provider = v
+	}
+	if v := os.Getenv("ANTHROPIC_BASE_URL"); v != "" {
+		cfg.URL = v
+	}
+	if v := os.Getenv("AWS_REGION"); v != "" {
+		cfg.Region = v
+	}
+	if v := os.Getenv("GCHAI_MODEL"); v != "" {
+		cfg.Model = v
+	}
+	if v := os.Getenv("GCHAI_DEFAULT_MODEL"); v != "" {
+		cfg.DefaultModel = v
+	}
+	if v := os.Getenv("GCHAI_HISTORY_FILE"); v != "" {
+		cfg.History.File = v
+	}
+	if v := os.Getenv("GCHAI_CREDENTIAL"); v != "" {
+		cfg.Credentials.Name = v
+	}
+	if v := os.Getenv("GCHAI_CREDENTIALS_FILE"); v != "" {
+		cfg.Credentials.File = v
+	}
+	if v := os.Getenv("GCHAI_CA_BUNDLE"); v != "" {
+		cfg.HTTP.CABundle = v
+	}
+	if v := os.Getenv("GCHAI_MARKDOWN"); v != "" {
+		markdown, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid GCHAI_MARKDOWN value %q: %v", v, err)
+		}
+		cfg.UI.Markdown = &markdown
+	}
+	return nil
+}
+
+// validate checks settings that can't be checked while decoding
+func (cfg *Config) validate() error {
+	if cfg.Provider != "direct" && cfg.Provider != "bedrock" {
+		return fmt.Errorf("provider must be 'direct' or 'bedrock'")
+	}
+	if err := cfg.HTTP.validate(); err != nil {
+		return fmt.Errorf("http: %v", err)
+	}
+	if cfg.Retry.MaxAttempts < 1 {
+		return fmt.Errorf("retry.max_attempts must be at least 1")
+	}
+	if cfg.History.Limit < 0 {
+		return fmt.Errorf("history.limit must not be negative")
+	}
+	for i, pattern := range cfg.History.SecretPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("history.secret_patterns[%d]: %v", i, err)
+		}
+	}
+	aliases := make(map[string]bool)
+	names := map[string]bool{localServerName: true}
+	for _, server := range cfg.MCPServers {
+		names[server.Name] = true
+	}
+	seen := make(map[string]bool)
+	for i, server := range cfg.MCPServers {
+		if server.Name == "" || (server.URL == "") == (server.Command == "") {
+			return fmt.Errorf("mcp_servers[%d] needs a name and either a url or a command", i)
+		}
+		if server.Name == localServerName {
+			return fmt.Errorf("mcp_servers[%d]: the name %s is reserved for the client's own tools", i, localServerName)
+		}
+		if !validToolName.MatchString(server.Name) {
+			return fmt.Errorf("mcp_servers[%d]: name may only contain letters, digits, _ and -", i)
+		}
+		if seen[server.Name] {
+			return fmt.Errorf("mcp_servers[%d]: name %s is used by more than one server", i, server.Name)
+		}
+		seen[server.Name] = true
+		for tool, alias := range server.Aliases {
+			if !validToolName.MatchString(alias) {
+				return fmt.Errorf("mcp_servers[%d]: alias %q for %s may only contain letters, digits, _ and - and be up to 64 long", i, alias, tool)
+			}
+			if prefix, _, ok := strings.Cut(alias, toolNameSeparator); ok && names[prefix] {
+				return fmt.Errorf("mcp_servers[%d]: alias %q for %s looks like a tool of server %s", i, alias, tool, prefix)
+			}
+			if aliases[alias] {
+				return fmt.Errorf("mcp_servers[%d]: alias %q is used more than once", i, alias)
+			}
+			aliases[alias] = true
+		}
+		if server.Command != "" && (server.Token != "" || server.CABundle != "" || server.ClientCert != "") {
+			return fmt.Errorf("mcp_servers[%d]: token, ca_bundle and client_cert only apply to servers with a url", i)
+		}
+		if (server.ClientCert == "") != (server.ClientKey == "") {
+			return fmt.Errorf("mcp_servers[%d]: client_cert and client_key must be set together", i)
+		}
+	}
+	if _, err := newToolPolicy(cfg.ToolPolicy); err != nil {
+		return fmt.Errorf("tool_policy: %v", err)
+	}
+	if err := cfg.ToolCalls.validate(); err != nil {
+		return fmt.Errorf("tool_calls: %v", err)
+	}
+	return nil
+}
+
+// isModelPath reports whether a -model value is a file path rather than a
+// profile name
+func isModelPath(name string) bool {
+	return strings.ContainsRune(name, os.PathSeparator) || strings.HasSuffix(name, ".json")
+}
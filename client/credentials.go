@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// credentialProcessTimeout bounds how long a credential_process may run
+const credentialProcessTimeout = 30 * time.Second
+
+// CredentialsConfig controls where the API key for the direct provider comes
+// from and how it is validated
+type CredentialsConfig struct {
+	Name      string  `json:"name,omitempty"`       // Named credential from the credentials file
+	File      string  `json:"file,omitempty"`       // Credentials file
+	Process   string  `json:"process,omitempty"`    // Command that prints an API key
+	KeyPrefix *string `json:"key_prefix,omitempty"` // Required key prefix; "" disables the check
+}
+
+// CredentialEntry is a named credential in the credentials file. It holds
+// either a key or a command that prints one.
+type CredentialEntry struct {
+	APIKey            string  `json:"api_key,omitempty"`
+	CredentialProcess string  `json:"credential_process,omitempty"`
+	KeyPrefix         *string `json:"key_prefix,omitempty"` // Overrides the configured key_prefix
+}
+
+// credential is a resolved API key and where it came from
+type credential struct {
+	name    string    // Requested credential name, "" for the default chain
+	key     string    // Never printed
+	source  string    // Human-readable origin for /status
+	expires time.Time // Zero if the key doesn't expire
+}
+
+// defaultCredentialsFile returns the credentials file in the user config dir
+func defaultCredentialsFile() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "gchai", "credentials.json")
+}
+
+// apiKey returns the API key for the direct provider, resolving it through
+// the credential chain the first time and again when it expires or the
+// model profile asks for a different named credential
+func (c *AnthropicClient) apiKey() (string, error) {
+	name := c.credentials.Name
+	if c.model != nil && c.model.Credential != "" {
+		name = c.model.Credential
+	}
+
+	if cred := c.credential; cred != nil && cred.name == name &&
+		(cred.expires.IsZero() || time.Now().Before(cred.expires)) {
+		return cred.key, nil
+	}
+
+	cred, err := c.resolveCredential(name)
+	if err != nil {
+		return "", err
+	}
+	c.credential = cred
+	return cred.key, nil
+}
+
+// resolveCredential looks up an API key. A named credential must exist in
+// the credentials file. Otherwise the chain is: the ANTHROPIC_API_KEY
+// environment variable, the credentials file entry for the provider (or
+// "default"), then the configured credential process.
+func (c *AnthropicClient) resolveCredential(name string) (*credential, error) {
+	prefix := "sk-ant-"
+	if c.credentials.KeyPrefix != nil {
+		prefix = *c.credentials.KeyPrefix
+	}
+
+	entries, err := loadCredentialsFile(c.credentials.File)
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *credential
+	if name != "" {
+		entry, ok := entries[name]
+		if !ok {
+			return nil, fmt.Errorf("credential %q not found in %s", name, c.credentials.File)
+		}
+		if cred, err = entry.resolve(name, c.credentials.File); err != nil {
+			return nil, err
+		}
+		if entry.KeyPrefix != nil {
+			prefix = *entry.KeyPrefix
+		}
+	} else if key := os.Getenv("ANTHROPIC_API_KEY"); key != "" {
+		cred = &credential{key: key, source: "environment (ANTHROPIC_API_KEY)"}
+	} else if entry, entryName, ok := lookupDefaultEntry(entries, c.provider); ok {
+		if cred, err = entry.resolve(entryName, c.credentials.File); err != nil {
+			return nil, err
+		}
+		if entry.KeyPrefix != nil {
+			prefix = *entry.KeyPrefix
+		}
+	} else if c.credentials.Process != "" {
+		if cred, err = runCredentialProcess(c.credentials.Process); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("no API key found: set ANTHROPIC_API_KEY, add a %q entry to %s or configure credentials.process", c.provider, c.credentials.File)
+	}
+
+	if prefix != "" && !strings.HasPrefix(cred.key, prefix) {
+		return nil, fmt.Errorf("invalid API key from %s (should start with '%s')", cred.source, prefix)
+	}
+	cred.name = name
+	return cred, nil
+}
+
+func lookupDefaultEntry(entries map[string]CredentialEntry, provider string) (CredentialEntry, string, bool) {
+	for _, name := range []string{provider, "default"} {
+		if entry, ok := entries[name]; ok {
+			return entry, name, true
+		}
+	}
+	return CredentialEntry{}, "", false
+}
+
+// resolve returns the key held by or produced by a credentials file entry
+func (e CredentialEntry) resolve(name, path string) (*credential, error) {
+	switch {
+	case e.APIKey != "":
+		return &credential{key: e.APIKey, source: fmt.Sprintf("credentials file %s (%s)", path, name)}, nil
+	case e.CredentialProcess != "":
+		return runCredentialProcess(e.CredentialProcess)
+	default:
+		return nil, fmt.Errorf("credential %q in %s has neither api_key nor credential_process", name, path)
+	}
+}
+
+// loadCredentialsFile reads the named credentials file. The file holds
+// secrets, so it is refused if other users can read it. A missing file is
+// treated as empty.
+func loadCredentialsFile(path string) (map[string]CredentialEntry, error) {
+	if path == "" {
+		return nil, nil
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("credentials file %s is accessible by other users (mode %04o); run: chmod 600 %s", path, info.Mode().Perm(), path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %v", err)
+	}
+	var entries map[string]CredentialEntry
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials file %s: %v", path, err)
+	}
+	return entries, nil
+}
+
+// runCredentialProcess runs a command that prints an API key, either as
+// plain text or as JSON: {"api_key": "...", "expiration": "<RFC 3339>"}.
+// Its stderr is passed through so it can prompt for a passphrase.
+func runCredentialProcess(command string) (*credential, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialProcessTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential process %q failed: %v", command, err)
+	}
+
+	cred := &credential{source: fmt.Sprintf("credential process (%s)", command)}
+	output := strings.TrimSpace(string(out))
+	if strings.HasPrefix(output, "{") {
+		var result struct {
+			APIKey     string `json:"api_key"`
+			Expiration string `json:"expiration"`
+		}
+		if err := json.Unmarshal([]byte(output), &result); err != nil {
+			return nil, fmt.Errorf("credential process %q printed invalid JSON: %v", command, err)
+		}
+		cred.key = result.APIKey
+		if result.Expiration != "" {
+			if cred.expires, err = time.Parse(time.RFC3339, result.Expiration); err != nil {
+				return nil, fmt.Errorf("credential process %q printed an invalid expiration: %v", command, err)
+			}
+		}
+	} else {
+		cred.key = output
+	}
+	if cred.key == "" {
+		return nil, fmt.Errorf("credential process %q printed no API key", command)
+	}
+	return cred, nil
+}
+
+// describeCredential says where the current API key came from without
+// revealing it
+func (c *AnthropicClient) describeCredential() string {
+	if c.credential == nil {
+		return "not resolved"
+	}
+	source := c.credential.source
+	if !c.credential.expires.IsZero() {
+		source += fmt.Sprintf(", expires %s", c.credential.expires.Local().Format(time.RFC3339))
+	}
+	return source
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// defaultEndpoint is the Messages API path appended to the base URL
+const defaultEndpoint = "/v1/messages"
+
+// HTTPConfig holds settings for reaching the API through a gateway or proxy
+type HTTPConfig struct {
+	Headers   map[string]string `json:"headers,omitempty"`    // Extra request headers; values may use ${VAR}
+	AuthStyle string            `json:"auth_style,omitempty"` // "x-api-key" (default) or "bearer"
+	Endpoint  string            `json:"endpoint,omitempty"`   // Path appended to the base URL
+	Proxy     string            `json:"proxy,omitempty"`      // Proxy URL; defaults to HTTPS_PROXY/HTTP_PROXY
+	CABundle  string            `json:"ca_bundle,omitempty"`  // PEM file of extra trusted CAs
+}
+
+// validate checks the auth style and endpoint
+func (h HTTPConfig) validate() error {
+	switch h.AuthStyle {
+	case "", "x-api-key", "bearer":
+	default:
+		return fmt.Errorf("auth_style must be 'x-api-key' or 'bearer'")
+	}
+	if h.Endpoint != "" && !strings.HasPrefix(h.Endpoint, "/") {
+		return fmt.Errorf("endpoint must start with '/'")
+	}
+	return nil
+}
+
+// newHTTPClient builds the client used for API requests, with the
+// configured proxy and CA bundle
+func newHTTPClient(cfg HTTPConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", cfg.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if cfg.CABundle != "" {
+		pem, err := os.ReadFile(cfg.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// httpSettings returns the gateway settings in effect: the config's, with
+// anything the model profile declares taking precedence
+func (c *AnthropicClient) httpSettings() HTTPConfig {
+	settings := c.httpConfig
+	if c.model == nil {
+		return settings
+	}
+	if c.model.AuthStyle != "" {
+		settings.AuthStyle = c.model.AuthStyle
+	}
+	if c.model.Endpoint != "" {
+		settings.Endpoint = c.model.Endpoint
+	}
+	if len(c.model.Headers) > 0 {
+		headers := make(map[string]string, len(settings.Headers)+len(c.model.Headers))
+		for k, v := range settings.Headers {
+			headers[k] = v
+		}
+		for k, v := range c.model.Headers {
+			headers[k] = v
+		}
+		settings.Headers = headers
+	}
+	return settings
+}
+
+// messagesURL returns the URL requests are sent to
+func (c *AnthropicClient) messagesURL() string {
+	endpoint := c.httpSettings().Endpoint
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	return strings.TrimSuffix(c.baseURL, "/") + endpoint
+}
+
+// addCustomHeaders sets the extra headers from the config and model profile
+func (c *AnthropicClient) addCustomHeaders(req *http.Request) {
+	for name, value := range c.httpSettings().Headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+}
+
+// describeHeaders lists the custom header names for status output. Values
+// are left out since they often carry tokens.
+func (h HTTPConfig) describeHeaders() string {
+	names := make([]string, 0, len(h.Headers))
+	for name := range h.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHTTPConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  HTTPConfig
+		wantErr string
+	}{
+		{name: "defaults", config: HTTPConfig{}},
+		{name: "bearer and endpoint", config: HTTPConfig{AuthStyle: "bearer", Endpoint: "/gateway/v1/messages"}},
+		{name: "unknown auth style", config: HTTPConfig{AuthStyle: "basic"}, wantErr: "auth_style must be"},
+		{name: "endpoint without a slash", config: HTTPConfig{Endpoint: "v1/messages"}, wantErr: "endpoint must start with '/'"},
+		{name: "full URL as endpoint", config: HTTPConfig{Endpoint: "https://gateway/v1/messages"}, wantErr: "endpoint must start with '/'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatal(err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTTPSettings(t *testing.T) {
+	config := HTTPConfig{
+		Headers:   map[string]string{"X-Team": "core", "X-Trace": "config"},
+		AuthStyle: "x-api-key",
+		Endpoint:  "/config/v1/messages",
+		Proxy:     "http://proxy:3128",
+	}
+	tests := []struct {
+		name    string
+		model   *ModelDefinition
+		want    HTTPConfig
+		wantURL string
+	}{
+		{name: "no model", want: config, wantURL: "https://gateway.example/config/v1/messages"},
+		{name: "model without settings", model: &ModelDefinition{}, want: config, wantURL: "https://gateway.example/config/v1/messages"},
+		{
+			name:  "model settings win",
+			model: &ModelDefinition{AuthStyle: "bearer", Endpoint: "/model/v1/messages", Headers: map[string]string{"X-Trace": "model", "X-Model": "1"}},
+			want: HTTPConfig{
+				Headers:   map[string]string{"X-Team": "core", "X-Trace": "model", "X-Model": "1"},
+				AuthStyle: "bearer",
+				Endpoint:  "/model/v1/messages",
+				Proxy:     "http://proxy:3128",
+			},
+			wantURL: "https://gateway.example/model/v1/messages",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &AnthropicClient{httpConfig: config, model: tt.model, baseURL: "https://gateway.example/"}
+			if got := c.httpSettings(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("httpSettings() = %+v, want %+v", got, tt.want)
+			}
+			if got := c.messagesURL(); got != tt.wantURL {
+				t.Errorf("messagesURL() = %s, want %s", got, tt.wantURL)
+			}
+		})
+	}
+	if got := config.Headers["X-Trace"]; got != "config" {
+		t.Errorf("the config's headers were changed to %s", got)
+	}
+
+	c := &AnthropicClient{baseURL: "https://api.anthropic.com"}
+	if got, want := c.messagesURL(), "https://api.anthropic.com"+defaultEndpoint; got != want {
+		t.Errorf("messagesURL() = %s, want %s", got, want)
+	}
+}
+
+func TestAddCustomHeaders(t *testing.T) {
+	t.Setenv("GATEWAY_TOKEN", "secret")
+	c := &AnthropicClient{
+		httpConfig: HTTPConfig{Headers: map[string]string{"X-Token": "${GATEWAY_TOKEN}", "X-Team": "core"}},
+		model:      &ModelDefinition{Headers: map[string]string{"X-Route": "$GATEWAY_TOKEN-route", "X-Unset": "${GATEWAY_UNSET}"}},
+	}
+	req := httptest.NewRequest("POST", "/", nil)
+	c.addCustomHeaders(req)
+	want := map[string]string{"X-Token": "secret", "X-Team": "core", "X-Route": "secret-route", "X-Unset": ""}
+	for name, value := range want {
+		if got := req.Header.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if got, want := c.httpSettings().describeHeaders(), "X-Route, X-Team, X-Token, X-Unset"; got != want {
+		t.Errorf("describeHeaders() = %s, want %s", got, want)
+	}
+}
+
+func TestNewHTTPClientProxy(t *testing.T) {
+	client, err := newHTTPClient(HTTPConfig{Proxy: "http://proxy.example:3128"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "https://api.anthropic.com/v1/messages", nil)
+	proxy, err := client.Transport.(*http.Transport).Proxy(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proxy == nil || proxy.String() != "http://proxy.example:3128" {
+		t.Errorf("proxy = %v, want http://proxy.example:3128", proxy)
+	}
+
+	for _, bad := range []string{"proxy.example:3128", "://"} {
+		if _, err := newHTTPClient(HTTPConfig{Proxy: bad}); err == nil || !strings.Contains(err.Error(), "invalid proxy URL") {
+			t.Errorf("newHTTPClient with proxy %q: err = %v", bad, err)
+		}
+	}
+}
+
+func TestNewHTTPClientCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(bundle, certPEM, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, map[string]string{"empty.pem": "no certificates here\n"})
+
+	plain, err := newHTTPClient(HTTPConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.Get(server.URL); err == nil {
+		t.Error("the test server's certificate was trusted without the CA bundle")
+	}
+
+	client, err := newHTTPClient(HTTPConfig{CABundle: bundle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with the CA bundle: %v", err)
+	}
+	resp.Body.Close()
+
+	tests := []struct {
+		bundle  string
+		wantErr string
+	}{
+		{bundle: filepath.Join(dir, "missing.pem"), wantErr: "failed to read CA bundle"},
+		{bundle: filepath.Join(dir, "empty.pem"), wantErr: "no certificates found"},
+	}
+	for _, tt := range tests {
+		if _, err := newHTTPClient(HTTPConfig{CABundle: tt.bundle}); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("newHTTPClient(%s): err = %v, want one containing %q", tt.bundle, err, tt.wantErr)
+		}
+	}
+}
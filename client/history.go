@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/chzyer/readline"
+)
+
+// secretPatterns match input that looks like it holds a credential. Lines
+// matching one aren't saved to the command history when exclude_secrets is
+// set.
+var secretPatterns = []string{
+	`sk-ant-[A-Za-z0-9_-]{10,}`,                                            // Anthropic API keys
+	`\bsk-[A-Za-z0-9_-]{20,}`,                                              // Other "sk-" API keys
+	`\b(AKIA|ASIA)[0-9A-Z]{16}\b`,                                          // AWS access key IDs
+	`\bgh[pousr]_[A-Za-z0-9]{20,}`,                                         // GitHub tokens
+	`\bxox[abprs]-[A-Za-z0-9-]{10,}`,                                       // Slack tokens
+	`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.`,                        // JWTs
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----`,                                   // PEM private keys
+	`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]{20,}`,                               // Authorization headers
+	`(?i)\b(api[_-]?key|secret|token|passw(or)?d)\w*["']?\s*[:=]\s*\S{8,}`, // key=value assignments
+}
+
+// maxHistoryMatches is how many matches /search-history lists
+const maxHistoryMatches = 20
+
+// defaultHistoryFile returns the command history file in the XDG state
+// directory, or "" if there is no home directory to put it in
+func defaultHistoryFile() string {
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if !filepath.IsAbs(stateDir) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		stateDir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateDir, "gchai", "history")
+}
+
+// findProjectRoot returns the directory of the project the client was
+// started in: the one holding the .gchai directory, or failing that the
+// root of the git repository. It returns "" outside any project.
+func findProjectRoot() string {
+	if dir := findProjectDir(); dir != "" {
+		return filepath.Dir(dir)
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// projectHistoryFile returns the history file of a project, kept next to
+// the shared one and named after the project's directory. The hash of its
+// path tells apart projects with the same name.
+func projectHistoryFile(file, root string) string {
+	sum := sha256.Sum256([]byte(root))
+	name := invalidToolChar.ReplaceAllString(filepath.Base(root), "_") + "-" + hex.EncodeToString(sum[:4])
+	return filepath.Join(filepath.Dir(file), "projects", name)
+}
+
+// commandHistory is the readline history of the lines typed at the prompt.
+// Lines are saved by the client rather than readline so that those holding
+// secrets can be left out.
+type commandHistory struct {
+	file    string
+	secrets []*regexp.Regexp // Nil when every line is saved
+	draft   string           // Text to start the next prompt with
+}
+
+// newCommandHistory sets up the history file for the config, creating it
+// readable only by the user
+func newCommandHistory(config HistoryConfig) (*commandHistory, error) {
+	h := &commandHistory{file: config.File}
+	if config.PerProject && h.file != "" {
+		if root := findProjectRoot(); root != "" {
+			h.file = projectHistoryFile(h.file, root)
+		}
+	}
+	if config.ExcludeSecrets {
+		for _, pattern := range append(secretPatterns, config.SecretPatterns...) {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid secret pattern %q: %v", pattern, err)
+			}
+			h.secrets = append(h.secrets, re)
+		}
+	}
+	if h.file == "" {
+		return h, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.file), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %v", err)
+	}
+	f, err := os.OpenFile(h.file, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create history file: %v", err)
+	}
+	f.Close()
+	return h, h.restrict()
+}
+
+// restrict makes the history file readable only by the user. Readline
+// writes a new file when it trims the history, so this is done again once
+// it has loaded it.
+func (h *commandHistory) restrict() error {
+	if h.file == "" {
+		return nil
+	}
+	if err := os.Chmod(h.file, 0600); err != nil {
+		return fmt.Errorf("failed to set history file permissions: %v", err)
+	}
+	return nil
+}
+
+// save adds a line to the history unless it looks like it holds a secret
+func (h *commandHistory) save(rl *readline.Instance, line string) {
+	if strings.TrimSpace(line) == "" || h.hasSecret(line) {
+		return
+	}
+	rl.SaveHistory(line)
+}
+
+// hasSecret reports whether a line matches one of the secret patterns
+func (h *commandHistory) hasSecret(line string) bool {
+	for _, re := range h.secrets {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// entries returns the lines in the history file, oldest first
+func (h *commandHistory) entries() []string {
+	if h.file == "" {
+		return nil
+	}
+	f, err := os.Open(h.file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// historyMatch is a line found by /search-history
+type historyMatch struct {
+	source string // Where the line came from, e.g. "input" or "user #3"
+	text   string
+	score  int
+	order  int // Larger is more recent
+}
+
+// searchHistoryCommand lists the typed lines and conversation lines that
+// fuzzy match a query, best first, and offers to put one of them at the
+// next prompt for editing
+func (c *AnthropicClient) searchHistoryCommand(query string) error {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return fmt.Errorf("usage: /search-history <query>")
+	}
+
+	var matches []historyMatch
+	var entries []string
+	if c.inputHistory != nil {
+		entries = c.inputHistory.entries()
+	}
+	// Newest first, so a line typed several times ranks as its latest use
+	seen := make(map[string]bool)
+	for i := len(entries) - 1; i >= 0; i-- {
+		line := entries[i]
+		if strings.HasPrefix(line, "/search-history") {
+			continue
+		}
+		if score, ok := fuzzyScore(query, line); ok && !seen[line] {
+			seen[line] = true
+			matches = append(matches, historyMatch{"input", line, score, i})
+		}
+	}
+	order := len(entries)
+	if c.history != nil {
+		for i, message := range c.history.Messages {
+			if message.Role == "system" {
+				continue
+			}
+			for _, line := range strings.Split(message.Content, "\n") {
+				order++
+				line = strings.TrimSpace(line)
+				if score, ok := fuzzyScore(query, line); ok && line != "" {
+					matches = append(matches, historyMatch{fmt.Sprintf("%s #%d", message.Role, i), line, score, order})
+				}
+			}
+		}
+	}
+	if len(matches) == 0 {
+		fmt.Println("No matches")
+		return nil
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].order > matches[j].order
+	})
+	if len(matches) > maxHistoryMatches {
+		matches = matches[:maxHistoryMatches]
+	}
+	for i, match := range matches {
+		fmt.Printf("%3d. (%s) %s\n", i+1, match.source, truncate(match.text, 120))
+	}
+	if c.rl == nil || c.inputHistory == nil {
+		return nil
+	}
+
+	answer, err := c.readAnswer("Edit which at the prompt? [number, Enter to skip]: ")
+	if err != nil || answer == "" {
+		return err
+	}
+	n, err := strconv.Atoi(answer)
+	if err != nil || n < 1 || n > len(matches) {
+		return fmt.Errorf("no match numbered %s", answer)
+	}
+	c.inputHistory.draft = matches[n-1].text
+	return nil
+}
+
+// fuzzyScore reports whether every word of the query appears in text with
+// its letters in order, ignoring case, and scores how well: letters that
+// follow each other or start words count for more, and a word found whole
+// counts most
+func fuzzyScore(query, text string) (int, bool) {
+	lower := []rune(strings.ToLower(text))
+	total := 0
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if strings.Contains(string(lower), word) {
+			total += 10
+		}
+		score, last, pos := 0, -2, 0
+		for _, r := range word {
+			for pos < len(lower) && lower[pos] != r {
+				pos++
+			}
+			if pos == len(lower) {
+				return 0, false
+			}
+			score++
+			if pos == last+1 {
+				score += 4
+			}
+			if pos == 0 || !unicode.IsLetter(lower[pos-1]) && !unicode.IsDigit(lower[pos-1]) {
+				score += 3
+			}
+			last = pos
+			pos++
+		}
+		total += score
+	}
+	return total, true
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+// blockDelimiter starts and ends a block of input that is sent as one
+// prompt, for pasting text that spans lines
+const blockDelimiter = `"""`
+
+// continuationPrompt is shown while a multi-line prompt is being entered
+const continuationPrompt = "... "
+
+// readInput reads a prompt or command, starting from the history's draft
+// if it has one. A line ending in a backslash continues on the next line,
+// and lines between two """ lines are read as one prompt. Only the first
+// line goes into the command history.
+func readInput(rl *readline.Instance, history *commandHistory) (string, error) {
+	line, err := rl.ReadlineWithDefault(history.draft)
+	history.draft = ""
+	if err != nil {
+		return "", err
+	}
+
+	block := strings.TrimSpace(line) == blockDelimiter
+	if !block {
+		history.save(rl, line)
+	}
+	if !block && !strings.HasSuffix(line, `\`) {
+		return line, nil
+	}
+
+	rl.SetPrompt(continuationPrompt)
+	defer rl.SetPrompt(rl.Config.Prompt)
+
+	var lines []string
+	if !block {
+		lines = append(lines, strings.TrimSuffix(line, `\`))
+	}
+	for {
+		next, err := rl.Readline()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case block && strings.TrimSpace(next) == blockDelimiter:
+			return strings.Join(lines, "\n"), nil
+		case !block && strings.HasSuffix(next, `\`):
+			lines = append(lines, strings.TrimSuffix(next, `\`))
+		case !block:
+			return strings.Join(append(lines, next), "\n"), nil
+		default:
+			lines = append(lines, next)
+		}
+	}
+}
+
+// editPrompt opens $VISUAL or $EDITOR, falling back to vi, on a temporary
+// file holding initial text, and returns what was saved
+func editPrompt(initial string) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	file, err := os.CreateTemp("", "gchai-prompt-*.md")
+	if err != nil {
+		return "", fmt.Errorf("failed to create prompt file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(initial)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write prompt file: %v", err)
+	}
+
+	// The editor may be given with arguments, e.g. "code --wait"
+	args := append(strings.Fields(editor), file.Name())
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor %s failed: %v", args[0], err)
+	}
+
+	content, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt file: %v", err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
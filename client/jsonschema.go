@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSchemaErrors caps how many validation errors are reported at once
+const maxSchemaErrors = 5
+
+// jsonSchemaValidator validates decoded JSON values against a JSON Schema.
+// It supports the commonly used subset of the specification: type, enum,
+// const, properties, required, additionalProperties, items, prefixItems,
+// numeric and length bounds, pattern, allOf/anyOf/oneOf/not and local $ref
+// pointers into definitions or $defs. Unknown keywords are ignored, and a
+// $ref that leads back to itself for the same value makes the schema
+// invalid.
+type jsonSchemaValidator struct {
+	root   interface{}
+	errors []string
+	refs   *schemaRefs
+}
+
+// schemaRefs tracks the $refs being followed, shared by a validator and
+// the sub-validators of anyOf, oneOf and not
+type schemaRefs struct {
+	// active holds each $ref being followed with the path of the value it
+	// applies to. Meeting one again for the same value means the schema
+	// refers back to itself, as {"$ref": "#"} does, and would never end.
+	active map[string]bool
+	cycle  string // The first such $ref, which makes the schema invalid
+}
+
+// validateJSONSchema checks value against schema and returns an error
+// describing the first few violations
+func validateJSONSchema(schema, value interface{}) error {
+	v := &jsonSchemaValidator{root: schema, refs: &schemaRefs{active: make(map[string]bool)}}
+	v.validate(schema, value, "$")
+	if v.refs.cycle != "" {
+		return fmt.Errorf("invalid schema: %s", v.refs.cycle)
+	}
+	if len(v.errors) == 0 {
+		return nil
+	}
+	if len(v.errors) > maxSchemaErrors {
+		v.errors = append(v.errors[:maxSchemaErrors], fmt.Sprintf("and %d more", len(v.errors)-maxSchemaErrors))
+	}
+	return fmt.Errorf("%s", strings.Join(v.errors, "; "))
+}
+
+func (v *jsonSchemaValidator) fail(path, format string, args ...interface{}) {
+	v.errors = append(v.errors, path+": "+fmt.Sprintf(format, args...))
+}
+
+// check runs a sub-validation without recording its errors
+func (v *jsonSchemaValidator) check(schema, value interface{}, path string) bool {
+	sub := &jsonSchemaValidator{root: v.root, refs: v.refs}
+	sub.validate(schema, value, path)
+	return len(sub.errors) == 0
+}
+
+func (v *jsonSchemaValidator) validate(schemaValue, value interface{}, path string) {
+	switch s := schemaValue.(type) {
+	case bool:
+		if !s {
+			v.fail(path, "no value is allowed here")
+		}
+		return
+	case map[string]interface{}:
+		v.validateObjectSchema(s, value, path)
+	default:
+		// Not a schema; nothing to enforce
+	}
+}
+
+func (v *jsonSchemaValidator) validateObjectSchema(schema map[string]interface{}, value interface{}, path string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		key := ref + " " + path
+		if v.refs.active[key] {
+			if v.refs.cycle == "" {
+				v.refs.cycle = fmt.Sprintf("%s: $ref %q refers back to itself", path, ref)
+			}
+			v.fail(path, "$ref %q refers back to itself", ref)
+			return
+		}
+		target, err := v.resolveRef(ref)
+		if err != nil {
+			v.fail(path, "%v", err)
+			return
+		}
+		v.refs.active[key] = true
+		v.validate(target, value, path)
+		delete(v.refs.active, key)
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		v.fail(path, "expected %s, got %s", describeType(t), jsonTypeName(value))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if reflect.DeepEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(path, "value %s is not one of %s", compactJSON(value), compactJSON(enum))
+		}
+	}
+	if constant, ok := schema["const"]; ok && !reflect.DeepEqual(constant, value) {
+		v.fail(path, "value must be %s", compactJSON(constant))
+	}
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(schema, val, path)
+	case []interface{}:
+		v.validateArray(schema, val, path)
+	case string:
+		v.validateString(schema, val, path)
+	case float64:
+		v.validateNumber(schema, val, path)
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			v.validate(sub, value, path)
+		}
+	}
+	if any, ok := schema["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range any {
+			if v.check(sub, value, path) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(path, "value does not match any of the allowed schemas (anyOf)")
+		}
+	}
+	if one, ok := schema["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, sub := range one {
+			if v.check(sub, value, path) {
+				matches++
+			}
+		}
+		if matches != 1 {
+			v.fail(path, "value matches %d schemas, expected exactly one (oneOf)", matches)
+		}
+	}
+	if not, ok := schema["not"]; ok && v.check(not, value, path) {
+		v.fail(path, "value must not match the schema in \"not\"")
+	}
+}
+
+func (v *jsonSchemaValidator) validateObject(schema map[string]interface{}, obj map[string]interface{}, path string) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if key, ok := name.(string); ok {
+				if _, present := obj[key]; !present {
+					v.fail(path, "missing required property %q", key)
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		childPath := path + "." + key
+		if propSchema, ok := properties[key]; ok {
+			v.validate(propSchema, obj[key], childPath)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.fail(path, "unexpected property %q", key)
+			}
+		case map[string]interface{}:
+			v.validate(additional, obj[key], childPath)
+		}
+	}
+
+	if min, ok := schemaNumber(schema, "minProperties"); ok && float64(len(obj)) < min {
+		v.fail(path, "expected at least %v properties, got %d", min, len(obj))
+	}
+	if max, ok := schemaNumber(schema, "maxProperties"); ok && float64(len(obj)) > max {
+		v.fail(path, "expected at most %v properties, got %d", max, len(obj))
+	}
+}
+
+func (v *jsonSchemaValidator) validateArray(schema map[string]interface{}, arr []interface{}, path string) {
+	prefix, _ := schema["prefixItems"].([]interface{})
+	for i, item := range arr {
+		childPath := fmt.Sprintf("%s[%d]", path, i)
+		if i < len(prefix) {
+			v.validate(prefix[i], item, childPath)
+			continue
+		}
+		if items, ok := schema["items"]; ok {
+			v.validate(items, item, childPath)
+		}
+	}
+
+	if min, ok := schemaNumber(schema, "minItems"); ok && float64(len(arr)) < min {
+		v.fail(path, "expected at least %v items, got %d", min, len(arr))
+	}
+	if max, ok := schemaNumber(schema, "maxItems"); ok && float64(len(arr)) > max {
+		v.fail(path, "expected at most %v items, got %d", max, len(arr))
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+		for i := range arr {
+			for j := i + 1; j < len(arr); j++ {
+				if reflect.DeepEqual(arr[i], arr[j]) {
+					v.fail(path, "items %d and %d are identical", i, j)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (v *jsonSchemaValidator) validateString(schema map[string]interface{}, s string, path string) {
+	length := float64(utf8.RuneCountInString(s))
+	if min, ok := schemaNumber(schema, "minLength"); ok && length < min {
+		v.fail(path, "string shorter than %v characters", min)
+	}
+	if max, ok := schemaNumber(schema, "maxLength"); ok && length > max {
+		v.fail(path, "string longer than %v characters", max)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			v.fail(path, "invalid pattern %q in schema: %v", pattern, err)
+		} else if !re.MatchString(s) {
+			v.fail(path, "string %q does not match pattern %q", s, pattern)
+		}
+	}
+}
+
+func (v *jsonSchemaValidator) validateNumber(schema map[string]interface{}, n float64, path string) {
+	if min, ok := schemaNumber(schema, "minimum"); ok && n < min {
+		v.fail(path, "%v is less than the minimum %v", n, min)
+	}
+	if max, ok := schemaNumber(schema, "maximum"); ok && n > max {
+		v.fail(path, "%v is greater than the maximum %v", n, max)
+	}
+	if min, ok := schemaNumber(schema, "exclusiveMinimum"); ok && n <= min {
+		v.fail(path, "%v must be greater than %v", n, min)
+	}
+	if max, ok := schemaNumber(schema, "exclusiveMaximum"); ok && n >= max {
+		v.fail(path, "%v must be less than %v", n, max)
+	}
+	if multiple, ok := schemaNumber(schema, "multipleOf"); ok && multiple > 0 {
+		if q := n / multiple; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.fail(path, "%v is not a multiple of %v", n, multiple)
+		}
+	}
+}
+
+// resolveRef resolves a local JSON pointer such as "#/$defs/item"
+func (v *jsonSchemaValidator) resolveRef(ref string) (interface{}, error) {
+	if ref == "#" {
+		return v.root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %q (only local references are supported)", ref)
+	}
+	var current interface{} = v.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		if current, ok = obj[part]; !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+	return current, nil
+}
+
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	n, ok := schema[key].(float64)
+	return n, ok
+}
+
+// matchesType reports whether value matches a "type" keyword, which may be
+// a single type name or a list of them
+func matchesType(t interface{}, value interface{}) bool {
+	switch types := t.(type) {
+	case string:
+		return matchesTypeName(types, value)
+	case []interface{}:
+		for _, name := range types {
+			if s, ok := name.(string); ok && matchesTypeName(s, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesTypeName(name string, value interface{}) bool {
+	switch name {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return jsonTypeName(value) == name
+	}
+}
+
+func describeType(t interface{}) string {
+	if types, ok := t.([]interface{}); ok {
+		names := make([]string, 0, len(types))
+		for _, name := range types {
+			names = append(names, fmt.Sprint(name))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func compactJSON(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// parseJSONResponse parses the JSON value of a model response, tolerating
+// surrounding whitespace and a markdown code fence. Anything after the value
+// is an error, so the model is asked to send the JSON alone. It returns the
+// raw JSON text along with the decoded value.
+func parseJSONResponse(text string) (string, interface{}, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text[strings.IndexByte(text+"\n", '\n'):], "\n")
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	}
+
+	var raw json.RawMessage
+	decoder := json.NewDecoder(strings.NewReader(text))
+	if err := decoder.Decode(&raw); err != nil {
+		return "", nil, fmt.Errorf("response is not valid JSON: %v", err)
+	}
+	if rest := strings.TrimSpace(text[decoder.InputOffset():]); rest != "" {
+		return "", nil, fmt.Errorf("response has text after the JSON value: %q", truncate(rest, 40))
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", nil, fmt.Errorf("response is not valid JSON: %v", err)
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, raw, "", "  "); err != nil {
+		return string(raw), value, nil
+	}
+	return indented.String(), value, nil
+}
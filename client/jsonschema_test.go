@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateJSONSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		value   string
+		wantErr string
+	}{
+		{name: "true schema", schema: `true`, value: `1`},
+		{name: "false schema", schema: `false`, value: `1`, wantErr: "no value is allowed"},
+		{name: "type", schema: `{"type": "string"}`, value: `"x"`},
+		{name: "wrong type", schema: `{"type": "string"}`, value: `1`, wantErr: "expected string, got number"},
+		{name: "type list", schema: `{"type": ["string", "null"]}`, value: `null`},
+		{name: "integer", schema: `{"type": "integer"}`, value: `2`},
+		{name: "not an integer", schema: `{"type": "integer"}`, value: `2.5`, wantErr: "expected integer"},
+		{name: "enum", schema: `{"enum": ["a", 1]}`, value: `1`},
+		{name: "not in enum", schema: `{"enum": ["a", 1]}`, value: `"b"`, wantErr: `value "b" is not one of ["a",1]`},
+		{name: "const", schema: `{"const": {"a": 1}}`, value: `{"a": 1}`},
+		{name: "wrong const", schema: `{"const": 1}`, value: `2`, wantErr: "value must be 1"},
+		{name: "properties", schema: `{"properties": {"a": {"type": "number"}}}`, value: `{"a": "x"}`, wantErr: "$.a: expected number"},
+		{name: "required", schema: `{"required": ["a"]}`, value: `{}`, wantErr: `missing required property "a"`},
+		{name: "no additional properties", schema: `{"properties": {"a": {}}, "additionalProperties": false}`, value: `{"a": 1, "b": 2}`, wantErr: `unexpected property "b"`},
+		{name: "additional properties schema", schema: `{"additionalProperties": {"type": "string"}}`, value: `{"b": 2}`, wantErr: "$.b: expected string"},
+		{name: "minProperties", schema: `{"minProperties": 1}`, value: `{}`, wantErr: "at least 1 properties"},
+		{name: "maxProperties", schema: `{"maxProperties": 1}`, value: `{"a": 1, "b": 2}`, wantErr: "at most 1 properties"},
+		{name: "items", schema: `{"items": {"type": "string"}}`, value: `["a", 1]`, wantErr: "$[1]: expected string"},
+		{name: "prefixItems", schema: `{"prefixItems": [{"type": "number"}], "items": {"type": "string"}}`, value: `[1, "a"]`},
+		{name: "wrong prefix item", schema: `{"prefixItems": [{"type": "number"}]}`, value: `["a"]`, wantErr: "$[0]: expected number"},
+		{name: "minItems", schema: `{"minItems": 2}`, value: `[1]`, wantErr: "at least 2 items"},
+		{name: "maxItems", schema: `{"maxItems": 1}`, value: `[1, 2]`, wantErr: "at most 1 items"},
+		{name: "uniqueItems", schema: `{"uniqueItems": true}`, value: `[1, 2, 1]`, wantErr: "items 0 and 2 are identical"},
+		{name: "minLength counts characters", schema: `{"minLength": 2}`, value: `"é"`, wantErr: "shorter than 2"},
+		{name: "maxLength", schema: `{"maxLength": 1}`, value: `"ab"`, wantErr: "longer than 1"},
+		{name: "pattern", schema: `{"pattern": "^a+$"}`, value: `"ab"`, wantErr: "does not match pattern"},
+		{name: "invalid pattern", schema: `{"pattern": "("}`, value: `"a"`, wantErr: "invalid pattern"},
+		{name: "minimum", schema: `{"minimum": 1}`, value: `0`, wantErr: "less than the minimum"},
+		{name: "maximum", schema: `{"maximum": 1}`, value: `2`, wantErr: "greater than the maximum"},
+		{name: "exclusiveMinimum", schema: `{"exclusiveMinimum": 1}`, value: `1`, wantErr: "must be greater than 1"},
+		{name: "exclusiveMaximum", schema: `{"exclusiveMaximum": 1}`, value: `1`, wantErr: "must be less than 1"},
+		{name: "multipleOf", schema: `{"multipleOf": 0.1}`, value: `0.3`},
+		{name: "not a multiple", schema: `{"multipleOf": 2}`, value: `3`, wantErr: "not a multiple of 2"},
+		{name: "allOf", schema: `{"allOf": [{"type": "number"}, {"minimum": 5}]}`, value: `3`, wantErr: "less than the minimum"},
+		{name: "anyOf", schema: `{"anyOf": [{"type": "string"}, {"type": "number"}]}`, value: `3`},
+		{name: "no anyOf match", schema: `{"anyOf": [{"type": "string"}, {"type": "null"}]}`, value: `3`, wantErr: "(anyOf)"},
+		{name: "oneOf", schema: `{"oneOf": [{"type": "number"}, {"minimum": 5}]}`, value: `3`},
+		{name: "oneOf matching twice", schema: `{"oneOf": [{"type": "number"}, {"minimum": 1}]}`, value: `3`, wantErr: "matches 2 schemas"},
+		{name: "not", schema: `{"not": {"type": "string"}}`, value: `"a"`, wantErr: `must not match`},
+		{name: "ref into $defs", schema: `{"$defs": {"id": {"type": "integer"}}, "properties": {"id": {"$ref": "#/$defs/id"}}}`, value: `{"id": "x"}`, wantErr: "$.id: expected integer"},
+		{name: "ref into definitions", schema: `{"definitions": {"a/b": {"type": "string"}}, "items": {"$ref": "#/definitions/a~1b"}}`, value: `["x"]`},
+		{name: "unresolvable ref", schema: `{"$ref": "#/$defs/missing"}`, value: `1`, wantErr: "unresolvable $ref"},
+		{name: "remote ref", schema: `{"$ref": "https://example.com/schema.json"}`, value: `1`, wantErr: "unsupported $ref"},
+		{
+			name:   "recursive schema",
+			schema: `{"type": "object", "properties": {"name": {"type": "string"}, "children": {"type": "array", "items": {"$ref": "#"}}}}`,
+			value:  `{"name": "a", "children": [{"name": "b", "children": [{"name": "c"}]}]}`,
+		},
+		{
+			name:    "error deep in a recursive schema",
+			schema:  `{"properties": {"children": {"items": {"$ref": "#"}}, "name": {"type": "string"}}}`,
+			value:   `{"children": [{"children": [{"name": 1}]}]}`,
+			wantErr: "$.children[0].children[0].name: expected string",
+		},
+		{name: "root refers to itself", schema: `{"$ref": "#"}`, value: `1`, wantErr: `$ref "#" refers back to itself`},
+		{name: "refs refer to each other", schema: `{"$defs": {"a": {"$ref": "#/$defs/b"}, "b": {"$ref": "#/$defs/a"}}, "$ref": "#/$defs/a"}`, value: `1`, wantErr: "refers back to itself"},
+		{name: "cycle through allOf", schema: `{"allOf": [{"$ref": "#"}]}`, value: `{}`, wantErr: "refers back to itself"},
+		{name: "cycle through anyOf", schema: `{"anyOf": [{"type": "number"}, {"$ref": "#"}]}`, value: `"x"`, wantErr: "invalid schema: $: $ref \"#\" refers back to itself"},
+		{name: "cycle through not", schema: `{"$defs": {"a": {"not": {"$ref": "#/$defs/a"}}}, "$ref": "#/$defs/a"}`, value: `1`, wantErr: "refers back to itself"},
+		{name: "cycle through additionalProperties", schema: `{"$defs": {"a": {"$ref": "#/$defs/a"}}, "additionalProperties": {"$ref": "#/$defs/a"}}`, value: `{"x": 1}`, wantErr: "$.x: $ref"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema, value interface{}
+			if err := json.Unmarshal([]byte(tt.schema), &schema); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			err := validateJSONSchema(schema, value)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatal(err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateJSONSchemaErrorLimit(t *testing.T) {
+	var schema, value interface{}
+	json.Unmarshal([]byte(`{"items": {"type": "string"}}`), &schema)
+	json.Unmarshal([]byte(`[1, 2, 3, 4, 5, 6, 7]`), &value)
+	err := validateJSONSchema(schema, value)
+	if err == nil || !strings.HasSuffix(err.Error(), "; and 2 more") {
+		t.Errorf("err = %v, want the first %d errors and a count of the rest", err, maxSchemaErrors)
+	}
+}
+
+func TestParseJSONResponse(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{text: `{"a":1}`, want: "{\n  \"a\": 1\n}"},
+		{text: "```json\n[1, 2]\n```", want: "[\n  1,\n  2\n]"},
+		{text: "  \"x\"  ", want: `"x"`},
+		{text: "not json", wantErr: true},
+		{text: "```\n{}\n```", want: "{}"},
+		{text: `{"a":1} {"a":2}`, wantErr: true},
+		{text: `{"a":1}}`, wantErr: true},
+		{text: "[1]\n\nHere is the list you asked for.", wantErr: true},
+		{text: "```json\n{}\n```\nDone.", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, _, err := parseJSONResponse(tt.text)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseJSONResponse(%q) = %q, %v", tt.text, got, err)
+		}
+	}
+
+	_, _, err := parseJSONResponse(`{"a":1}` + "\nThe object above has one key, a, set to one.")
+	if want := `response has text after the JSON value: "The object above has one key, a, set to ..."`; err == nil || err.Error() != want {
+		t.Errorf("err = %v, want %s", err, want)
+	}
+}
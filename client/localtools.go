@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	mcp_golang "github.com/metoro-io/mcp-golang"
+	"github.com/metoro-io/mcp-golang/transport/stdio"
+)
+
+// localServerName is the server name of the client's own tools
+const localServerName = "gchai"
+
+// ListContextArgs defines the arguments for the list_context tool
+type ListContextArgs struct{}
+
+// ReadContextArgs defines the arguments for the read_context tool
+type ReadContextArgs struct {
+	Name   string `json:"name" jsonschema:"required,description=Name or path of a file in the context (see list_context)"`
+	Offset int    `json:"offset,omitempty" jsonschema:"description=First line to return (1-based); defaults to the start of the file"`
+	Limit  int    `json:"limit,omitempty" jsonschema:"description=Maximum number of lines to return; defaults to the whole file"`
+}
+
+// SearchHistoryArgs defines the arguments for the search_history tool
+type SearchHistoryArgs struct {
+	Query      string `json:"query" jsonschema:"required,description=Text to search for; case-insensitive"`
+	MaxResults int    `json:"max_results,omitempty" jsonschema:"description=Maximum number of messages to return (default 20)"`
+}
+
+// LoadFileArgs defines the arguments for the load_file tool
+type LoadFileArgs struct {
+	Path string `json:"path" jsonschema:"required,description=File path; relative paths are resolved against the directory gchai was started in"`
+}
+
+const defaultHistoryResults = 20
+
+// localTools are tools that work on the client's own state: the files in
+// the context and the conversation history. They are served by an MCP
+// server running inside the client, so the model sees and calls them like
+// the tools of any other server.
+type localTools struct {
+	client *AnthropicClient
+	mu     sync.Mutex // Tool calls run on the library's goroutines
+}
+
+// startLocalServer starts the in-process server for the client's own tools
+// and connects to it through a pair of pipes. The library's stdio transport
+// holds a lock while writing that its reader also needs, so the pipes must
+// buffer or concurrent calls deadlock; OS pipes do, io.Pipe doesn't.
+func (c *AnthropicClient) startLocalServer() (*mcpServer, error) {
+	toServer, clientOut, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	fromServer, serverOut, err := os.Pipe()
+	if err != nil {
+		toServer.Close()
+		clientOut.Close()
+		return nil, err
+	}
+
+	local := mcp_golang.NewServer(stdio.NewStdioServerTransportWithIO(toServer, serverOut),
+		mcp_golang.WithName(localServerName), mcp_golang.WithVersion("1.0"))
+	t := &localTools{client: c}
+	tools := []struct {
+		name, description string
+		handler           any
+	}{
+		{"list_context", "Lists the files loaded into the conversation context", t.listContext},
+		{"read_context", "Reads a file from the conversation context, optionally a range of lines", t.readContext},
+		{"search_history", "Searches earlier messages of the conversation", t.searchHistory},
+		{"load_file", "Reads a file from disk and adds it to the conversation context for later prompts", t.loadFile},
+	}
+	for _, tool := range tools {
+		if err := local.RegisterTool(tool.name, tool.description, tool.handler); err != nil {
+			return nil, fmt.Errorf("failed to register %s: %v", tool.name, err)
+		}
+	}
+	if err := local.Serve(); err != nil {
+		return nil, err
+	}
+
+	server := &mcpServer{config: MCPServerConfig{Name: localServerName}, stdin: clientOut}
+	return server.connect(stdio.NewStdioServerTransportWithIO(fromServer, clientOut))
+}
+
+func (t *localTools) listContext(args ListContextArgs) (*mcp_golang.ToolResponse, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	files := t.client.context
+	if len(files) == 0 {
+		return mcp_golang.NewToolResponse(mcp_golang.NewTextContent("No files in context")), nil
+	}
+	var b strings.Builder
+	for _, file := range files {
+		fmt.Fprintf(&b, "%s (%s, %d lines, ~%d tokens)", file.Name, file.Language, strings.Count(file.Content, "\n")+1, estimateTokenCount(file.Content))
+		if file.Path != "" && file.Path != file.Name {
+			fmt.Fprintf(&b, " from %s", file.Path)
+		}
+		b.WriteString("\n")
+	}
+	return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(b.String())), nil
+}
+
+func (t *localTools) readContext(args ReadContextArgs) (*mcp_golang.ToolResponse, error) {
+	if args.Offset < 0 || args.Limit < 0 {
+		return nil, fmt.Errorf("offset and limit must not be negative")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var file *ContextFile
+	for i := range t.client.context {
+		if f := &t.client.context[i]; f.Name == args.Name || f.Path == args.Name {
+			file = f
+			break
+		}
+	}
+	if file == nil {
+		return nil, fmt.Errorf("%s is not in the context (see list_context)", args.Name)
+	}
+
+	lines := strings.Split(file.Content, "\n")
+	start := 0
+	if args.Offset > 0 {
+		start = args.Offset - 1
+	}
+	if start >= len(lines) {
+		return nil, fmt.Errorf("%s has only %d lines", file.Name, len(lines))
+	}
+	end := len(lines)
+	if args.Limit > 0 && start+args.Limit < end {
+		end = start + args.Limit
+	}
+	return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(strings.Join(lines[start:end], "\n"))), nil
+}
+
+func (t *localTools) searchHistory(args SearchHistoryArgs) (*mcp_golang.ToolResponse, error) {
+	if strings.TrimSpace(args.Query) == "" {
+		return nil, fmt.Errorf("query must not be empty")
+	}
+	limit := args.MaxResults
+	if limit <= 0 {
+		limit = defaultHistoryResults
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	query := strings.ToLower(args.Query)
+	var b strings.Builder
+	found := 0
+	for i, message := range t.client.history.Messages {
+		if message.Role == "system" || !strings.Contains(strings.ToLower(message.Content), query) {
+			continue
+		}
+		if found == limit {
+			b.WriteString("(more matches not shown)\n")
+			break
+		}
+		found++
+		fmt.Fprintf(&b, "[%d] %s: %s\n\n", i, message.Role, truncate(message.Content, 2000))
+	}
+	if found == 0 {
+		return mcp_golang.NewToolResponse(mcp_golang.NewTextContent("No messages match")), nil
+	}
+	return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(b.String())), nil
+}
+
+func (t *localTools) loadFile(args LoadFileArgs) (*mcp_golang.ToolResponse, error) {
+	if args.Path == "" {
+		return nil, fmt.Errorf("path must not be empty")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.client.loadFile(args.Path); err != nil {
+		return nil, err
+	}
+	file := t.client.context[len(t.client.context)-1]
+	fmt.Fprintf(os.Stderr, "📎 Loaded %s into context\n", args.Path)
+	text := fmt.Sprintf("Loaded %s into the context. Its content is:\n\n%s", file.Name, file.Content)
+	return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(text)), nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestLocalTools returns the tools of a client with two files in its
+// context and a system prompt in its history
+func newTestLocalTools() *localTools {
+	return &localTools{client: &AnthropicClient{
+		history: NewConversationHistory("system prompt mentions Needle"),
+		context: []ContextFile{
+			{Name: "main.go", Path: "cmd/main.go", Content: "package main\n\nfunc main() {}", Language: "Go"},
+			{Name: "notes.txt", Path: "notes.txt", Content: "one", Language: "plaintext"},
+		},
+	}}
+}
+
+func TestListContext(t *testing.T) {
+	tools := newTestLocalTools()
+	resp, err := tools.listContext(ListContextArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := toolResponseText(resp)
+	for _, want := range []string{"main.go (Go, 3 lines, ~", " from cmd/main.go\n", "notes.txt (plaintext, 1 lines, ~"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("list_context = %q, want it to contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, "from notes.txt") {
+		t.Errorf("list_context = %q names the path of a file loaded by its name", got)
+	}
+
+	tools.client.context = nil
+	resp, err = tools.listContext(ListContextArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := toolResponseText(resp); got != "No files in context" {
+		t.Errorf("list_context = %q with no files", got)
+	}
+}
+
+func TestReadContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    ReadContextArgs
+		want    string
+		wantErr string
+	}{
+		{name: "by name", args: ReadContextArgs{Name: "main.go"}, want: "package main\n\nfunc main() {}"},
+		{name: "by path", args: ReadContextArgs{Name: "cmd/main.go", Offset: 3}, want: "func main() {}"},
+		{name: "range", args: ReadContextArgs{Name: "main.go", Offset: 1, Limit: 2}, want: "package main\n"},
+		{name: "limit past the end", args: ReadContextArgs{Name: "main.go", Offset: 2, Limit: 10}, want: "\nfunc main() {}"},
+		{name: "offset past the end", args: ReadContextArgs{Name: "main.go", Offset: 4}, wantErr: "has only 3 lines"},
+		{name: "negative", args: ReadContextArgs{Name: "main.go", Limit: -1}, wantErr: "must not be negative"},
+		{name: "missing file", args: ReadContextArgs{Name: "other.go"}, wantErr: "other.go is not in the context"},
+	}
+	tools := newTestLocalTools()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tools.readContext(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := toolResponseText(resp); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchHistory(t *testing.T) {
+	tools := newTestLocalTools()
+	tools.client.history.Messages = append(tools.client.history.Messages,
+		Message{Role: "user", Content: "Where is the needle?"},
+		Message{Role: "assistant", Content: "In the haystack."},
+		Message{Role: "user", Content: "And the other NEEDLE?"},
+	)
+
+	tests := []struct {
+		name    string
+		args    SearchHistoryArgs
+		want    string
+		wantErr string
+	}{
+		{
+			name: "case-insensitive, skipping the system prompt",
+			args: SearchHistoryArgs{Query: "needle"},
+			want: "[1] user: Where is the needle?\n\n[3] user: And the other NEEDLE?\n\n",
+		},
+		{
+			name: "limited",
+			args: SearchHistoryArgs{Query: "Needle", MaxResults: 1},
+			want: "[1] user: Where is the needle?\n\n(more matches not shown)\n",
+		},
+		{name: "no match", args: SearchHistoryArgs{Query: "thread"}, want: "No messages match"},
+		{name: "empty query", args: SearchHistoryArgs{Query: " "}, wantErr: "query must not be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tools.searchHistory(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := toolResponseText(resp); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFileTool(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"small.py": "print('hi')\n",
+		"huge.txt": strings.Repeat("word ", 1<<20),
+	})
+	tools := newTestLocalTools()
+
+	resp, err := tools.loadFile(LoadFileArgs{Path: filepath.Join(dir, "small.py")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := toolResponseText(resp), "Loaded small.py into the context. Its content is:\n\nprint('hi')\n"; got != want {
+		t.Errorf("load_file = %q, want %q", got, want)
+	}
+	file := tools.client.context[len(tools.client.context)-1]
+	if file.Name != "small.py" || file.Language != "Python" {
+		t.Errorf("loaded %+v", file)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{name: "missing file", path: filepath.Join(dir, "nope.txt"), wantErr: "no such file"},
+		{name: "larger than the context window", path: filepath.Join(dir, "huge.txt"), wantErr: "would exceed the context window"},
+		{name: "empty path", wantErr: "path must not be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tools.loadFile(LoadFileArgs{Path: tt.path})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+			if len(tools.client.context) != 3 {
+				t.Errorf("context holds %d files after a failed load, want 3", len(tools.client.context))
+			}
+		})
+	}
+}
+
+func TestLocalServer(t *testing.T) {
+	c := newTestLocalTools().client
+	server, err := c.startLocalServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.close)
+
+	var names []string
+	for _, tool := range server.tools {
+		names = append(names, tool.Name)
+	}
+	if got, want := strings.Join(names, ","), "list_context,load_file,read_context,search_history"; got != want {
+		t.Errorf("tools = %s, want %s", got, want)
+	}
+
+	resp, err := server.client.CallTool(context.Background(), "read_context", ReadContextArgs{Name: "main.go", Offset: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := toolResponseText(resp); got != "func main() {}" {
+		t.Errorf("read_context = %q over the pipe", got)
+	}
+	resp, err = server.client.CallTool(context.Background(), "read_context", ReadContextArgs{Name: "other.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := toolResponseText(resp); !strings.Contains(got, "other.go is not in the context") {
+		t.Errorf("read_context = %q for a file not in the context", got)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// commandsDirName is the project directory holding prompt macros
+const commandsDirName = ".commands"
+
+// macroArgsVar is the variable holding the text typed after a macro's
+// named arguments
+const macroArgsVar = "ARGS"
+
+// $NAME and ${NAME} in a macro's body. Only the macro's own variables are
+// replaced, so other dollar signs in the text are left alone.
+var (
+	macroVar      = regexp.MustCompile(`\$(?:\{([A-Z][A-Z0-9_]*)\}|([A-Z][A-Z0-9_]*))`)
+	macroArgName  = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+	frontMatterRE = regexp.MustCompile(`(?s)^---\r?\n(.*?)\r?\n---\r?\n?`)
+)
+
+// macroFrontMatter is the YAML header of a prompt macro
+type macroFrontMatter struct {
+	Description string   `yaml:"description"` // Help text; defaults to the first line of the prompt
+	Model       string   `yaml:"model"`       // Model profile name or file to switch to; it stays loaded afterwards
+	Files       []string `yaml:"files"`       // Loaded into context first; relative to the project and inside it
+	Args        []string `yaml:"args"`        // Argument names, e.g. [FILE, FOCUS]; defaults to FILE if the prompt uses $FILE
+}
+
+// promptMacro is a markdown prompt in the project's .commands directory,
+// run as a slash command named after the file
+type promptMacro struct {
+	front macroFrontMatter
+	body  string
+}
+
+// isFileArg reports whether an argument names a file, which is loaded into
+// context when the macro runs: FILE, or a name ending in _FILE
+func isFileArg(name string) bool {
+	return name == "FILE" || strings.HasSuffix(name, "_FILE")
+}
+
+// parseMacro reads a macro file: optional front-matter between --- lines,
+// then the prompt
+func parseMacro(path string) (*promptMacro, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	macro := &promptMacro{body: string(content)}
+	if match := frontMatterRE.FindSubmatch(content); match != nil {
+		decoder := yaml.NewDecoder(bytes.NewReader(match[1]))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&macro.front); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("invalid front-matter: %v", err)
+		}
+		macro.body = string(content[len(match[0]):])
+	}
+	macro.body = strings.TrimSpace(macro.body)
+
+	if len(macro.front.Args) == 0 && macro.uses("FILE") {
+		macro.front.Args = []string{"FILE"}
+	}
+	for _, file := range macro.front.Files {
+		if !filepath.IsLocal(file) {
+			return nil, fmt.Errorf("files: %q must be a relative path inside the project", file)
+		}
+	}
+	for _, name := range macro.front.Args {
+		if !macroArgName.MatchString(name) || name == macroArgsVar {
+			return nil, fmt.Errorf("invalid argument name %q: use capitals, digits and _, and not %s", name, macroArgsVar)
+		}
+	}
+	return macro, nil
+}
+
+// uses reports whether the macro's prompt refers to a variable
+func (m *promptMacro) uses(name string) bool {
+	for _, match := range macroVar.FindAllStringSubmatch(m.body, -1) {
+		if match[1] == name || match[2] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// commandArgs returns the macro's arguments: one for each name, then the
+// rest of the line if the prompt uses $ARGS
+func (m *promptMacro) commandArgs() []commandArg {
+	var args []commandArg
+	for _, name := range m.front.Args {
+		arg := commandArg{name: name}
+		if isFileArg(name) {
+			arg.complete = completeFiles
+		}
+		args = append(args, arg)
+	}
+	if m.uses(macroArgsVar) {
+		args = append(args, commandArg{name: macroArgsVar, optional: true, rest: true, complete: completeFiles})
+	}
+	return args
+}
+
+// loadMacros adds a command for each .md file in the project's .commands
+// directory, which is found by walking up from the working directory
+func (c *AnthropicClient) loadMacros() {
+	dir := findUp(commandsDirName)
+	if dir == "" {
+		return
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.md"))
+	if err != nil {
+		return
+	}
+	for _, path := range paths {
+		if err := c.loadMacro(path); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Macro %s skipped: %v\n", path, err)
+		}
+	}
+}
+
+func (c *AnthropicClient) loadMacro(path string) error {
+	name := strings.TrimSuffix(filepath.Base(path), ".md")
+	if !validCommandName.MatchString(name) {
+		return fmt.Errorf("command names may only contain letters, digits, _ and -")
+	}
+	macro, err := parseMacro(path)
+	if err != nil {
+		return err
+	}
+	help := macro.front.Description
+	if help == "" {
+		first, _, _ := strings.Cut(macro.body, "\n")
+		help = truncate(first, 60)
+	}
+	return c.commands.add(&replCommand{
+		name:   "/" + name,
+		args:   macro.commandArgs(),
+		help:   help,
+		group:  "Project commands",
+		source: path,
+		run: func(c *AnthropicClient, args []string) (string, error) {
+			return c.runMacro(path, args)
+		},
+	})
+}
+
+// runMacro switches to the macro's model, loads its files and the files
+// given as arguments into context, and returns its prompt with the
+// arguments substituted. The file is read again so edits take effect
+// without a restart.
+func (c *AnthropicClient) runMacro(path string, args []string) (string, error) {
+	macro, err := parseMacro(path)
+	if err != nil {
+		return "", err
+	}
+	vars := make(map[string]string)
+	for i, name := range macro.front.Args {
+		if i >= len(args) {
+			return "", fmt.Errorf("%s needs a value for %s; the macro changed since startup", filepath.Base(path), name)
+		}
+		vars[name] = args[i]
+	}
+	if len(args) > len(macro.front.Args) {
+		vars[macroArgsVar] = args[len(macro.front.Args)]
+	}
+
+	dir := filepath.Dir(path)
+	if macro.front.Model != "" {
+		modelPath, err := c.resolveModelPath(macro.front.Model, dir)
+		if err != nil {
+			return "", err
+		}
+		if c.model == nil || c.model.source != modelPath {
+			if err := c.useModel(modelPath); err != nil {
+				return "", err
+			}
+			fmt.Println("The model stays loaded for later prompts; use /model to change it.")
+		}
+	}
+
+	// Front-matter files are relative to the project, the directory
+	// holding .commands, and may not lead out of it, even through a
+	// symlink; arguments are typed by the user and relative to where
+	// gchai runs
+	project := filepath.Dir(dir)
+	var files []string
+	for _, file := range macro.front.Files {
+		path, err := projectFile(project, file)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, path)
+	}
+	for _, name := range macro.front.Args {
+		if isFileArg(name) {
+			files = append(files, vars[name])
+		}
+	}
+	for _, file := range files {
+		if err := c.loadOrRefreshFile(file); err != nil {
+			return "", err
+		}
+	}
+
+	return macroVar.ReplaceAllStringFunc(macro.body, func(ref string) string {
+		name := strings.Trim(ref, "${}")
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		if name == macroArgsVar {
+			return ""
+		}
+		return ref
+	}), nil
+}
+
+// projectFile returns the path of a front-matter file, refusing one that
+// resolves to somewhere outside the project
+func projectFile(project, file string) (string, error) {
+	path := filepath.Join(project, file)
+	resolvedProject, err := filepath.EvalSymlinks(project)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to load %s: %v", path, err)
+	}
+	if rel, err := filepath.Rel(resolvedProject, resolved); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("files: %q leads outside the project", file)
+	}
+	return path, nil
+}
+
+// loadOrRefreshFile loads a file into context, or reads it again if it is
+// already there so the prompt sees its current content
+func (c *AnthropicClient) loadOrRefreshFile(path string) error {
+	for i := range c.context {
+		if c.context[i].Path == path {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read file: %v", err)
+			}
+			c.context[i].Content = string(content)
+			return nil
+		}
+	}
+	if err := c.loadFile(path); err != nil {
+		return fmt.Errorf("failed to load %s: %v", path, err)
+	}
+	fmt.Printf("Loaded file: %s\n", filepath.Base(path))
+	return nil
+}
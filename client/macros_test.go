@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeMacro writes a macro into the .commands directory of project and
+// returns its path
+func writeMacro(t *testing.T, project, name, content string) string {
+	t.Helper()
+	dir := filepath.Join(project, commandsDirName)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseMacro(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		want     macroFrontMatter
+		wantBody string
+		wantErr  string
+	}{
+		{
+			name:     "no front-matter",
+			content:  "Explain $ARGS\n",
+			wantBody: "Explain $ARGS",
+		},
+		{
+			name:     "FILE is an argument when the prompt uses it",
+			content:  "Review $FILE",
+			want:     macroFrontMatter{Args: []string{"FILE"}},
+			wantBody: "Review $FILE",
+		},
+		{
+			name:     "front-matter",
+			content:  "---\ndescription: Review\nmodel: opus\nfiles: [go.mod, docs/a.md]\nargs: [FILE, FOCUS]\n---\nReview $FILE for $FOCUS\n",
+			want:     macroFrontMatter{Description: "Review", Model: "opus", Files: []string{"go.mod", "docs/a.md"}, Args: []string{"FILE", "FOCUS"}},
+			wantBody: "Review $FILE for $FOCUS",
+		},
+		{name: "unknown key", content: "---\nmodle: opus\n---\nx", wantErr: "invalid front-matter"},
+		{name: "lower-case argument", content: "---\nargs: [file]\n---\nx", wantErr: "invalid argument name"},
+		{name: "ARGS as a named argument", content: "---\nargs: [ARGS]\n---\nx", wantErr: "invalid argument name"},
+		{name: "absolute file", content: "---\nfiles: [/etc/passwd]\n---\nx", wantErr: "inside the project"},
+		{name: "file above the project", content: "---\nfiles: [../secrets.txt]\n---\nx", wantErr: "inside the project"},
+		{name: "dot-dot inside a path", content: "---\nfiles: [docs/../../x]\n---\nx", wantErr: "inside the project"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			macro, err := parseMacro(writeMacro(t, t.TempDir(), "m.md", tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(macro.front, tt.want) {
+				t.Errorf("front-matter = %+v, want %+v", macro.front, tt.want)
+			}
+			if macro.body != tt.wantBody {
+				t.Errorf("body = %q, want %q", macro.body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRunMacro(t *testing.T) {
+	project := t.TempDir()
+	for name, content := range map[string]string{"go.mod": "module x\n", "lock.go": "package x\n"} {
+		if err := os.WriteFile(filepath.Join(project, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(project)
+	path := writeMacro(t, project, "review.md", "---\nfiles: [go.mod]\n---\nReview ${FILE}, costing $5, for: $ARGS")
+
+	c := &AnthropicClient{history: NewConversationHistory("")}
+	prompt, err := c.runMacro(path, []string{"lock.go", "channel closes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Review lock.go, costing $5, for: channel closes"; prompt != want {
+		t.Errorf("prompt = %q, want %q", prompt, want)
+	}
+	var loaded []string
+	for _, file := range c.context {
+		loaded = append(loaded, file.Name)
+	}
+	if want := []string{"go.mod", "lock.go"}; !reflect.DeepEqual(loaded, want) {
+		t.Errorf("context = %v, want %v", loaded, want)
+	}
+}
+
+func TestProjectFile(t *testing.T) {
+	base := t.TempDir()
+	project := filepath.Join(base, "project")
+	if err := os.MkdirAll(filepath.Join(project, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(base, "secret.txt"), filepath.Join(project, "docs", "a.md")} {
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(base, "secret.txt"), filepath.Join(project, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(project, "docs", "a.md"), filepath.Join(project, "inside.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file    string
+		wantErr bool
+	}{
+		{file: "docs/a.md"},
+		{file: "inside.md"},
+		{file: "link.txt", wantErr: true},
+		{file: "missing.txt", wantErr: true},
+	}
+	for _, tt := range tests {
+		path, err := projectFile(project, tt.file)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("projectFile(%s) = %q, %v", tt.file, path, err)
+		}
+	}
+}
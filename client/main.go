@@ -2,15 +2,16 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"reflect"
 	"strings"
@@ -32,15 +33,33 @@ type AnthropicParameters struct {
 	StopSequences []string `json:"stop_sequences,omitempty"` // Stop sequences
 }
 
-
 // ModelDefinition represents the structure of a model definition file
 type ModelDefinition struct {
-	Name       string               `json:"name"`        // Claude model name
-	Provider   string               `json:"provider"`    // "direct" or "bedrock"
-	Region     string               `json:"region,omitempty"` // For Bedrock
+	Name       string              `json:"name"`             // Claude model name
+	Provider   string              `json:"provider"`         // "direct" or "bedrock"
+	Region     string              `json:"region,omitempty"` // For Bedrock
 	Parameters AnthropicParameters `json:"parameters"`
-	System     string               `json:"system"`
-	Format     string               `json:"format,omitempty"` // Optional response format
+	System     string              `json:"system"`
+	Format     string              `json:"format,omitempty"` // "markdown" (default), "text" or "json"
+	Schema     json.RawMessage     `json:"schema,omitempty"` // JSON Schema for "json" format: inline object or file path
+
+	Extends      string `json:"extends,omitempty"`       // Profile this one inherits from
+	SystemAppend string `json:"system_append,omitempty"` // Appended to the inherited system prompt
+	Description  string `json:"description,omitempty"`   // Shown by /models
+	Credential   string `json:"credential,omitempty"`    // Named credential from the credentials file
+
+	Headers   map[string]string `json:"headers,omitempty"`    // Extra request headers, added to the config's
+	AuthStyle string            `json:"auth_style,omitempty"` // "x-api-key" or "bearer"
+	Endpoint  string            `json:"endpoint,omitempty"`   // Messages API path, e.g. "/gateway/v1/messages"
+
+	Version string   `json:"version,omitempty"` // anthropic-version header
+	Betas   []string `json:"betas,omitempty"`   // Beta features sent in the anthropic-beta header
+
+	source         string      // Model file path
+	chain          []string    // Profile names, this one first, then those it extends
+	schema         interface{} // Parsed Schema
+	schemaSource   string      // "inline" or the schema file path
+	systemTemplate string      // System before template rendering
 }
 
 // Message represents a chat message
@@ -60,6 +79,7 @@ type AnthropicRequest struct {
 	TopK          *int               `json:"top_k,omitempty"`
 	Stream        bool               `json:"stream,omitempty"`
 	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Tools         []AnthropicTool    `json:"tools,omitempty"`
 }
 
 // AnthropicResponse represents a chat response from Anthropic API
@@ -73,17 +93,52 @@ type AnthropicResponse struct {
 	Usage      AnthropicUsage     `json:"usage"`
 }
 
+// AnthropicStreamEvent represents a single server-sent event from a streaming response
+type AnthropicStreamEvent struct {
+	Type         string             `json:"type"` // "message_start", "content_block_delta", "message_delta", "error", ...
+	Index        int                `json:"index"`
+	Message      *AnthropicResponse `json:"message,omitempty"`
+	ContentBlock *AnthropicContent  `json:"content_block,omitempty"`
+	Delta        *AnthropicDelta    `json:"delta,omitempty"`
+	Usage        *AnthropicUsage    `json:"usage,omitempty"`
+	Error        *AnthropicError    `json:"error,omitempty"`
+}
+
+// AnthropicDelta represents incremental content or message state in a stream event
+type AnthropicDelta struct {
+	Type        string `json:"type,omitempty"` // "text_delta" or "input_json_delta" for content blocks
+	Text        string `json:"text,omitempty"`
+	PartialJSON string `json:"partial_json,omitempty"` // Fragment of a tool_use block's input
+	StopReason  string `json:"stop_reason,omitempty"`
+}
+
+// AnthropicError represents an error returned by the Anthropic API
+type AnthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
 // AnthropicMessage represents a message in Anthropic format
 type AnthropicMessage struct {
-	Role    string             `json:"role"`    // "user" or "assistant"
+	Role    string             `json:"role"` // "user" or "assistant"
 	Content []AnthropicContent `json:"content"`
 }
 
 // AnthropicContent represents content within a message
 type AnthropicContent struct {
-	Type   string       `json:"type"`   // "text" or "image"
+	Type   string       `json:"type"` // "text", "image", "tool_use" or "tool_result"
 	Text   string       `json:"text,omitempty"`
 	Source *ImageSource `json:"source,omitempty"`
+
+	// tool_use blocks
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result blocks
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
 }
 
 // ImageSource represents an image source
@@ -194,6 +249,7 @@ func (p *PerfMetrics) JSON() string {
 // ContextFile represents a loaded file in the context
 type ContextFile struct {
 	Name     string
+	Path     string // Path the file was loaded from
 	Content  string
 	Language string
 }
@@ -212,15 +268,15 @@ func estimateTokenCount(text string) int {
 	// Claude models generally use ~4 characters per token for English text
 	// This is still an approximation - actual tokenization varies by content
 	chars := len(text)
-	
+
 	// Account for different text types
 	words := len(strings.Fields(text))
 	if words == 0 {
 		return chars / 4
 	}
-	
+
 	avgWordLength := float64(chars) / float64(words)
-	
+
 	// Shorter words tend to be more tokens per character
 	// Longer words tend to be fewer tokens per character
 	if avgWordLength < 4 {
@@ -228,7 +284,7 @@ func estimateTokenCount(text string) int {
 	} else if avgWordLength > 6 {
 		return int(float64(chars) * 0.2) // ~5 chars per token
 	}
-	
+
 	return chars / 4 // Default 4 chars per token
 }
 
@@ -280,20 +336,50 @@ type AnthropicClient struct {
 
 	history      *ConversationHistory
 	showContext  bool      // Whether to show prompts and context before sending to LLM
+	oneShot      bool      // Answer a single prompt non-interactively and exit
 	lastContext  []Message // Stores the last context sent to the LLM
 	lastMetrics  *PerfMetrics
+	rl           *readline.Instance // Interactive input, once the REPL has started
+	inputHistory *commandHistory    // Lines typed at the prompt
+	commands     *commandRegistry   // REPL commands, built in and from plugins
+
+	templateVars templateVars // Variables for system prompt and prompt file templates
+	profileDirs  []string     // Directories searched for named model profiles
+	retry        RetryConfig  // Retry policy for API requests
+	markdown     *bool        // Overrides markdown rendering detection when set
+	config       *Config      // Settings the client was started with
+
+	credentials CredentialsConfig // Where the API key comes from
+	credential  *credential       // API key resolved from credentials
+	httpConfig  HTTPConfig        // Gateway headers, auth style and endpoint
+
+	mcpServers    []*mcpServer    // Connected MCP servers whose tools the model can call
+	toolPolicy    *toolPolicy     // Which tool calls run without asking
+	toolCalls     ToolCallsConfig // Concurrency and timeouts for tool calls
+	approvedTools map[string]bool // Tools the user approved for the rest of the session
 }
 
-func (c *AnthropicClient) loadModel(path string) error {
-	data, err := os.ReadFile(path)
+func (c *AnthropicClient) loadModel(nameOrPath string) error {
+	path, err := c.resolveModelPath(nameOrPath, "")
+	if err != nil {
+		return err
+	}
+
+	definition, chain, err := c.loadModelJSON(path, nil)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(definition)
 	if err != nil {
-		return fmt.Errorf("failed to read model file: %v", err)
+		return fmt.Errorf("failed to merge model file: %v", err)
 	}
 
 	var model ModelDefinition
 	if err := json.Unmarshal(data, &model); err != nil {
 		return fmt.Errorf("failed to parse model file: %v", err)
 	}
+	model.source = path
+	model.chain = chain
 
 	// For Anthropic models, validate the model name format
 	if model.Name == "" {
@@ -308,6 +394,35 @@ func (c *AnthropicClient) loadModel(path string) error {
 		return fmt.Errorf("provider must be 'direct' or 'bedrock'")
 	}
 
+	// Validate response format and load the JSON schema if one is given
+	switch model.Format {
+	case "", "markdown", "text", "json":
+	default:
+		return fmt.Errorf("format must be 'markdown', 'text' or 'json'")
+	}
+	if len(model.Schema) > 0 && model.Format != "json" {
+		return fmt.Errorf("schema requires format 'json'")
+	}
+	if err := (HTTPConfig{AuthStyle: model.AuthStyle, Endpoint: model.Endpoint}).validate(); err != nil {
+		return err
+	}
+	if err := model.validateBetas(); err != nil {
+		return err
+	}
+	if err := model.loadSchema(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	// Render the system prompt as a template
+	if model.System != "" {
+		rendered, err := c.renderTemplate(path, model.System, filepath.Dir(path))
+		if err != nil {
+			return fmt.Errorf("system prompt: %v", err)
+		}
+		model.systemTemplate = model.System
+		model.System = rendered
+	}
+
 	// Store the model configuration
 	c.model = &model
 	return nil
@@ -353,7 +468,7 @@ func NewAnthropicClient(provider, baseURL, region, defaultModel string) *Anthrop
 	if defaultModel == "" {
 		defaultModel = "claude-3-5-sonnet-20241022"
 	}
-	
+
 	client := &AnthropicClient{
 		provider:     provider,
 		baseURL:      baseURL,
@@ -361,8 +476,11 @@ func NewAnthropicClient(provider, baseURL, region, defaultModel string) *Anthrop
 		version:      "2023-06-01",
 		httpClient:   &http.Client{},
 		defaultModel: defaultModel,
+		profileDirs:  defaultProfileDirs(),
+		retry:        defaultConfig().Retry,
+		credentials:  defaultConfig().Credentials,
 	}
-	
+
 	return client
 }
 
@@ -371,7 +489,7 @@ func (c *AnthropicClient) initializeAuthentication() error {
 	if err := c.validateAuthentication(); err != nil {
 		switch c.provider {
 		case "direct":
-			return fmt.Errorf("Authentication setup error: %v\n\nTo use Anthropic's direct API:\n1. Get an API key from https://console.anthropic.com/\n2. Set environment variable: export ANTHROPIC_API_KEY=\"sk-ant-your-key-here\"", err)
+			return fmt.Errorf("Authentication setup error: %v\n\nTo use Anthropic's direct API:\n1. Get an API key from https://console.anthropic.com/\n2. Set environment variable: export ANTHROPIC_API_KEY=\"sk-ant-your-key-here\"\n   or add it to the credentials file %s (mode 0600)", err, c.credentials.File)
 		case "bedrock":
 			return fmt.Errorf("Authentication setup error: %v\n\nTo use Anthropic via Bedrock:\n1. Configure AWS credentials (aws configure or environment variables)\n2. Ensure you have access to Claude models in Bedrock", err)
 		default:
@@ -386,10 +504,15 @@ func (c *AnthropicClient) loadFile(path string) error {
 	if err != nil {
 		return fmt.Errorf("failed to read file: %v", err)
 	}
+	return c.addContextFile(filepath.Base(path), path, string(content))
+}
 
+// addContextFile adds content to the context, as long as it fits in the
+// context window
+func (c *AnthropicClient) addContextFile(name, path, content string) error {
 	// Get current context stats
 	stats := c.getContextStats()
-	newTokens := estimateTokenCount(string(content))
+	newTokens := estimateTokenCount(content)
 
 	// Check if adding this file would exceed the context window
 	if stats.UsedTokens+newTokens > stats.WindowSize {
@@ -397,13 +520,11 @@ func (c *AnthropicClient) loadFile(path string) error {
 			newTokens, stats.WindowSize, stats.UsedTokens)
 	}
 
-	filename := filepath.Base(path)
-	language := detectFileLanguage(filename)
-
 	c.context = append(c.context, ContextFile{
-		Name:     filename,
-		Content:  string(content),
-		Language: language,
+		Name:     name,
+		Path:     path,
+		Content:  content,
+		Language: detectFileLanguage(name),
 	})
 
 	return nil
@@ -461,15 +582,15 @@ func (c *AnthropicClient) buildContextMessage() string {
 	return b.String()
 }
 
-// convertHistoryToAnthropicFormat converts conversation history to Anthropic message format
-func (c *AnthropicClient) convertHistoryToAnthropicFormat() []AnthropicMessage {
+// convertToAnthropicFormat converts chat messages to Anthropic message format
+func convertToAnthropicFormat(history []Message) []AnthropicMessage {
 	var messages []AnthropicMessage
-	
-	for _, msg := range c.history.Messages {
+
+	for _, msg := range history {
 		if msg.Role == "system" {
 			continue // System messages handled separately in Anthropic API
 		}
-		
+
 		anthMsg := AnthropicMessage{
 			Role: msg.Role,
 			Content: []AnthropicContent{{
@@ -479,20 +600,20 @@ func (c *AnthropicClient) convertHistoryToAnthropicFormat() []AnthropicMessage {
 		}
 		messages = append(messages, anthMsg)
 	}
-	
+
 	return messages
 }
 
 // convertAnthropicToDisplayFormat converts Anthropic response content to display text
 func convertAnthropicToDisplayFormat(content []AnthropicContent) string {
 	var result strings.Builder
-	
+
 	for _, block := range content {
 		if block.Type == "text" {
 			result.WriteString(block.Text)
 		}
 	}
-	
+
 	return result.String()
 }
 
@@ -502,7 +623,7 @@ func (c *AnthropicClient) extractSystemPrompt() string {
 	if c.model != nil && c.model.System != "" {
 		return c.model.System
 	}
-	
+
 	// Second priority: system message in history
 	if c.history != nil {
 		for _, msg := range c.history.Messages {
@@ -511,12 +632,16 @@ func (c *AnthropicClient) extractSystemPrompt() string {
 			}
 		}
 	}
-	
+
 	return ""
 }
 
-// ChatRequest is an alias for AnthropicRequest to maintain compatibility
-type ChatRequest = AnthropicRequest
+// ChatRequest carries the messages for a single Chat call: loaded context
+// (if any) followed by the conversation history
+type ChatRequest struct {
+	Messages []Message
+	Stream   bool
+}
 
 // ChatResponse is an alias for AnthropicResponse to maintain compatibility
 type ChatResponse = AnthropicResponse
@@ -525,8 +650,8 @@ func (c *AnthropicClient) Chat(ctx context.Context, req *ChatRequest) error {
 	metrics := &PerfMetrics{}
 	metrics.start()
 
-	// Convert history to Anthropic format
-	anthropicMessages := c.convertHistoryToAnthropicFormat()
+	// Convert request messages to Anthropic format
+	anthropicMessages := convertToAnthropicFormat(req.Messages)
 	systemPrompt := c.extractSystemPrompt()
 
 	// Build proper Anthropic request
@@ -535,7 +660,7 @@ func (c *AnthropicClient) Chat(ctx context.Context, req *ChatRequest) error {
 		MaxTokens: 4096, // Default
 		Messages:  anthropicMessages,
 		System:    systemPrompt,
-		Stream:    true,
+		Stream:    req.Stream,
 	}
 
 	// Override with model configuration if available
@@ -598,79 +723,63 @@ func (c *AnthropicClient) Chat(ctx context.Context, req *ChatRequest) error {
 			fmt.Printf("%d. [%s]: %s\n", i+1, msg.Role, content)
 		}
 
-		fmt.Print("\nSend this request? [Y/n]: ")
-		reader := bufio.NewReader(os.Stdin)
-		response, err := reader.ReadString('\n')
+		fmt.Println()
+		ok, err := c.confirm("Send this request?", true)
 		if err != nil {
-			return fmt.Errorf("failed to read user input: %v", err)
+			return err
 		}
-		response = strings.TrimSpace(strings.ToLower(response))
-		if response == "n" || response == "no" {
+		if !ok {
 			return fmt.Errorf("submission cancelled by user")
 		}
 		fmt.Println()
 	}
 
-	// Marshal request
-	jsonBody, err := json.Marshal(anthropicReq)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %v", err)
+	// In JSON mode, prefill the assistant turn so the model answers with JSON
+	jsonMode := c.model != nil && c.model.Format == "json"
+	var prefill string
+	if jsonMode {
+		prefill = c.model.jsonPrefill()
+		anthropicReq.Messages = append(anthropicReq.Messages, AnthropicMessage{
+			Role:    "assistant",
+			Content: []AnthropicContent{{Type: "text", Text: prefill}},
+		})
 	}
 
-	// Create HTTP request
-	url := c.baseURL + "/v1/messages"
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonBody))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+	// One-shot JSON output is printed only once it has been validated
+	renderer := c.newResponseRenderer()
+	if jsonMode && c.oneShot {
+		renderer = newMarkdownRenderer(io.Discard, false)
 	}
+	renderer.Write(prefill)
 
-	// Add authentication headers
-	if err := c.addAuthHeaders(httpReq); err != nil {
-		return fmt.Errorf("failed to add auth headers: %v", err)
+	// Tools aren't offered in JSON mode, where the answer must be the JSON
+	if !jsonMode {
+		anthropicReq.Tools = c.mcpTools()
 	}
 
-	// Send request
-	resp, err := c.httpClient.Do(httpReq)
+	response, err := c.chatWithTools(ctx, anthropicReq, renderer, metrics)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return err
 	}
-
-	var fullResponse strings.Builder
-
-	if anthropicReq.Stream {
-		// Handle streaming response (to be implemented in Phase 1.5)
-		return fmt.Errorf("streaming responses will be implemented in Phase 1.5")
-	} else {
-		// Handle non-streaming response
-		var anthropicResp AnthropicResponse
-		if err := json.NewDecoder(resp.Body).Decode(&anthropicResp); err != nil {
-			return fmt.Errorf("failed to decode response: %v", err)
+	if jsonMode {
+		if response, err = c.enforceJSON(ctx, anthropicReq, prefill, response, renderer, metrics); err != nil {
+			return err
 		}
-
-		// Extract content from response
-		content := convertAnthropicToDisplayFormat(anthropicResp.Content)
-		fullResponse.WriteString(content)
-		fmt.Print(content)
-		metrics.addTokens(content)
-
-		// Update metrics with usage info
-		if anthropicResp.Usage.OutputTokens > 0 {
-			metrics.totalTokens = anthropicResp.Usage.OutputTokens
+		if c.oneShot {
+			fmt.Println(response)
 		}
 	}
 
 	metrics.finish()
-	fmt.Print(metrics)
+	if c.oneShot {
+		fmt.Fprint(os.Stderr, metrics)
+	} else {
+		fmt.Print(metrics)
+	}
 
 	// Add response to conversation history
 	if c.history != nil {
-		c.history.AddAssistantMessage(fullResponse.String())
+		c.history.AddAssistantMessage(response)
 	}
 
 	// Store metrics
@@ -679,258 +788,162 @@ func (c *AnthropicClient) Chat(ctx context.Context, req *ChatRequest) error {
 	return nil
 }
 
-func setupMCP() {
-	// TODO: Implement MCP setup once the correct MCP Go library is identified
-	// The current code references non-existent packages:
-	// - http.NewHTTPClientTransport (not a standard library function)
-	// - mcp_golang (package not found)
-	
-	log.Println("MCP setup not implemented yet")
-}
-
-// showCommands prints the list of available commands
-func showCommands() {
-	fmt.Println("Available commands:")
-	fmt.Println("  /help           - Show this help message")
-	fmt.Println("  /load <file>    - Load a file into context")
-	fmt.Println("  /model <file>   - Load model configuration from file")
-	fmt.Println("  /status         - Show current model and context status")
-	fmt.Println("  /history        - Show conversation history")
-	fmt.Println("  /clear          - Clear conversation history")
-	fmt.Println("  /dump           - Dump context to file")
-	fmt.Println("  exit            - Exit the program")
-	fmt.Println()
-}
-
-func main() {
-		}
-
-		// Calculate token estimates per message type
-		var systemTokens, contextTokens, userTokens, assistantTokens int
-		for _, msg := range req.Messages {
-			tokens := estimateTokenCount(msg.Content)
-			switch msg.Role {
-			case "system":
-				systemTokens += tokens
-			case "user":
-				// First user message after system is typically context
-				if systemTokens > 0 && userTokens == 0 && contextTokens == 0 && strings.Contains(msg.Content, "Here is the current context") {
-					contextTokens = tokens
-				} else {
-					userTokens += tokens
-				}
-			case "assistant":
-				assistantTokens += tokens
-			}
-		}
-		totalTokens := systemTokens + contextTokens + userTokens + assistantTokens
-
-		// Calculate expected response size based on context
-		// Rule of thumb: responses might be ~2x the size of the prompt
-		expectedResponseTokens := userTokens * 2
-		if numPredict < expectedResponseTokens {
-			fmt.Printf("\n⚠️  Warning: NumPredict (%d) may be too small for expected response size (%d tokens)\n",
-				numPredict, expectedResponseTokens)
-			fmt.Println("   Consider increasing NumPredict in the model definition if responses are being truncated.")
-		}
-
-		// Show token usage breakdown
-		fmt.Println("\nEstimated Token Usage:")
-		fmt.Println("---------------------")
-		if systemTokens > 0 {
-			fmt.Printf("System Messages:  %7d tokens\n", systemTokens)
-		}
-		if contextTokens > 0 {
-			fmt.Printf("Loaded Context:   %7d tokens\n", contextTokens)
-		}
-		fmt.Printf("User Messages:   %7d tokens\n", userTokens)
-		fmt.Printf("AI Responses:    %7d tokens\n", assistantTokens)
-		fmt.Printf("Total Size:      %7d tokens\n", totalTokens)
-
-		// Show context window utilization
-		contextWindow := 4096 // Default
-		if c.model != nil && c.model.Options.NumCtx > 0 {
-			contextWindow = c.model.Options.NumCtx
-		}
-		usagePercent := float64(totalTokens) / float64(contextWindow) * 100
-		fmt.Printf("Context Window:  %7d tokens\n", contextWindow)
-		fmt.Printf("Window Usage:    %7.1f%%\n", usagePercent)
-
-		if usagePercent > 90 {
-			fmt.Printf("\n⚠️  Warning: Request is using %.1f%% of the context window!\n", usagePercent)
-		}
-
-		fmt.Println("\nConversation Context and Messages:")
-		fmt.Println("--------------------------------")
-		caser := cases.Title(language.English)
-		for i, msg := range req.Messages {
-			role := caser.String(msg.Role)
-			if i > 0 {
-				fmt.Println() // Add blank line between messages
-			}
-			fmt.Printf("[%s]:\n%s", role, msg.Content)
-		}
-
-		fmt.Printf("\n\nReady to submit? (yes/no): ")
-
-		var response string
-		fmt.Scanln(&response)
-		response = strings.ToLower(strings.TrimSpace(response))
-
-		if response != "yes" && response != "y" {
-			return fmt.Errorf("submission cancelled by user")
-		}
-		fmt.Println("\nSubmitting request...")
-	}
-
-	// Prepare request
-	if c.model != nil {
-		req.Model = c.model.Name
-
-		// Map model parameters to Anthropic parameters
-		params := c.model.Parameters
-		if params.Temperature > 0 {
-			req.Temperature = &params.Temperature
-		}
-		if params.TopP > 0 {
-			req.TopP = &params.TopP
-		}
-		if params.NumPredict > 0 {
-			req.MaxTokens = &params.NumPredict
-		}
-		if params.RepeatPenalty > 0 {
-			// Convert repeat_penalty to frequency_penalty (different scale)
-			freqPenalty := (params.RepeatPenalty - 1.0) * 0.5
-			if freqPenalty > 2.0 {
-				freqPenalty = 2.0
-			}
-			req.FrequencyPenalty = &freqPenalty
-		}
-		if params.Seed > 0 {
-			req.Seed = &params.Seed
-		}
-		if params.Stop != "" {
-			req.Stop = []string{params.Stop}
-		}
-	} else {
-		req.Model = c.defaultModel
-	}
-
-	jsonBody, err := json.Marshal(req)
+// sendRequest posts a request to the Messages API and renders the response
+// as it arrives. It returns the full response text.
+func (c *AnthropicClient) sendRequest(ctx context.Context, anthropicReq *AnthropicRequest, renderer *markdownRenderer, metrics *PerfMetrics) (string, error) {
+	response, err := c.sendMessage(ctx, anthropicReq, renderer, metrics)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %v", err)
+		return "", err
 	}
+	return convertAnthropicToDisplayFormat(response.Content), nil
+}
 
-	url := c.baseURL + "/v1/chat/completions"
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonBody))
+// sendMessage posts a request to the Messages API and renders the response
+// text as it arrives. It returns the response's content blocks, including
+// any tool_use blocks, and stop reason.
+func (c *AnthropicClient) sendMessage(ctx context.Context, anthropicReq *AnthropicRequest, renderer *markdownRenderer, metrics *PerfMetrics) (*AnthropicResponse, error) {
+	// Marshal request
+	jsonBody, err := json.Marshal(anthropicReq)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
-	// Add Anthropic authentication headers
-	if err := c.addAuthHeaders(httpReq); err != nil {
-		return fmt.Errorf("failed to add auth headers: %v", err)
-	}
-
-	resp, err := c.httpClient.Do(httpReq)
+	// Send request, retrying transient failures
+	resp, err := c.postWithRetry(ctx, c.messagesURL(), jsonBody)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %v", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
+	var response AnthropicResponse
+	var outputTokens int
 
-	var fullResponse strings.Builder
-	if req.Stream {
-		// Handle streaming response
+	if anthropicReq.Stream {
+		// Handle streaming response (server-sent events). Content blocks
+		// are rebuilt from their start, delta and stop events.
+		var toolInput strings.Builder
 		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
 		for scanner.Scan() {
 			line := scanner.Text()
-			if strings.HasPrefix(line, "data: ") {
-				data := strings.TrimPrefix(line, "data: ")
-				if data == "[DONE]" {
-					break
-				}
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
 
-				var chatResp ChatResponse
-				if err := json.Unmarshal([]byte(data), &chatResp); err != nil {
-					continue // Skip malformed responses
-				}
+			var event AnthropicStreamEvent
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				continue // Skip malformed events
+			}
 
-				if len(chatResp.Choices) > 0 && chatResp.Choices[0].Delta != nil {
-					content := chatResp.Choices[0].Delta.Content
-					if content != "" {
-						// Only print the user's prompt in regular mode if showContext is false
-						if metrics.totalTokens == 0 && !c.showContext {
-							for _, msg := range req.Messages {
-								if msg.Role == "user" {
-									fmt.Printf("\nPrompt: %s\n\n", msg.Content)
-									break
-								}
-							}
-						}
-
-						// Accumulate and print response
-						fullResponse.WriteString(content)
-						fmt.Print(content)
-						metrics.addTokens(content)
+			switch event.Type {
+			case "content_block_start":
+				if event.ContentBlock != nil {
+					response.Content = append(response.Content, *event.ContentBlock)
+					toolInput.Reset()
+				}
+			case "content_block_delta":
+				if event.Delta == nil || len(response.Content) == 0 {
+					continue
+				}
+				block := &response.Content[len(response.Content)-1]
+				switch event.Delta.Type {
+				case "text_delta":
+					block.Text += event.Delta.Text
+					renderer.Write(event.Delta.Text)
+					metrics.addTokens(event.Delta.Text)
+				case "input_json_delta":
+					toolInput.WriteString(event.Delta.PartialJSON)
+				}
+			case "content_block_stop":
+				if n := len(response.Content); n > 0 && response.Content[n-1].Type == "tool_use" {
+					input := toolInput.String()
+					if input == "" {
+						input = "{}"
 					}
+					response.Content[n-1].Input = json.RawMessage(input)
+				}
+			case "message_delta":
+				if event.Delta != nil && event.Delta.StopReason != "" {
+					response.StopReason = event.Delta.StopReason
 				}
+				if event.Usage != nil && event.Usage.OutputTokens > 0 {
+					outputTokens = event.Usage.OutputTokens
+				}
+			case "error":
+				renderer.Flush()
+				if event.Error != nil {
+					return nil, fmt.Errorf("stream error (%s): %s", event.Error.Type, event.Error.Message)
+				}
+				return nil, fmt.Errorf("stream error: %s", line)
 			}
 		}
+		renderer.Flush()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read response stream: %v", err)
+		}
 	} else {
 		// Handle non-streaming response
-		var chatResp ChatResponse
-		if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
-			return fmt.Errorf("failed to decode response: %v", err)
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %v", err)
 		}
 
-		if len(chatResp.Choices) > 0 && chatResp.Choices[0].Message != nil {
-			content := chatResp.Choices[0].Message.Content
-			fullResponse.WriteString(content)
-			fmt.Print(content)
-			metrics.addTokens(content)
-		}
+		// Extract content from response
+		content := convertAnthropicToDisplayFormat(response.Content)
+		renderer.Write(content)
+		renderer.Flush()
+		metrics.addTokens(content)
+		outputTokens = response.Usage.OutputTokens
 	}
 
-	metrics.finish()
-	fmt.Print(metrics)
-
-	// Add response to conversation history
-	if c.history != nil {
-		c.history.AddAssistantMessage(fullResponse.String())
+	// Prefer the API's token count over our estimate
+	if outputTokens > 0 {
+		metrics.totalTokens = outputTokens
 	}
 
-	// Save the last context for potential dumping later
-	c.lastContext = req.Messages
-
-	return nil
+	return &response, nil
 }
 
-func setupMCP() {
-	// TODO: Implement MCP setup once the correct MCP Go library is identified
-	// The current code references non-existent packages:
-	// - http.NewHTTPClientTransport (not a standard library function)
-	// - mcp_golang (package not found)
-	
-	log.Println("MCP setup not implemented yet")
+// confirm asks a yes/no question and returns the answer, using defaultYes
+// when the user just presses enter
+func (c *AnthropicClient) confirm(question string, defaultYes bool) (bool, error) {
+	hint := "[y/N]"
+	if defaultYes {
+		hint = "[Y/n]"
+	}
+	response, err := c.readAnswer(fmt.Sprintf("%s %s: ", question, hint))
+	if err != nil {
+		return false, err
+	}
+	if response == "" {
+		return defaultYes, nil
+	}
+	return response == "y" || response == "yes", nil
 }
 
-// showCommands prints the list of available commands
-func showCommands() {
-	fmt.Println("Available commands:")
-	fmt.Println("  /help           - Show this help message")
-	fmt.Println("  /load <file>    - Load a file into the context")
-	fmt.Println("  /model <file>   - Load a model definition file")
-	fmt.Println("  /status         - Show current model and context status")
-	fmt.Println("  /history        - Show conversation history")
-	fmt.Println("  /clear          - Clear conversation history")
-	fmt.Println("  /dump           - Write current context to context-dump.txt")
-	fmt.Println("  exit            - Exit the program")
-	fmt.Println()
+// readAnswer shows a prompt and returns the user's answer, trimmed and in
+// lower case. Once the REPL is running the answer is read through readline
+// so it doesn't race with its reader.
+func (c *AnthropicClient) readAnswer(prompt string) (string, error) {
+	var response string
+	if c.rl != nil {
+		c.rl.SetPrompt(prompt)
+		c.rl.HistoryDisable()
+		line, err := c.rl.Readline()
+		c.rl.HistoryEnable()
+		c.rl.SetPrompt(c.rl.Config.Prompt)
+		if err != nil {
+			return "", fmt.Errorf("failed to read user input: %v", err)
+		}
+		response = line
+	} else {
+		fmt.Print(prompt)
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("failed to read user input: %v", err)
+		}
+		response = line
+	}
+	return strings.TrimSpace(strings.ToLower(response)), nil
 }
 
 func main() {
@@ -942,33 +955,93 @@ func main() {
 		modelConfig  string
 		defaultModel string
 		showContext  bool
+		once         bool
+		varsFile     string
+		vars         templateVars
+	}
+	flags.vars = make(templateVars)
+
+	// Load config files; flag defaults show the built-in settings
+	defaults := defaultConfig()
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	// Parse command line flags
-	flag.StringVar(&flags.provider, "provider", "direct", "Provider to use: direct or bedrock")
-	flag.StringVar(&flags.baseURL, "url", "https://api.anthropic.com", "Base URL of the Anthropic API server")
-	flag.StringVar(&flags.region, "region", "us-east-1", "AWS region for Bedrock")
+	flag.StringVar(&flags.provider, "provider", defaults.Provider, "Provider to use: direct or bedrock")
+	flag.StringVar(&flags.baseURL, "url", defaults.URL, "Base URL of the Anthropic API server")
+	flag.StringVar(&flags.region, "region", defaults.Region, "AWS region for Bedrock")
 	flag.StringVar(&flags.prompt, "prompt", "", "Path to initial prompt file")
-	flag.StringVar(&flags.modelConfig, "model", "", "Path to model configuration file")
-	flag.StringVar(&flags.defaultModel, "default-model", "claude-3-5-sonnet-20241022", "Default model to use if no model config is provided")
+	flag.StringVar(&flags.modelConfig, "model", "", "Model profile name or path to model configuration file")
+	flag.StringVar(&flags.defaultModel, "default-model", defaults.DefaultModel, "Default model to use if no model config is provided")
 	flag.BoolVar(&flags.showContext, "context", false, "Show prompts and context before sending to LLM")
 	flag.BoolVar(&flags.showContext, "c", false, "Show prompts and context before sending to LLM (shorthand)")
+	flag.Var(flags.vars, "var", "Template variable key=value for system prompts and prompt files (repeatable)")
+	flag.StringVar(&flags.varsFile, "vars", "", "Path to a JSON file of template variables")
+	flag.BoolVar(&flags.once, "once", false, "Answer the -prompt file (or stdin) and exit, printing only the response")
 	flag.Parse()
 
+	// Environment variables override config files, and flags given on the
+	// command line override both
+	if err := cfg.applyEnv(); err != nil {
+		log.Fatal(err)
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "provider":
+			cfg.Provider = flags.provider
+		case "url":
+			cfg.URL = flags.baseURL
+		case "region":
+			cfg.Region = flags.region
+		case "model":
+			cfg.Model = flags.modelConfig
+		case "default-model":
+			cfg.DefaultModel = flags.defaultModel
+		case "context", "c":
+			cfg.UI.ShowContext = &flags.showContext
+		}
+	})
+	if err := cfg.validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
 	// Create Anthropic client
-	anthropicClient := NewAnthropicClient(flags.provider, flags.baseURL, flags.region, flags.defaultModel)
+	anthropicClient := NewAnthropicClient(cfg.Provider, cfg.URL, cfg.Region, cfg.DefaultModel)
 	anthropicClient.history = NewConversationHistory("")
-	anthropicClient.showContext = flags.showContext
-	
-	// Validate authentication early
-	if err := anthropicClient.initializeAuthentication(); err != nil {
+	anthropicClient.showContext = cfg.UI.ShowContext != nil && *cfg.UI.ShowContext
+	anthropicClient.retry = cfg.Retry
+	anthropicClient.markdown = cfg.UI.Markdown
+	anthropicClient.config = cfg
+	anthropicClient.credentials = cfg.Credentials
+	anthropicClient.httpConfig = cfg.HTTP
+	if anthropicClient.httpClient, err = newHTTPClient(cfg.HTTP); err != nil {
 		log.Fatal(err)
 	}
 
+	// Collect template variables; -var flags override the vars file
+	anthropicClient.templateVars = make(templateVars)
+	if flags.varsFile != "" {
+		vars, err := loadTemplateVars(flags.varsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		anthropicClient.templateVars = vars
+	}
+	for k, v := range flags.vars {
+		anthropicClient.templateVars[k] = v
+	}
+
 	// Try to load model if specified
-	if flags.modelConfig != "" {
-		if err := anthropicClient.loadModel(flags.modelConfig); err != nil {
+	if cfg.Model != "" {
+		if err := anthropicClient.loadModel(cfg.Model); err != nil {
+			if flags.once {
+				log.Fatalf("Failed to load model config: %v", err)
+			}
 			log.Printf("Failed to load model config: %v", err)
+		} else if flags.once {
+			anthropicClient.history = NewConversationHistory(anthropicClient.model.System)
 		} else {
 			fmt.Printf("\nLoaded model configuration: %s", anthropicClient.model.Name)
 			if anthropicClient.model.System != "" {
@@ -977,25 +1050,55 @@ func main() {
 				anthropicClient.history = NewConversationHistory(anthropicClient.model.System)
 			}
 		}
-	} else {
+	} else if !flags.once {
 		fmt.Println("\nNo model definition loaded, using default model")
 	}
 
+	// Validate authentication early; the model profile may name the credential
+	if err := anthropicClient.initializeAuthentication(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Trace each prompt; MCP servers continue the trace in their own spans
+	flushTracing, err := setupTracing(cfg.Telemetry)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer flushTracing()
+
+	// Connect to MCP servers so the model can call their tools. Stdio
+	// servers are child processes and exit when we close their stdin.
+	anthropicClient.oneShot = flags.once
+	anthropicClient.toolPolicy, err = newToolPolicy(cfg.ToolPolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	anthropicClient.toolCalls = cfg.ToolCalls
+	anthropicClient.connectMCP(cfg.MCPServers)
+	defer anthropicClient.closeMCP()
+
+	// In one-shot mode, answer a single prompt and exit
+	if flags.once {
+		if err := anthropicClient.runOnce(flags.prompt); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Read prompt content if specified
-	var promptContent []byte
+	var promptContent string
 	if flags.prompt != "" {
 		var err error
-		promptContent, err = os.ReadFile(flags.prompt)
+		promptContent, err = anthropicClient.renderPromptFile(flags.prompt)
 		if err != nil {
-			log.Fatalf("Failed to read prompt file: %v", err)
+			log.Fatalf("Failed to load prompt file: %v", err)
 		}
-		fmt.Printf("\nPrompt from %s:\n%s\n", flags.prompt, string(promptContent))
+		fmt.Printf("\nPrompt from %s:\n%s\n", flags.prompt, promptContent)
 	}
 
 	// Handle initial prompt if specified
 	if flags.prompt != "" {
-		promptStr := string(promptContent)
-		anthropicClient.history.AddUserMessage(promptStr)
+		anthropicClient.history.AddUserMessage(promptContent)
 
 		// Prepare chat request with history
 		req := &ChatRequest{
@@ -1004,37 +1107,49 @@ func main() {
 		}
 
 		fmt.Printf("\nReading prompt from: %s\n", flags.prompt)
-		if err := anthropicClient.Chat(context.Background(), req); err != nil {
+		ctx, stop := turnContext()
+		if err := anthropicClient.Chat(ctx, req); err != nil {
 			log.Printf("Error processing initial prompt: %v", err)
 		}
+		stop()
 		fmt.Println()
 	}
 
 	// Set up command history
-	historyFile := filepath.Join(os.TempDir(), ".gchai_history")
+	anthropicClient.commands = newCommandRegistry(builtinCommands())
+	anthropicClient.loadMacros()
+	anthropicClient.loadPlugins(defaultPluginDirs())
+
+	history, err := newCommandHistory(cfg.History)
+	if err != nil {
+		log.Fatal(err)
+	}
 	rl, err := readline.NewEx(&readline.Config{
-		Prompt:            "> ",
-		HistoryFile:       historyFile,
-		HistoryLimit:      64,
-		InterruptPrompt:   "^C",
-		EOFPrompt:         "exit",
-		HistorySearchFold: true, // Case-insensitive history search
+		Prompt:                 cfg.UI.Prompt,
+		HistoryFile:            history.file,
+		HistoryLimit:           cfg.History.Limit,
+		DisableAutoSaveHistory: true, // Lines are saved by readInput, without secrets
+		InterruptPrompt:        "^C",
+		EOFPrompt:              "exit",
+		HistorySearchFold:      true, // Case-insensitive history search
+		AutoComplete:           replCompleter{anthropicClient},
 	})
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer rl.Close()
-
-	fmt.Println("Setting up connection to MCP server...")
-	setupMCP()
+	if err := history.restrict(); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  %v\n", err)
+	}
+	anthropicClient.rl = rl
+	anthropicClient.inputHistory = history
 
 	// Interactive prompt loop
 	fmt.Println("Interactive AI Assistant")
-	showCommands()
-	fmt.Println() // Single blank line before starting input
+	anthropicClient.showCommands()
 
 	for {
-		question, err := rl.Readline()
+		question, err := readInput(rl, history)
 		if err != nil {
 			if err == readline.ErrInterrupt {
 				continue // Allow Ctrl-C to cancel current input
@@ -1051,81 +1166,22 @@ func main() {
 			continue
 		}
 
-		if question == "exit" {
+		// Commands are run here; those that produce a prompt, such as
+		// /edit-prompt and plugins, have it sent like a typed question
+		prompt, isCommand, err := anthropicClient.runCommand(question)
+		if errors.Is(err, errExit) {
 			fmt.Println("Goodbye!")
 			break
 		}
-
-		// Handle help command
-		if question == "/help" {
-			showCommands()
-			continue
-		}
-
-		// Handle file loading command
-		if strings.HasPrefix(question, "/load ") {
-			filePath := strings.TrimSpace(strings.TrimPrefix(question, "/load "))
-			if err := anthropicClient.loadFile(filePath); err != nil {
-				fmt.Printf("Error loading file: %v\n", err)
-			} else {
-				fmt.Printf("Loaded file: %s\n", filepath.Base(filePath))
-			}
-			continue
-		}
-
-		// Handle model loading command
-		if strings.HasPrefix(question, "/model ") {
-			filePath := strings.TrimSpace(strings.TrimPrefix(question, "/model "))
-			if err := anthropicClient.loadModel(filePath); err != nil {
-				fmt.Printf("Error loading model: %v\n", err)
-			} else {
-				fmt.Printf("Loaded and created model: %s\n", anthropicClient.model.Name)
-				// Update system prompt in history if present
-				if anthropicClient.model.System != "" {
-					anthropicClient.history = NewConversationHistory(anthropicClient.model.System)
-					fmt.Printf("System prompt: %s\n", anthropicClient.model.System)
-				}
-			}
-			continue
-		}
-
-		// Clear history command
-		if question == "/clear" {
-			systemPrompt := ""
-			if anthropicClient.model != nil {
-				systemPrompt = anthropicClient.model.System
-			}
-			anthropicClient.history = NewConversationHistory(systemPrompt)
-			fmt.Println("Conversation history cleared.")
-			continue
-		}
-
-		// Show history command
-		if question == "/history" {
-			fmt.Println("\nConversation History:")
-			caser := cases.Title(language.English)
-			for _, msg := range anthropicClient.history.Messages {
-				role := caser.String(msg.Role)
-				fmt.Printf("%s: %s\n", role, msg.Content)
-			}
-			fmt.Printf("\nEstimated tokens: %d\n", anthropicClient.history.EstimateTokenCount())
-			continue
-		}
-
-		// Show status command
-		if question == "/status" {
-			anthropicClient.showStatus()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
 			continue
 		}
-
-		// Handle dump command
-		if question == "/dump" {
-			if err := anthropicClient.dumpContextToFile("context-dump.txt"); err != nil {
-				fmt.Printf("Error: %v\n", err)
-			} else {
-				fmt.Println("Context dumped to context-dump.txt")
+		if isCommand {
+			if prompt == "" {
+				continue
 			}
-			continue
+			question = prompt
 		}
 
 		// Prepare messages array: context (if any) followed by conversation history
@@ -1158,17 +1214,69 @@ func main() {
 		}
 
 		fmt.Println()
-		if err := anthropicClient.Chat(context.Background(), req); err != nil {
+		ctx, stop := turnContext()
+		err = anthropicClient.Chat(ctx, req)
+		interrupted := ctx.Err() != nil
+		stop()
+		if err != nil {
 			if err.Error() == "submission cancelled by user" {
 				fmt.Println("Request cancelled. Type your next prompt or command.")
 				continue
 			}
+			if interrupted {
+				fmt.Println("\nRequest interrupted. Type your next prompt or command.")
+				continue
+			}
 			log.Printf("Error: %v", err)
 		}
 		fmt.Println()
 	}
 }
 
+// turnContext returns the context for one turn. Ctrl-C cancels it, which
+// stops the request and any tool calls still running instead of quitting;
+// stop restores the usual Ctrl-C handling.
+func turnContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// runOnce sends a single prompt, read from promptFile or stdin when no file
+// is given, and prints only the response
+func (c *AnthropicClient) runOnce(promptFile string) error {
+	var prompt string
+	if promptFile != "" && promptFile != "-" {
+		var err error
+		if prompt, err = c.renderPromptFile(promptFile); err != nil {
+			return err
+		}
+	} else {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read prompt: %v", err)
+		}
+		prompt = string(input)
+	}
+	if strings.TrimSpace(prompt) == "" {
+		return fmt.Errorf("prompt is empty")
+	}
+
+	c.oneShot = true
+	c.history.AddUserMessage(prompt)
+	req := &ChatRequest{
+		Messages: c.history.Messages,
+		Stream:   true,
+	}
+	ctx, stop := turnContext()
+	defer stop()
+	if err := c.Chat(ctx, req); err != nil {
+		return err
+	}
+	if c.model == nil || c.model.Format != "json" {
+		fmt.Println()
+	}
+	return nil
+}
+
 // ConversationHistory tracks the conversation between user and assistant
 type ConversationHistory struct {
 	Messages []Message
@@ -1251,8 +1359,16 @@ func (c *AnthropicClient) showStatus() {
 	// Model information
 	if c.model != nil {
 		fmt.Printf("Model: %s\n", c.model.Name)
+		fmt.Printf("Profile: %s\n", strings.Join(c.model.chain, " <- "))
+		fmt.Printf("Response Format: %s\n", c.model.describeFormat())
 		if c.model.System != "" {
 			fmt.Printf("System Prompt: %s\n", c.model.System)
+			if c.model.systemTemplate != "" && c.model.systemTemplate != c.model.System {
+				fmt.Printf("System Template: %s\n", c.model.systemTemplate)
+			}
+		}
+		if len(c.templateVars) > 0 {
+			fmt.Printf("Template Variables: %s\n", c.templateVars)
 		}
 
 		// Show model parameters if any are set
@@ -1267,25 +1383,52 @@ func (c *AnthropicClient) showStatus() {
 			}
 		}
 
-		// Show model options if any are set
-		optValue := reflect.ValueOf(c.model.Options)
-		optType := reflect.TypeOf(c.model.Options)
-		hasOptions := false
-		for i := 0; i < optType.NumField(); i++ {
-			if !optValue.Field(i).IsZero() {
-				if !hasOptions {
-					fmt.Println("\nOptions:")
-					hasOptions = true
-				}
-				field := optType.Field(i)
-				value := optValue.Field(i)
-				fmt.Printf("  %s: %v\n", field.Name, value.Interface())
-			}
-		}
 	} else {
 		fmt.Printf("Model: %s (default)\n", c.defaultModel)
 	}
 
+	// Configuration sources
+	if c.config != nil {
+		fmt.Printf("\nProvider: %s (%s)\n", c.provider, c.baseURL)
+		if c.provider == "direct" {
+			fmt.Printf("API Key Source: %s\n", c.describeCredential())
+		}
+		settings := c.httpSettings()
+		fmt.Printf("Endpoint: %s\n", c.messagesURL())
+		fmt.Printf("API Version: %s\n", c.apiVersion())
+		if betas := c.activeBetas(); len(betas) > 0 {
+			fmt.Printf("Betas: %s\n", strings.Join(betas, ", "))
+		} else {
+			fmt.Println("Betas: none")
+		}
+		if settings.AuthStyle == "bearer" {
+			fmt.Println("Auth Header: Authorization: Bearer")
+		}
+		if len(settings.Headers) > 0 {
+			fmt.Printf("Custom Headers: %s\n", settings.describeHeaders())
+		}
+		if c.config.HTTP.Proxy != "" {
+			fmt.Printf("Proxy: %s\n", c.config.HTTP.Proxy)
+		}
+		if c.config.HTTP.CABundle != "" {
+			fmt.Printf("CA Bundle: %s\n", c.config.HTTP.CABundle)
+		}
+		if len(c.config.sources) > 0 {
+			fmt.Printf("Config Files: %s\n", strings.Join(c.config.sources, ", "))
+		} else {
+			fmt.Println("Config Files: none")
+		}
+		for _, server := range c.config.MCPServers {
+			fmt.Printf("MCP Server: %s (%s) %s\n", server.Name, server.describe(), c.mcpServerState(server.Name))
+		}
+		if c.config.LocalTools {
+			fmt.Printf("Local Tools: %s\n", c.mcpServerState(localServerName))
+		}
+		if c.toolPolicy != nil && len(c.mcpServers) > 0 {
+			fmt.Printf("Tool Policy: %s\n", c.describeToolPolicy())
+		}
+	}
+
 	// Detailed token usage
 	fmt.Println("\nToken Usage:")
 	fmt.Println("-----------")
@@ -1464,10 +1607,7 @@ func (c *AnthropicClient) dumpContextToFile(filename string) error {
 	output.WriteString(fmt.Sprintf("Total Size:      %7d tokens\n", totalTokens))
 
 	// Get context window info
-	windowSize := 4096 // Default
-	if c.model != nil && c.model.Options.NumCtx > 0 {
-		windowSize = c.model.Options.NumCtx
-	}
+	windowSize := c.getContextWindow()
 	usagePercent := float64(totalTokens) / float64(windowSize) * 100
 	output.WriteString(fmt.Sprintf("Context Window:  %7d tokens\n", windowSize))
 	output.WriteString(fmt.Sprintf("Window Usage:    %7.1f%%\n", usagePercent))
@@ -1495,20 +1635,19 @@ func (c *AnthropicClient) addAuthHeaders(req *http.Request) error {
 
 // addDirectAnthropicAuth adds authentication headers for direct Anthropic API
 func (c *AnthropicClient) addDirectAnthropicAuth(req *http.Request) error {
-	apiKey := os.Getenv("ANTHROPIC_API_KEY")
-	if apiKey == "" {
-		return fmt.Errorf("ANTHROPIC_API_KEY environment variable is required for direct API access")
-	}
-	
-	// Validate API key format
-	if !strings.HasPrefix(apiKey, "sk-ant-") {
-		return fmt.Errorf("invalid ANTHROPIC_API_KEY format (should start with 'sk-ant-')")
-	}
-	
-	req.Header.Set("x-api-key", apiKey)
-	req.Header.Set("anthropic-version", c.version)
+	apiKey, err := c.apiKey()
+	if err != nil {
+		return err
+	}
+
+	if c.httpSettings().AuthStyle == "bearer" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	} else {
+		req.Header.Set("x-api-key", apiKey)
+	}
+	c.addVersionHeaders(req)
 	req.Header.Set("Content-Type", "application/json")
-	
+
 	return nil
 }
 
@@ -1523,14 +1662,8 @@ func (c *AnthropicClient) addBedrockAuth(req *http.Request) error {
 func (c *AnthropicClient) validateAuthentication() error {
 	switch c.provider {
 	case "direct":
-		apiKey := os.Getenv("ANTHROPIC_API_KEY")
-		if apiKey == "" {
-			return fmt.Errorf("ANTHROPIC_API_KEY environment variable is required for direct API access")
-		}
-		if !strings.HasPrefix(apiKey, "sk-ant-") {
-			return fmt.Errorf("invalid ANTHROPIC_API_KEY format (should start with 'sk-ant-')")
-		}
-		return nil
+		_, err := c.apiKey()
+		return err
 	case "bedrock":
 		// Basic AWS credentials check - full implementation in Phase 3
 		if os.Getenv("AWS_ACCESS_KEY_ID") == "" && os.Getenv("AWS_PROFILE") == "" {
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/chzyer/readline"
+)
+
+// ANSI escape sequences used by the terminal renderer
+const (
+	ansiReset     = "\x1b[0m"
+	ansiBold      = "\x1b[1m"
+	ansiDim       = "\x1b[2m"
+	ansiItalic    = "\x1b[3m"
+	ansiUnderline = "\x1b[4m"
+	ansiRed       = "\x1b[31m"
+	ansiGreen     = "\x1b[32m"
+	ansiYellow    = "\x1b[33m"
+	ansiBlue      = "\x1b[34m"
+	ansiMagenta   = "\x1b[35m"
+	ansiCyan      = "\x1b[36m"
+)
+
+var (
+	headingPattern     = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	bulletPattern      = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	orderedPattern     = regexp.MustCompile(`^(\s*)(\d+[.)])\s+(.*)$`)
+	rulePattern        = regexp.MustCompile(`^(-\s*){3,}$|^(\*\s*){3,}$|^(_\s*){3,}$`)
+	tableDividerCell   = regexp.MustCompile(`^:?-{1,}:?$`)
+	fenceOpenPattern   = regexp.MustCompile("^\\s*(```+|~~~+)\\s*([^\\s`]*)")
+	numberLiteralRegex = regexp.MustCompile(`^(0[xX][0-9a-fA-F_]+|[0-9][0-9_]*(\.[0-9_]+)?([eE][+-]?[0-9]+)?)`)
+)
+
+// terminalSupportsMarkdown reports whether stdout is a terminal that should
+// receive ANSI-styled output. NO_COLOR (https://no-color.org) and TERM=dumb
+// both force plain text.
+func terminalSupportsMarkdown() bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return readline.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// markdownRenderer incrementally renders streamed markdown to a terminal.
+// Streamed text is buffered until a complete line is available, since most
+// markdown constructs can only be recognised once the line is known. Table
+// rows are held back until the table ends so columns can be aligned. When
+// styling is disabled the renderer passes text through untouched.
+type markdownRenderer struct {
+	out    io.Writer
+	styled bool
+
+	pending strings.Builder // Partial line not yet rendered
+	table   []string        // Buffered table rows
+
+	inCode         bool   // Inside a fenced code block
+	fence          string // Fence marker that opened the current block
+	codeLang       string // Language of the current code block
+	inBlockComment bool   // Inside a /* */ comment within a code block
+}
+
+func newMarkdownRenderer(out io.Writer, styled bool) *markdownRenderer {
+	return &markdownRenderer{
+		out:    out,
+		styled: styled,
+	}
+}
+
+// newResponseRenderer returns a renderer for model output, styling markdown
+// only when the model expects markdown and stdout can display it
+func (c *AnthropicClient) newResponseRenderer() *markdownRenderer {
+	format := "markdown"
+	if c.model != nil && c.model.Format != "" {
+		format = c.model.Format
+	}
+	styled := terminalSupportsMarkdown()
+	if c.markdown != nil {
+		styled = *c.markdown
+	}
+	return newMarkdownRenderer(os.Stdout, format == "markdown" && styled)
+}
+
+// Write accepts the next chunk of streamed text
+func (r *markdownRenderer) Write(text string) {
+	if !r.styled {
+		io.WriteString(r.out, text)
+		return
+	}
+
+	for {
+		i := strings.IndexByte(text, '\n')
+		if i < 0 {
+			r.pending.WriteString(text)
+			return
+		}
+		r.pending.WriteString(text[:i])
+		line := r.pending.String()
+		r.pending.Reset()
+		r.renderLine(line)
+		text = text[i+1:]
+	}
+}
+
+// Flush renders any buffered partial line and table and resets block state
+// so the renderer can be reused for the next response
+func (r *markdownRenderer) Flush() {
+	if !r.styled {
+		return
+	}
+	if r.pending.Len() > 0 {
+		line := r.pending.String()
+		r.pending.Reset()
+		r.renderLine(line)
+	}
+	r.flushTable()
+	r.inCode = false
+	r.fence = ""
+	r.codeLang = ""
+	r.inBlockComment = false
+}
+
+func (r *markdownRenderer) renderLine(line string) {
+	trimmed := strings.TrimSpace(line)
+
+	// Code blocks take precedence over everything else
+	if r.inCode {
+		if strings.HasPrefix(trimmed, r.fence) && strings.Trim(trimmed, r.fence[:1]) == "" {
+			fmt.Fprintln(r.out, ansiDim+line+ansiReset)
+			r.inCode = false
+			r.inBlockComment = false
+			return
+		}
+		fmt.Fprintln(r.out, r.highlightCode(line))
+		return
+	}
+
+	if m := fenceOpenPattern.FindStringSubmatch(line); m != nil {
+		r.flushTable()
+		r.inCode = true
+		r.fence = m[1]
+		r.codeLang = codeBlockLanguage(m[2])
+		fmt.Fprintln(r.out, ansiDim+line+ansiReset)
+		return
+	}
+
+	// Tables are buffered until a non-table line arrives
+	if strings.HasPrefix(trimmed, "|") {
+		r.table = append(r.table, trimmed)
+		return
+	}
+	r.flushTable()
+
+	switch {
+	case trimmed == "":
+		fmt.Fprintln(r.out)
+	case headingPattern.MatchString(trimmed):
+		m := headingPattern.FindStringSubmatch(trimmed)
+		style := ansiBold
+		switch len(m[1]) {
+		case 1:
+			style = ansiBold + ansiUnderline + ansiMagenta
+		case 2:
+			style = ansiBold + ansiCyan
+		case 3:
+			style = ansiBold + ansiBlue
+		}
+		fmt.Fprintln(r.out, style+strings.TrimRight(m[2], " #")+ansiReset)
+	case rulePattern.MatchString(trimmed):
+		fmt.Fprintln(r.out, ansiDim+strings.Repeat("─", 40)+ansiReset)
+	case strings.HasPrefix(trimmed, ">"):
+		quote := strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))
+		fmt.Fprintln(r.out, ansiDim+"│ "+ansiReset+ansiItalic+renderInline(quote)+ansiReset)
+	case bulletPattern.MatchString(line):
+		m := bulletPattern.FindStringSubmatch(line)
+		fmt.Fprintln(r.out, m[1]+ansiYellow+"•"+ansiReset+" "+renderInline(m[2]))
+	case orderedPattern.MatchString(line):
+		m := orderedPattern.FindStringSubmatch(line)
+		fmt.Fprintln(r.out, m[1]+ansiYellow+m[2]+ansiReset+" "+renderInline(m[3]))
+	default:
+		fmt.Fprintln(r.out, renderInline(line))
+	}
+}
+
+// flushTable renders buffered table rows with aligned columns
+func (r *markdownRenderer) flushTable() {
+	if len(r.table) == 0 {
+		return
+	}
+	rows := make([][]string, 0, len(r.table))
+	divider := -1
+	for i, line := range r.table {
+		cells := splitTableRow(line)
+		if divider < 0 && i == 1 && isTableDivider(cells) {
+			divider = i
+		}
+		rows = append(rows, cells)
+	}
+	r.table = nil
+
+	var widths []int
+	for i, cells := range rows {
+		if i == divider {
+			continue
+		}
+		for j, cell := range cells {
+			if j >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := utf8.RuneCountInString(stripInline(cell)); w > widths[j] {
+				widths[j] = w
+			}
+		}
+	}
+
+	for i, cells := range rows {
+		var b strings.Builder
+		if i == divider {
+			for j, w := range widths {
+				if j > 0 {
+					b.WriteString("─┼─")
+				}
+				b.WriteString(strings.Repeat("─", w))
+			}
+			fmt.Fprintln(r.out, ansiDim+b.String()+ansiReset)
+			continue
+		}
+		for j, w := range widths {
+			if j > 0 {
+				b.WriteString(ansiDim + " │ " + ansiReset)
+			}
+			cell := ""
+			if j < len(cells) {
+				cell = cells[j]
+			}
+			rendered := renderInline(cell)
+			if i == 0 && divider == 1 {
+				rendered = ansiBold + rendered + ansiReset
+			}
+			b.WriteString(rendered)
+			b.WriteString(strings.Repeat(" ", w-utf8.RuneCountInString(stripInline(cell))))
+		}
+		fmt.Fprintln(r.out, strings.TrimRight(b.String(), " "))
+	}
+}
+
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+	cells := strings.Split(line, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+func isTableDivider(cells []string) bool {
+	for _, cell := range cells {
+		if !tableDividerCell.MatchString(cell) {
+			return false
+		}
+	}
+	return len(cells) > 0
+}
+
+// renderInline applies bold, italic and code-span styling within a line
+func renderInline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end >= 0 {
+				b.WriteString(ansiGreen + s[i+1:i+1+end] + ansiReset)
+				i += end + 2
+				continue
+			}
+		case strings.HasPrefix(s[i:], "**") || strings.HasPrefix(s[i:], "__"):
+			marker := s[i : i+2]
+			if end := strings.Index(s[i+2:], marker); end > 0 {
+				b.WriteString(ansiBold + renderInline(s[i+2:i+2+end]) + ansiReset)
+				i += end + 4
+				continue
+			}
+		case s[i] == '*' || s[i] == '_':
+			// Underscores inside words (snake_case) are not emphasis
+			if s[i] == '_' && i > 0 && isWordByte(s[i-1]) {
+				break
+			}
+			if i+1 < len(s) && s[i+1] != ' ' {
+				if end := strings.IndexByte(s[i+1:], s[i]); end > 0 {
+					closeAt := i + 1 + end
+					if s[i] == '*' || closeAt+1 >= len(s) || !isWordByte(s[closeAt+1]) {
+						b.WriteString(ansiItalic + renderInline(s[i+1:closeAt]) + ansiReset)
+						i = closeAt + 1
+						continue
+					}
+				}
+			}
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	return b.String()
+}
+
+// stripInline removes inline markers so the visible width of a cell can be measured
+func stripInline(s string) string {
+	var b strings.Builder
+	rendered := renderInline(s)
+	for i := 0; i < len(rendered); i++ {
+		if rendered[i] == '\x1b' {
+			for i < len(rendered) && rendered[i] != 'm' {
+				i++
+			}
+			continue
+		}
+		b.WriteByte(rendered[i])
+	}
+	return b.String()
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// codeBlockLanguage maps a fence info string to one of the language names
+// returned by detectFileLanguage
+func codeBlockLanguage(info string) string {
+	info = strings.ToLower(strings.TrimSpace(info))
+	switch info {
+	case "":
+		return "plaintext"
+	case "golang":
+		return "Go"
+	case "javascript", "jsx", "node":
+		return "JavaScript"
+	case "typescript", "tsx":
+		return "TypeScript"
+	case "python", "python3":
+		return "Python"
+	case "rust":
+		return "Rust"
+	case "c++", "cxx", "hpp":
+		return "C++"
+	case "h":
+		return "C"
+	case "markdown":
+		return "Markdown"
+	}
+	return detectFileLanguage("block." + info)
+}
+
+// syntaxRules describes how to highlight one language
+type syntaxRules struct {
+	keywords      map[string]bool
+	types         map[string]bool
+	lineComment   string
+	blockComments bool
+	quotes        string
+}
+
+func newSyntaxRules(keywords, types, lineComment string, blockComments bool, quotes string) *syntaxRules {
+	toSet := func(words string) map[string]bool {
+		set := make(map[string]bool)
+		for _, w := range strings.Fields(words) {
+			set[w] = true
+		}
+		return set
+	}
+	return &syntaxRules{
+		keywords:      toSet(keywords),
+		types:         toSet(types),
+		lineComment:   lineComment,
+		blockComments: blockComments,
+		quotes:        quotes,
+	}
+}
+
+// syntaxTable holds highlighting rules keyed by detectFileLanguage names
+var syntaxTable = map[string]*syntaxRules{
+	"Go": newSyntaxRules(
+		"break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false iota",
+		"bool byte complex64 complex128 error float32 float64 int int8 int16 int32 int64 rune string uint uint8 uint16 uint32 uint64 uintptr any",
+		"//", true, "\"'`"),
+	"JavaScript": newSyntaxRules(
+		"async await break case catch class const continue debugger default delete do else export extends finally for function if import in instanceof let new of return super switch this throw try typeof var void while with yield null undefined true false",
+		"Array Boolean Date Error Map Number Object Promise RegExp Set String Symbol",
+		"//", true, "\"'`"),
+	"TypeScript": newSyntaxRules(
+		"abstract as async await break case catch class const continue declare default delete do else enum export extends finally for from function if implements import in instanceof interface keyof let namespace new of private protected public readonly return super switch this throw try type typeof var void while yield null undefined true false",
+		"any boolean never number object string symbol unknown void Array Map Promise Record Set",
+		"//", true, "\"'`"),
+	"Python": newSyntaxRules(
+		"and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield None True False self",
+		"bool bytes dict float frozenset int list object set str tuple",
+		"#", false, "\"'"),
+	"Java": newSyntaxRules(
+		"abstract assert break case catch class const continue default do else enum extends final finally for goto if implements import instanceof interface native new package private protected public return static strictfp super switch synchronized this throw throws transient try volatile while null true false var record",
+		"boolean byte char double float int long short void String Object Integer List Map",
+		"//", true, "\"'"),
+	"C": newSyntaxRules(
+		"auto break case const continue default do else enum extern for goto if inline register restrict return sizeof static struct switch typedef union volatile while NULL #include #define #ifdef #ifndef #endif #if #else",
+		"char double float int long short signed unsigned void size_t bool",
+		"//", true, "\"'"),
+	"C++": newSyntaxRules(
+		"auto break case catch class const constexpr continue default delete do else enum explicit extern for friend goto if inline namespace new noexcept nullptr operator private protected public return sizeof static struct switch template this throw try typedef typename union using virtual volatile while true false #include #define #ifdef #ifndef #endif #if #else",
+		"bool char double float int long short signed unsigned void size_t string vector map",
+		"//", true, "\"'"),
+	"Rust": newSyntaxRules(
+		"as async await break const continue crate dyn else enum extern fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait type unsafe use where while true false",
+		"bool char f32 f64 i8 i16 i32 i64 i128 isize str u8 u16 u32 u64 u128 usize String Vec Option Result Box",
+		"//", true, "\""),
+}
+
+// highlightCode applies syntax highlighting to one line of the current code block
+func (r *markdownRenderer) highlightCode(line string) string {
+	rules := syntaxTable[r.codeLang]
+	if rules == nil {
+		return line
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		rest := line[i:]
+
+		if r.inBlockComment {
+			end := strings.Index(rest, "*/")
+			if end < 0 {
+				b.WriteString(ansiDim + rest + ansiReset)
+				return b.String()
+			}
+			b.WriteString(ansiDim + rest[:end+2] + ansiReset)
+			r.inBlockComment = false
+			i += end + 2
+			continue
+		}
+
+		switch {
+		case rules.lineComment != "" && strings.HasPrefix(rest, rules.lineComment):
+			b.WriteString(ansiDim + rest + ansiReset)
+			return b.String()
+		case rules.blockComments && strings.HasPrefix(rest, "/*"):
+			r.inBlockComment = true
+			b.WriteString(ansiDim + "/*" + ansiReset)
+			i += 2
+			continue
+		case strings.IndexByte(rules.quotes, rest[0]) >= 0:
+			end := closingQuote(rest)
+			b.WriteString(ansiGreen + rest[:end] + ansiReset)
+			i += end
+			continue
+		case isWordByte(rest[0]) || rest[0] == '#':
+			j := 1
+			for j < len(rest) && isWordByte(rest[j]) {
+				j++
+			}
+			word := rest[:j]
+			switch {
+			case rules.keywords[word]:
+				b.WriteString(ansiMagenta + word + ansiReset)
+			case rules.types[word]:
+				b.WriteString(ansiCyan + word + ansiReset)
+			case unicode.IsDigit(rune(word[0])):
+				if m := numberLiteralRegex.FindString(rest); len(m) > len(word) {
+					word = m
+					j = len(m)
+				}
+				b.WriteString(ansiYellow + word + ansiReset)
+			default:
+				b.WriteString(word)
+			}
+			i += j
+			continue
+		}
+		b.WriteByte(line[i])
+		i++
+	}
+	return b.String()
+}
+
+// closingQuote returns the length of the quoted literal at the start of s,
+// honouring backslash escapes. Unterminated literals run to end of line.
+func closingQuote(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		if s[i] == '\\' && quote != '`' {
+			i++
+			continue
+		}
+		if s[i] == quote {
+			return i + 1
+		}
+	}
+	return len(s)
+}
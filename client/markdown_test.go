@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownRenderer(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{
+			name:   "headings",
+			chunks: []string{"# Title\n## Section ##\n### Sub\n#### Minor\n"},
+			want: ansiBold + ansiUnderline + ansiMagenta + "Title" + ansiReset + "\n" +
+				ansiBold + ansiCyan + "Section" + ansiReset + "\n" +
+				ansiBold + ansiBlue + "Sub" + ansiReset + "\n" +
+				ansiBold + "Minor" + ansiReset + "\n",
+		},
+		{
+			name:   "emphasis",
+			chunks: []string{"**bold** *it* _it_ `code` snake_case_name\n"},
+			want: ansiBold + "bold" + ansiReset + " " + ansiItalic + "it" + ansiReset + " " +
+				ansiItalic + "it" + ansiReset + " " + ansiGreen + "code" + ansiReset + " snake_case_name\n",
+		},
+		{
+			name:   "lists, quotes and rules",
+			chunks: []string{"- a\n  * b\n1. c\n> q\n---\n\n"},
+			want: ansiYellow + "•" + ansiReset + " a\n" +
+				"  " + ansiYellow + "•" + ansiReset + " b\n" +
+				ansiYellow + "1." + ansiReset + " c\n" +
+				ansiDim + "│ " + ansiReset + ansiItalic + "q" + ansiReset + "\n" +
+				ansiDim + strings.Repeat("─", 40) + ansiReset + "\n\n",
+		},
+		{
+			name:   "code fence",
+			chunks: []string{"```go\nreturn \"**x**\" // done\n```\n**after**\n"},
+			want: ansiDim + "```go" + ansiReset + "\n" +
+				ansiMagenta + "return" + ansiReset + " " + ansiGreen + "\"**x**\"" + ansiReset + " " + ansiDim + "// done" + ansiReset + "\n" +
+				ansiDim + "```" + ansiReset + "\n" +
+				ansiBold + "after" + ansiReset + "\n",
+		},
+		{
+			name:   "unknown language is left alone",
+			chunks: []string{"~~~\n# not a heading\n```\n~~~\n"},
+			want:   ansiDim + "~~~" + ansiReset + "\n# not a heading\n```\n" + ansiDim + "~~~" + ansiReset + "\n",
+		},
+		{
+			name:   "table",
+			chunks: []string{"| a | bb |\n|---|:-:|\n| ccc | `d` |\ntext\n"},
+			want: ansiBold + "a" + ansiReset + "  " + ansiDim + " │ " + ansiReset + ansiBold + "bb" + ansiReset + "\n" +
+				ansiDim + "───" + "─┼─" + "──" + ansiReset + "\n" +
+				"ccc" + ansiDim + " │ " + ansiReset + ansiGreen + "d" + ansiReset + "\n" +
+				"text\n",
+		},
+		{
+			name:   "chunks split lines and markers",
+			chunks: []string{"# Ti", "tle\n**bo", "ld** te", "xt\n"},
+			want:   ansiBold + ansiUnderline + ansiMagenta + "Title" + ansiReset + "\n" + ansiBold + "bold" + ansiReset + " text\n",
+		},
+		{
+			name:   "chunk split inside a fence",
+			chunks: []string{"``", "`\nx\n`", "``\n"},
+			want:   ansiDim + "```" + ansiReset + "\nx\n" + ansiDim + "```" + ansiReset + "\n",
+		},
+		{
+			name:   "flush renders a partial line",
+			chunks: []string{"some *te", "xt*"},
+			want:   "some " + ansiItalic + "text" + ansiReset + "\n",
+		},
+		{
+			name:   "flush renders a table with no line after it",
+			chunks: []string{"| a | b |\n| c | d |"},
+			want:   "a" + ansiDim + " │ " + ansiReset + "b\nc" + ansiDim + " │ " + ansiReset + "d\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			r := newMarkdownRenderer(&out, true)
+			for _, chunk := range tt.chunks {
+				r.Write(chunk)
+			}
+			r.Flush()
+			if got := out.String(); got != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkdownRendererFlushResets(t *testing.T) {
+	var out bytes.Buffer
+	r := newMarkdownRenderer(&out, true)
+	r.Write("```go\n/* open")
+	r.Flush()
+	out.Reset()
+
+	r.Write("# Next\n")
+	if got, want := out.String(), ansiBold+ansiUnderline+ansiMagenta+"Next"+ansiReset+"\n"; got != want {
+		t.Errorf("got %q, want %q after Flush", got, want)
+	}
+}
+
+func TestMarkdownRendererUnstyled(t *testing.T) {
+	var out bytes.Buffer
+	r := newMarkdownRenderer(&out, false)
+	text := "# Title\n| a |\n**partial"
+	for _, chunk := range []string{text[:3], text[3:]} {
+		r.Write(chunk)
+	}
+	r.Flush()
+	if got := out.String(); got != text {
+		t.Errorf("got %q, want the text unchanged", got)
+	}
+}
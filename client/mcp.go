@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	mcp_golang "github.com/metoro-io/mcp-golang"
+	"github.com/metoro-io/mcp-golang/transport"
+	mcphttp "github.com/metoro-io/mcp-golang/transport/http"
+	"github.com/metoro-io/mcp-golang/transport/stdio"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// mcpConnectTimeout bounds starting a server and listing its tools
+const mcpConnectTimeout = 30 * time.Second
+
+// maxToolRounds bounds how many times the model may call tools for one prompt
+const maxToolRounds = 20
+
+// AnthropicTool describes a tool offered to the model
+type AnthropicTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+}
+
+// mcpServer is a connection to one MCP server
+type mcpServer struct {
+	config MCPServerConfig
+	client *mcp_golang.Client
+	cmd    *exec.Cmd      // Child process, for stdio servers
+	stdin  io.WriteCloser // Closing it asks a stdio or in-process server to exit
+	tools  []mcp_golang.ToolRetType
+
+	toolsChanged atomic.Bool // Set when the server says its tool list changed
+
+	resources []*mcp_golang.ResourceSchema
+	prompts   []*mcp_golang.PromptSchema
+}
+
+// connectMCP connects to the configured MCP servers and lists their tools.
+// A server that can't be reached is reported and left out.
+func (c *AnthropicClient) connectMCP(servers []MCPServerConfig) {
+	for _, config := range servers {
+		server, err := startMCPServer(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  MCP server %s: %v\n", config.Name, err)
+			continue
+		}
+		c.mcpServers = append(c.mcpServers, server)
+		if !c.oneShot {
+			fmt.Printf("Connected to MCP server %s (%d tools, %d resources, %d prompts)\n", config.Name, len(server.tools), len(server.resources), len(server.prompts))
+		}
+	}
+
+	// The client's own tools come last, so a configured server's tool of
+	// the same name takes precedence
+	if c.config.LocalTools {
+		server, err := c.startLocalServer()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Local tools: %v\n", err)
+		} else {
+			c.mcpServers = append(c.mcpServers, server)
+		}
+	}
+	c.warnToolClashes()
+}
+
+// describe returns where a server runs, for status output
+func (config MCPServerConfig) describe() string {
+	if config.Command != "" {
+		return strings.Join(append([]string{config.Command}, config.Args...), " ")
+	}
+	return config.URL
+}
+
+// mcpServerState reports whether a configured server is connected
+func (c *AnthropicClient) mcpServerState(name string) string {
+	for _, server := range c.mcpServers {
+		if server.config.Name == name {
+			return fmt.Sprintf("connected, %d tools, %d resources, %d prompts", len(server.tools), len(server.resources), len(server.prompts))
+		}
+	}
+	return "not connected"
+}
+
+// closeMCP disconnects from all MCP servers
+func (c *AnthropicClient) closeMCP() {
+	for _, server := range c.mcpServers {
+		server.close()
+	}
+	c.mcpServers = nil
+}
+
+// startMCPServer connects to a server over HTTP, or runs it as a child
+// process and talks to it over stdin and stdout
+func startMCPServer(config MCPServerConfig) (*mcpServer, error) {
+	server := &mcpServer{config: config}
+
+	var t transport.Transport
+	if config.Command != "" {
+		cmd := exec.Command(config.Command, config.Args...)
+		cmd.Env = os.Environ()
+		for name, value := range config.Env {
+			cmd.Env = append(cmd.Env, name+"="+os.ExpandEnv(value))
+		}
+		// The server logs to stderr; show them alongside ours
+		cmd.Stderr = os.Stderr
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start %s: %v", config.Command, err)
+		}
+		server.cmd = cmd
+		server.stdin = stdin
+		t = stdio.NewStdioServerTransportWithIO(stdout, stdin)
+	} else {
+		u, err := url.Parse(config.URL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid url %q", config.URL)
+		}
+		endpoint := u.RequestURI()
+		u.Path, u.RawPath, u.RawQuery = "", "", ""
+		httpClient, err := newMCPHTTPClient(config)
+		if err != nil {
+			return nil, err
+		}
+		ht := mcphttp.NewHTTPClientTransport(endpoint).WithBaseURL(u.String()).WithClient(httpClient)
+		if config.Token != "" {
+			ht.WithHeader("Authorization", "Bearer "+os.ExpandEnv(config.Token))
+		}
+		t = ht
+	}
+	return server.connect(t)
+}
+
+// connect initializes the MCP session over t and lists what the server
+// offers
+func (s *mcpServer) connect(t transport.Transport) (*mcpServer, error) {
+	s.client = mcp_golang.NewClientWithInfo(traceTransport{notifyTransport{t, s}}, mcp_golang.ClientInfo{Name: "gchai", Version: "1.0"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), mcpConnectTimeout)
+	defer cancel()
+	if _, err := s.client.Initialize(ctx); err != nil {
+		s.close()
+		return nil, err
+	}
+	if err := s.listTools(ctx); err != nil {
+		s.close()
+		return nil, err
+	}
+	s.listExtras(ctx)
+	return s, nil
+}
+
+// newMCPHTTPClient returns an HTTP client that trusts the server's CA and
+// presents a client certificate when configured to
+func newMCPHTTPClient(config MCPServerConfig) (*http.Client, error) {
+	client, err := newHTTPClient(HTTPConfig{CABundle: config.CABundle})
+	if err != nil {
+		return nil, err
+	}
+	if config.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(config.ClientCert, config.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		transport := client.Transport.(*http.Transport)
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+	return client, nil
+}
+
+// listTools fetches every page of the server's tool list, keeping the
+// tools its config lets the model use
+func (s *mcpServer) listTools(ctx context.Context) error {
+	s.tools = nil
+	names := make(map[string]string)
+	var cursor *string
+	for {
+		resp, err := s.client.ListTools(ctx, cursor)
+		if err != nil {
+			return err
+		}
+		for _, tool := range resp.Tools {
+			if s.offers(tool.Name) {
+				s.addTool(tool, names)
+			}
+		}
+		if resp.NextCursor == nil || *resp.NextCursor == "" {
+			return nil
+		}
+		cursor = resp.NextCursor
+	}
+}
+
+// close stops a child process server, giving it a moment to exit after its
+// stdin is closed
+func (s *mcpServer) close() {
+	if s.cmd == nil {
+		// An in-process server stops reading when its pipe is closed
+		if s.stdin != nil {
+			s.stdin.Close()
+		}
+		return
+	}
+	s.stdin.Close()
+	exited := make(chan struct{})
+	go func() {
+		s.cmd.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		s.cmd.Process.Kill()
+		<-exited
+	}
+	s.cmd = nil
+}
+
+// mcpTools returns the tools of all connected servers in the form the
+// Messages API expects, named as toolName describes. Tool lists that
+// servers said have changed are fetched again first. When two servers'
+// tools have the same name, the first server's is used, as
+// warnToolClashes reported when they were listed.
+func (c *AnthropicClient) mcpTools() []AnthropicTool {
+	c.refreshTools()
+	var tools []AnthropicTool
+	seen := make(map[string]bool)
+	for _, server := range c.mcpServers {
+		for _, tool := range server.tools {
+			name := server.toolName(tool.Name)
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			schema := tool.InputSchema
+			if schema == nil {
+				schema = map[string]any{"type": "object"}
+			}
+			tools = append(tools, AnthropicTool{Name: name, Description: toolDescription(tool), InputSchema: schema})
+		}
+	}
+	return tools
+}
+
+// findMCPTool returns the server that provides the tool the model knows as
+// name, and the tool's name on that server
+func (c *AnthropicClient) findMCPTool(name string) (*mcpServer, string) {
+	for _, server := range c.mcpServers {
+		for _, tool := range server.tools {
+			if server.toolName(tool.Name) == name {
+				return server, tool.Name
+			}
+		}
+	}
+	return nil, ""
+}
+
+// callTool runs a prepared tool call and returns the matching tool_result
+// block. Failures are reported to the model as error results rather than
+// ending the conversation.
+func (c *AnthropicClient) callTool(ctx context.Context, call *toolCall) (result AnthropicContent) {
+	use := call.use
+	result = AnthropicContent{Type: "tool_result", ToolUseID: use.ID}
+	ctx, span := tracer.Start(ctx, "execute_tool "+use.Name, trace.WithAttributes(
+		attribute.String("gen_ai.tool.name", use.Name),
+		attribute.String("gen_ai.tool.call.id", use.ID),
+	))
+	defer func() {
+		if result.IsError {
+			span.SetStatus(codes.Error, result.Content)
+		}
+		span.End()
+	}()
+
+	if call.err != nil {
+		result.Content = call.err.Error()
+		result.IsError = true
+		return result
+	}
+	if err := ctx.Err(); err != nil {
+		result.Content = fmt.Sprintf("tool %s was cancelled", use.Name)
+		result.IsError = true
+		return result
+	}
+
+	timeout := c.toolCalls.timeout(use.Name, call.tool)
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	resp, err := call.server.client.CallTool(callCtx, call.tool, call.args)
+	if err != nil {
+		switch {
+		case ctx.Err() != nil:
+			result.Content = fmt.Sprintf("tool %s was cancelled", use.Name)
+		case callCtx.Err() != nil:
+			result.Content = fmt.Sprintf("tool %s timed out after %v", use.Name, timeout)
+		default:
+			result.Content = err.Error()
+		}
+		result.IsError = true
+		fmt.Fprintf(os.Stderr, "   %s failed: %s\n", use.Name, result.Content)
+		return result
+	}
+	result.Content = toolResponseText(resp)
+	return result
+}
+
+// toolResponseText flattens an MCP tool response into text for the model
+func toolResponseText(resp *mcp_golang.ToolResponse) string {
+	var parts []string
+	for _, content := range resp.Content {
+		switch {
+		case content.TextContent != nil:
+			parts = append(parts, content.TextContent.Text)
+		case content.ImageContent != nil:
+			parts = append(parts, fmt.Sprintf("[%s image]", content.ImageContent.MimeType))
+		case content.EmbeddedResource != nil && content.EmbeddedResource.TextResourceContents != nil:
+			parts = append(parts, content.EmbeddedResource.TextResourceContents.Text)
+		case content.EmbeddedResource != nil:
+			parts = append(parts, "[binary resource]")
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// truncate shortens s to at most n bytes for display
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// chatWithTools sends a request and, for as long as the model asks for
+// tools, runs them and sends back their results. It returns the text of
+// all the model's responses.
+func (c *AnthropicClient) chatWithTools(ctx context.Context, req *AnthropicRequest, renderer *markdownRenderer, metrics *PerfMetrics) (string, error) {
+	ctx, span := tracer.Start(ctx, "invoke_agent gchai")
+	defer span.End()
+
+	var text strings.Builder
+	for round := 0; ; round++ {
+		roundCtx, roundSpan := tracer.Start(ctx, "chat "+req.Model, trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("gen_ai.request.model", req.Model)))
+		response, err := c.sendMessage(roundCtx, req, renderer, metrics)
+		if err != nil {
+			roundSpan.SetStatus(codes.Error, err.Error())
+			roundSpan.End()
+			span.SetStatus(codes.Error, err.Error())
+			return "", err
+		}
+		roundSpan.SetAttributes(attribute.StringSlice("gen_ai.response.finish_reasons", []string{response.StopReason}))
+		roundSpan.End()
+		text.WriteString(convertAnthropicToDisplayFormat(response.Content))
+		if response.StopReason != "tool_use" {
+			return text.String(), nil
+		}
+		if round == maxToolRounds {
+			fmt.Fprintf(os.Stderr, "⚠️  Stopped after %d rounds of tool calls\n", maxToolRounds)
+			return text.String(), nil
+		}
+
+		// Separate this round's text from the tool calls and the next round
+		if text.Len() > 0 {
+			text.WriteString("\n\n")
+			renderer.Write("\n\n")
+			renderer.Flush()
+		}
+
+		// Empty text blocks are rejected when sent back
+		var assistant, uses []AnthropicContent
+		for _, block := range response.Content {
+			switch {
+			case block.Type == "tool_use":
+				assistant = append(assistant, block)
+				uses = append(uses, block)
+			case block.Type != "text" || block.Text != "":
+				assistant = append(assistant, block)
+			}
+		}
+		req.Messages = append(req.Messages,
+			AnthropicMessage{Role: "assistant", Content: assistant},
+			AnthropicMessage{Role: "user", Content: c.runTools(ctx, uses)},
+		)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Plugin files whose content is a prompt template rather than a program
+var templateExtensions = map[string]bool{".md": true, ".txt": true, ".tmpl": true}
+
+// pluginHelpMarker introduces a plugin's help text. Executables give it in
+// a comment near the top, e.g. "# gchai-help: Review the staged changes".
+const pluginHelpMarker = "gchai-help:"
+
+// Names plugin commands may have, after the slash
+var validCommandName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Template help is a comment at the start: {{/* Review the staged changes */}}
+var templateHelp = regexp.MustCompile(`^\s*{{-?\s*/\*\s*(.*?)\s*\*/\s*-?}}`)
+
+// pluginDir is a directory plugin commands are loaded from
+type pluginDir struct {
+	path    string
+	project bool // Comes with the repository, so its programs need the user's approval
+}
+
+// defaultPluginDirs returns the directories plugin commands are loaded
+// from: the user's config dir first, so a project can't replace the user's
+// plugins, then the project's .gchai/plugins
+func defaultPluginDirs() []pluginDir {
+	var dirs []pluginDir
+	if configDir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, pluginDir{path: filepath.Join(configDir, "gchai", "plugins")})
+	}
+	if projectDir := findProjectDir(); projectDir != "" {
+		dirs = append(dirs, pluginDir{path: filepath.Join(projectDir, "plugins"), project: true})
+	}
+	return dirs
+}
+
+// loadPlugins adds a command for each plugin in the directories. A plugin
+// is named after its file without the extension, so review.sh and
+// review.md are both /review. The first directory wins when two have the
+// same plugin; plugins can't replace built-in commands.
+func (c *AnthropicClient) loadPlugins(dirs []pluginDir) {
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir.path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "⚠️  Failed to read plugin directory %s: %v\n", dir.path, err)
+			}
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			path := filepath.Join(dir.path, entry.Name())
+			cmd, err := loadPlugin(path, dir.project)
+			if err == nil {
+				if existing := c.commands.lookup(cmd.name); existing != nil && existing.group == cmd.group {
+					continue // Shadowed by a plugin in an earlier directory
+				}
+				err = c.commands.add(cmd)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "⚠️  Plugin %s skipped: %v\n", path, err)
+			}
+		}
+	}
+}
+
+// loadPlugin makes a command of a plugin file: a prompt template if it has
+// a template extension, or else a program to run. A program from the
+// project is run only once the user agrees, unless the project is trusted.
+func loadPlugin(path string, fromProject bool) (*replCommand, error) {
+	ext := filepath.Ext(path)
+	name := strings.TrimSuffix(filepath.Base(path), ext)
+	if !validCommandName.MatchString(name) {
+		return nil, fmt.Errorf("command names may only contain letters, digits, _ and -")
+	}
+	cmd := &replCommand{
+		name:   "/" + name,
+		group:  "Plugin commands",
+		source: path,
+	}
+
+	if templateExtensions[ext] {
+		cmd.args = []commandArg{{name: "args", optional: true, rest: true, complete: completeFiles}}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		cmd.help = "Send the prompt template " + filepath.Base(path)
+		if match := templateHelp.FindSubmatch(content); match != nil {
+			cmd.help = string(match[1])
+		}
+		cmd.run = func(c *AnthropicClient, args []string) (string, error) {
+			return c.runTemplatePlugin(path, args)
+		}
+		return cmd, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&0111 == 0 {
+		return nil, fmt.Errorf("not executable and not a .md, .txt or .tmpl template")
+	}
+	cmd.args = []commandArg{{name: "args", optional: true, words: true, complete: completeFiles}}
+	cmd.help = "Run " + filepath.Base(path)
+	if help := executableHelp(path); help != "" {
+		cmd.help = help
+	}
+	approved := !fromProject
+	cmd.run = func(c *AnthropicClient, args []string) (string, error) {
+		if !approved {
+			ok, err := c.approvePlugin(path)
+			if err != nil || !ok {
+				return "", err
+			}
+			approved = true
+		}
+		return c.runExecutablePlugin(path, args)
+	}
+	return cmd, nil
+}
+
+// approvePlugin asks whether a program from the project's plugins may run,
+// unless the user config trusts the project. The answer holds for the rest
+// of the session.
+func (c *AnthropicClient) approvePlugin(path string) (bool, error) {
+	project := filepath.Dir(filepath.Dir(filepath.Dir(path))) // <project>/.gchai/plugins/<file>
+	if c.config != nil && c.config.trusts(project) {
+		return true, nil
+	}
+	fmt.Printf("%s is a program that came with the project, not from your own plugins.\n", path)
+	ok, err := c.confirm("Run it?", false)
+	if err == nil && !ok {
+		fmt.Println("Not run.")
+	}
+	return ok, err
+}
+
+// executableHelp looks for the help marker in the first lines of a program
+func executableHelp(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for i := 0; i < 10 && scanner.Scan(); i++ {
+		if _, help, ok := strings.Cut(scanner.Text(), pluginHelpMarker); ok {
+			return strings.TrimSpace(help)
+		}
+	}
+	return ""
+}
+
+// runTemplatePlugin renders a prompt template plugin. Besides the usual
+// template values, {{.Args}} is the text typed after the command and
+// {{.Arg}} its words.
+func (c *AnthropicClient) runTemplatePlugin(path string, args []string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read plugin: %v", err)
+	}
+	text := strings.Join(args, "")
+	words, err := splitWords(text)
+	if err != nil {
+		return "", err
+	}
+	data := c.templateData()
+	data["Args"] = text
+	data["Arg"] = words
+	prompt, err := c.renderTemplateDepth(path, string(content), filepath.Dir(path), data, 0)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(prompt), nil
+}
+
+// runExecutablePlugin runs a program plugin with the words typed after the
+// command, as the registry split them, as its arguments. What it writes to
+// stdout is sent to the model as the prompt; stderr goes to the terminal.
+// The program is told about the session through GCHAI_ variables.
+func (c *AnthropicClient) runExecutablePlugin(path string, args []string) (string, error) {
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	var out bytes.Buffer
+	cmd.Stdout = &out
+
+	var files []string
+	for _, file := range c.context {
+		if file.Path != "" {
+			files = append(files, file.Path)
+		}
+	}
+	model := c.defaultModel
+	if c.model != nil {
+		model = c.model.Name
+	}
+	cmd.Env = append(os.Environ(),
+		"GCHAI_MODEL="+model,
+		"GCHAI_CONTEXT_FILES="+strings.Join(files, string(os.PathListSeparator)),
+	)
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("plugin %s failed: %v", filepath.Base(path), err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writePlugin writes a plugin file into dir
+func writePlugin(t *testing.T, dir, name, content string, mode os.FileMode) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPluginsOrder(t *testing.T) {
+	base := t.TempDir()
+	user := filepath.Join(base, "user")
+	project := filepath.Join(base, "project", projectConfigDirName, "plugins")
+	writePlugin(t, user, "review.md", "{{/* User review */}}user", 0o644)
+	writePlugin(t, project, "review.md", "{{/* Project review */}}project", 0o644)
+	writePlugin(t, project, "lint.md", "{{/* Project lint */}}lint", 0o644)
+	writePlugin(t, project, "help.md", "shadows a built-in command", 0o644)
+
+	c := &AnthropicClient{commands: newCommandRegistry(builtinCommands())}
+	c.loadPlugins([]pluginDir{{path: user}, {path: project, project: true}})
+
+	for name, want := range map[string]string{"/review": "User review", "/lint": "Project lint", "/help": "Show this help message, or the details of a command"} {
+		cmd := c.commands.lookup(name)
+		if cmd == nil {
+			t.Errorf("%s wasn't loaded", name)
+			continue
+		}
+		if cmd.help != want {
+			t.Errorf("%s is %q, want %q", name, cmd.help, want)
+		}
+	}
+}
+
+func TestExecutablePluginArgs(t *testing.T) {
+	dir := t.TempDir()
+	path := writePlugin(t, dir, "args.sh", "#!/bin/sh\n# gchai-help: Print the arguments\nfor arg in \"$@\"; do echo \"[$arg]\"; done\n", 0o755)
+	cmd, err := loadPlugin(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.help != "Print the arguments" {
+		t.Errorf("help = %q", cmd.help)
+	}
+
+	args, err := cmd.parseArgs(`one "two words" 'it''s' x\ y`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompt, err := cmd.run(&AnthropicClient{}, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[one]\n[two words]\n[its]\n[x y]"; prompt != want {
+		t.Errorf("prompt = %q, want %q", prompt, want)
+	}
+}
+
+func TestProjectPluginApproval(t *testing.T) {
+	projectDir := filepath.Join(t.TempDir(), "project")
+	marker := filepath.Join(projectDir, "ran")
+	path := writePlugin(t, filepath.Join(projectDir, projectConfigDirName, "plugins"), "touch.sh", "#!/bin/sh\ntouch "+marker+"\n", 0o755)
+
+	// Stdin is empty, so the question can't be answered
+	cmd, err := loadPlugin(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cmd.run(&AnthropicClient{config: defaultConfig()}, nil); err == nil || !strings.Contains(err.Error(), "failed to read user input") {
+		t.Errorf("err = %v, want the question to fail", err)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatal("the project's plugin ran without approval")
+	}
+
+	// A trusted project's programs run without asking
+	cfg := defaultConfig()
+	cfg.TrustedProjects = []string{projectDir}
+	if _, err := cmd.run(&AnthropicClient{config: cfg}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("the trusted project's plugin didn't run: %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ToolPolicyConfig decides which tool calls the model may make without
+// asking. Rules are checked in order and the first one that matches
+// decides; calls no rule matches get Default.
+type ToolPolicyConfig struct {
+	Default string     `json:"default,omitempty"` // "allow", "ask" or "deny"
+	Rules   []ToolRule `json:"rules,omitempty"`
+}
+
+// ToolRule applies an action to calls of matching tools. Patterns are globs
+// in which * doesn't match "/" and ** matches anything.
+type ToolRule struct {
+	Server string            `json:"server,omitempty"` // Server name pattern; when set, Tool only matches its tools' own names
+	Tool   string            `json:"tool"`             // Tool name pattern
+	Args   map[string]string `json:"args,omitempty"`   // Argument name to the pattern its value must match; all must match
+	Action string            `json:"action"`           // "allow", "ask" or "deny"
+}
+
+// Tool policy actions
+const (
+	toolAllow = "allow"
+	toolAsk   = "ask"
+	toolDeny  = "deny"
+)
+
+// bundledServerName is the name the README gives the server in /server.
+// Its read-only tools are only allowed by default under this name, so
+// another server's read_file isn't.
+const bundledServerName = "local"
+
+// readOnlyTools are the tools of each server that only read. They run
+// without asking unless the config's rules say otherwise.
+var readOnlyTools = map[string][]string{
+	localServerName: {"list_context", "read_context", "search_history"},
+	bundledServerName: {
+		"read_file", "list_dir", "search",
+		"time", "convert_time", "parse_time", "add_duration", "time_difference", "business_days",
+	},
+}
+
+// defaultToolPolicy asks before every tool call except known read-only ones
+func defaultToolPolicy() ToolPolicyConfig {
+	policy := ToolPolicyConfig{Default: toolAsk}
+	for _, server := range []string{localServerName, bundledServerName} {
+		for _, tool := range readOnlyTools[server] {
+			policy.Rules = append(policy.Rules, ToolRule{Server: server, Tool: tool, Action: toolAllow})
+		}
+	}
+	return policy
+}
+
+// toolPolicy is a ToolPolicyConfig with its patterns compiled
+type toolPolicy struct {
+	defaultAction string
+	rules         []toolRule
+}
+
+type toolRule struct {
+	server *regexp.Regexp // nil when the rule applies to every server
+	tool   *regexp.Regexp
+	args   map[string]*regexp.Regexp
+	action string
+}
+
+// newToolPolicy compiles a policy's patterns
+func newToolPolicy(config ToolPolicyConfig) (*toolPolicy, error) {
+	if !validToolAction(config.Default) {
+		return nil, fmt.Errorf("default must be \"allow\", \"ask\" or \"deny\"")
+	}
+	policy := &toolPolicy{defaultAction: config.Default}
+	for i, rule := range config.Rules {
+		if rule.Tool == "" {
+			return nil, fmt.Errorf("rules[%d] needs a tool", i)
+		}
+		if !validToolAction(rule.Action) {
+			return nil, fmt.Errorf("rules[%d]: action must be \"allow\", \"ask\" or \"deny\"", i)
+		}
+		compiled := toolRule{tool: globPattern(rule.Tool), action: rule.Action, args: make(map[string]*regexp.Regexp)}
+		if rule.Server != "" {
+			compiled.server = globPattern(rule.Server)
+		}
+		for name, pattern := range rule.Args {
+			compiled.args[name] = globPattern(os.ExpandEnv(pattern))
+		}
+		policy.rules = append(policy.rules, compiled)
+	}
+	return policy, nil
+}
+
+func validToolAction(action string) bool {
+	return action == toolAllow || action == toolAsk || action == toolDeny
+}
+
+// decide returns the action for a call with args of the tool the model
+// knows as name and server knows as tool
+func (p *toolPolicy) decide(name, server, tool string, args map[string]any) string {
+	for _, rule := range p.rules {
+		if rule.matches(name, server, tool, args) {
+			return rule.action
+		}
+	}
+	return p.defaultAction
+}
+
+// matches reports whether a rule applies to a call. Without a server
+// pattern the tool pattern may match either name, so "read_file" covers
+// every server's read_file and "local__*" covers all of one server's tools.
+// With one, the server's name and the tool's own name must match, whatever
+// alias the model sees.
+func (r toolRule) matches(name, server, tool string, args map[string]any) bool {
+	if r.server != nil {
+		if !r.server.MatchString(server) || !r.tool.MatchString(tool) {
+			return false
+		}
+	} else if !r.tool.MatchString(name) && !r.tool.MatchString(tool) {
+		return false
+	}
+	for name, pattern := range r.args {
+		value, ok := args[name]
+		if !ok {
+			return false
+		}
+		// Patterns such as "**" mustn't match a path like
+		// "../../etc/passwd" that leaves the directory it is relative to
+		text := argText(value)
+		if escapes(text) || !pattern.MatchString(text) {
+			return false
+		}
+	}
+	return true
+}
+
+// argText returns the text an argument pattern is matched against. Strings
+// that look like paths are cleaned, so "src/../../etc" can't pass for a path
+// under src. Other values are matched as JSON.
+func argText(value any) string {
+	s, ok := value.(string)
+	if !ok {
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+	if s == "" || strings.Contains(s, "://") {
+		return s
+	}
+	return path.Clean(s)
+}
+
+// globPattern converts a glob to an anchored regular expression. * matches
+// within one path segment, ** matches across segments and ? matches one
+// character other than "/".
+func globPattern(glob string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				expr.WriteString(".*")
+				i++
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
+
+// escapes reports whether a cleaned relative path climbs out of the
+// directory it is relative to
+func escapes(text string) bool {
+	return text == ".." || strings.HasPrefix(text, "../")
+}
+
+// authorizeTool applies the tool policy to a call, asking the user when the
+// policy says to. It returns an error explaining why a call may not run.
+func (c *AnthropicClient) authorizeTool(name, server, tool string, args map[string]any, input json.RawMessage) error {
+	switch c.toolPolicy.decide(name, server, tool, args) {
+	case toolAllow:
+		return nil
+	case toolDeny:
+		return fmt.Errorf("tool %s is denied by the client's tool policy", name)
+	}
+
+	if c.approvedTools[name] {
+		return nil
+	}
+	if c.oneShot {
+		return fmt.Errorf("tool %s needs approval, which can't be given with -once; allow it in tool_policy", name)
+	}
+	approved, err := c.approveTool(name, input)
+	if err != nil {
+		return err
+	}
+	if !approved {
+		return fmt.Errorf("the user declined to run %s", name)
+	}
+	return nil
+}
+
+// approveTool shows a tool call and asks whether it may run. Answering
+// "always" approves the tool for the rest of the session.
+func (c *AnthropicClient) approveTool(name string, input json.RawMessage) (bool, error) {
+	fmt.Printf("The model wants to call %s with:\n%s\n", name, prettyJSON(input))
+	answer, err := c.readAnswer(fmt.Sprintf("Run %s? [y/N/always]: ", name))
+	if err != nil {
+		return false, err
+	}
+	switch answer {
+	case "y", "yes":
+		return true, nil
+	case "a", "always":
+		if c.approvedTools == nil {
+			c.approvedTools = make(map[string]bool)
+		}
+		c.approvedTools[name] = true
+		fmt.Printf("%s is approved for the rest of the session\n", name)
+		return true, nil
+	}
+	return false, nil
+}
+
+// prettyJSON indents JSON for display, falling back to the raw text
+func prettyJSON(data json.RawMessage) string {
+	if len(data) == 0 {
+		return "{}"
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return string(data)
+	}
+	pretty, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return string(data)
+	}
+	return string(pretty)
+}
+
+// describeToolPolicy summarises the policy and session approvals for /status
+func (c *AnthropicClient) describeToolPolicy() string {
+	summary := fmt.Sprintf("default %s, %d rules", c.toolPolicy.defaultAction, len(c.toolPolicy.rules))
+	if len(c.approvedTools) > 0 {
+		var approved []string
+		for name := range c.approvedTools {
+			approved = append(approved, name)
+		}
+		sort.Strings(approved)
+		summary += ", approved this session: " + strings.Join(approved, ", ")
+	}
+	return summary
+}
@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestDefaultToolPolicy(t *testing.T) {
+	policy, err := newToolPolicy(defaultToolPolicy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, server, tool string
+		want               string
+	}{
+		{name: "gchai__read_context", server: localServerName, tool: "read_context", want: toolAllow},
+		{name: "gchai__load_file", server: localServerName, tool: "load_file", want: toolAsk},
+		{name: "local__read_file", server: bundledServerName, tool: "read_file", want: toolAllow},
+		{name: "cat", server: bundledServerName, tool: "read_file", want: toolAllow},
+		{name: "local__write_file", server: bundledServerName, tool: "write_file", want: toolAsk},
+		{name: "evil__read_file", server: "evil", tool: "read_file", want: toolAsk},
+		{name: "evil__search_history", server: "evil", tool: "search_history", want: toolAsk},
+		{name: "evil__local__read_file", server: "evil", tool: "local__read_file", want: toolAsk},
+		{name: "read_file", server: "evil", tool: "read_file", want: toolAsk},
+	}
+	for _, tt := range tests {
+		if got := policy.decide(tt.name, tt.server, tt.tool, nil); got != tt.want {
+			t.Errorf("%s on %s: got %s, want %s", tt.tool, tt.server, got, tt.want)
+		}
+	}
+}
+
+func TestToolRuleMatches(t *testing.T) {
+	tests := []struct {
+		name string
+		rule ToolRule
+		call [3]string // name, server, tool
+		args map[string]any
+		want bool
+	}{
+		{name: "bare tool name on any server", rule: ToolRule{Tool: "read_file"}, call: [3]string{"a__read_file", "a", "read_file"}, want: true},
+		{name: "namespaced name", rule: ToolRule{Tool: "local__*"}, call: [3]string{"local__list_dir", "local", "list_dir"}, want: true},
+		{name: "alias", rule: ToolRule{Tool: "cat"}, call: [3]string{"cat", "local", "read_file"}, want: true},
+		{name: "server pattern", rule: ToolRule{Server: "loc*", Tool: "read_file"}, call: [3]string{"cat", "local", "read_file"}, want: true},
+		{name: "other server", rule: ToolRule{Server: "local", Tool: "read_file"}, call: [3]string{"evil__read_file", "evil", "read_file"}},
+		{name: "server rule ignores the alias", rule: ToolRule{Server: "local", Tool: "cat"}, call: [3]string{"cat", "local", "read_file"}},
+		{name: "argument", rule: ToolRule{Tool: "*", Args: map[string]string{"path": "src/**"}}, call: [3]string{"t", "s", "t"}, args: map[string]any{"path": "src/a/b.go"}, want: true},
+		{name: "missing argument", rule: ToolRule{Tool: "*", Args: map[string]string{"path": "**"}}, call: [3]string{"t", "s", "t"}},
+		{name: "path climbing out", rule: ToolRule{Tool: "*", Args: map[string]string{"path": "src/**"}}, call: [3]string{"t", "s", "t"}, args: map[string]any{"path": "src/../../etc/passwd"}},
+		{name: "double star at the top", rule: ToolRule{Tool: "*", Args: map[string]string{"path": "**"}}, call: [3]string{"t", "s", "t"}, args: map[string]any{"path": "../x"}},
+		{name: "star within a segment", rule: ToolRule{Tool: "*", Args: map[string]string{"path": "*.go"}}, call: [3]string{"t", "s", "t"}, args: map[string]any{"path": "a/b.go"}},
+		{name: "non-string argument", rule: ToolRule{Tool: "*", Args: map[string]string{"n": "3"}}, call: [3]string{"t", "s", "t"}, args: map[string]any{"n": 3.0}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Action = toolAllow
+			policy, err := newToolPolicy(ToolPolicyConfig{Default: toolDeny, Rules: []ToolRule{tt.rule}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := policy.rules[0].matches(tt.call[0], tt.call[1], tt.call[2], tt.args); got != tt.want {
+				t.Errorf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// defaultProfileDirs returns the directories searched for named model
+// profiles: the project's .gchai/models first, then the user's config dir
+func defaultProfileDirs() []string {
+	var dirs []string
+	if projectDir := findProjectDir(); projectDir != "" {
+		dirs = append(dirs, filepath.Join(projectDir, "models"))
+	}
+	if configDir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(configDir, "gchai", "models"))
+	}
+	return dirs
+}
+
+// resolveModelPath turns a profile name or file path into a model file path.
+// Anything that looks like a path is used as is; bare names are looked up as
+// <name>.json in the profile directories, then relative to dir.
+func (c *AnthropicClient) resolveModelPath(name, dir string) (string, error) {
+	if isModelPath(name) {
+		path := name
+		if !filepath.IsAbs(path) && dir != "" {
+			if _, err := os.Stat(filepath.Join(dir, path)); err == nil {
+				path = filepath.Join(dir, path)
+			}
+		}
+		return path, nil
+	}
+
+	for _, profileDir := range c.profileDirs {
+		path := filepath.Join(profileDir, name+".json")
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	if dir != "" {
+		path := filepath.Join(dir, name+".json")
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("model profile %q not found in %s", name, strings.Join(c.profileDirs, ", "))
+}
+
+// loadModelJSON reads a model file and the chain of files it extends,
+// returning the merged definition as JSON along with the names of the files
+// in the chain. Objects such as parameters are merged key by key; other
+// values in a child replace those of its parent. "system_append" adds to the
+// inherited system prompt instead of replacing it.
+func (c *AnthropicClient) loadModelJSON(path string, seen []string) (map[string]interface{}, []string, error) {
+	abs, _ := filepath.Abs(path)
+	for _, prev := range seen {
+		if prev == abs {
+			return nil, nil, fmt.Errorf("model profile %s extends itself (%s)", path, strings.Join(append(seen, abs), " -> "))
+		}
+	}
+	seen = append(seen, abs)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read model file: %v", err)
+	}
+
+	var definition map[string]interface{}
+	if err := json.Unmarshal(data, &definition); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse model file %s: %v", path, err)
+	}
+	if unknown := unknownKeys(definition, reflect.TypeOf(ModelDefinition{}), ""); len(unknown) > 0 {
+		return nil, nil, fmt.Errorf("unknown keys in %s: %s", path, strings.Join(unknown, ", "))
+	}
+
+	// Schema paths are relative to the file that declares them
+	dir := filepath.Dir(path)
+	if schemaPath, ok := definition["schema"].(string); ok && !filepath.IsAbs(schemaPath) {
+		definition["schema"] = filepath.Join(dir, schemaPath)
+	}
+
+	chain := []string{profileName(path)}
+	parentName, _ := definition["extends"].(string)
+	delete(definition, "extends")
+	appendSystem, _ := definition["system_append"].(string)
+	delete(definition, "system_append")
+
+	if parentName != "" {
+		parentPath, err := c.resolveModelPath(parentName, dir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", path, err)
+		}
+		parent, parentChain, err := c.loadModelJSON(parentPath, seen)
+		if err != nil {
+			return nil, nil, err
+		}
+		definition = mergeDefinitions(parent, definition)
+		chain = append(chain, parentChain...)
+	}
+
+	if appendSystem != "" {
+		if system, _ := definition["system"].(string); system != "" {
+			appendSystem = system + "\n\n" + appendSystem
+		}
+		definition["system"] = appendSystem
+	}
+	return definition, chain, nil
+}
+
+// mergeDefinitions overlays child onto parent, merging nested objects
+func mergeDefinitions(parent, child map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(parent)+len(child))
+	for k, v := range parent {
+		merged[k] = v
+	}
+	for k, v := range child {
+		parentObj, parentIsObj := merged[k].(map[string]interface{})
+		childObj, childIsObj := v.(map[string]interface{})
+		if parentIsObj && childIsObj && k != "schema" {
+			merged[k] = mergeDefinitions(parentObj, childObj)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// unknownKeys lists keys in a decoded JSON object that don't correspond to a
+// json-tagged field of t, recursing into nested struct fields
+func unknownKeys(obj map[string]interface{}, t reflect.Type, prefix string) []string {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = field.Type
+	}
+
+	var unknown []string
+	for key, value := range obj {
+		fieldType, ok := fields[key]
+		if !ok {
+			unknown = append(unknown, prefix+key)
+			continue
+		}
+		if nested, isObj := value.(map[string]interface{}); isObj && fieldType.Kind() == reflect.Struct {
+			unknown = append(unknown, unknownKeys(nested, fieldType, prefix+key+".")...)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+func profileName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// showProfiles lists the model profiles available by name
+func (c *AnthropicClient) showProfiles() {
+	fmt.Println("\nModel Profiles:")
+	found := false
+	seen := make(map[string]bool)
+	for _, dir := range c.profileDirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		if len(matches) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s:\n", dir)
+		for _, path := range matches {
+			name := profileName(path)
+			shadowed := seen[name]
+			seen[name] = true
+			found = true
+
+			var definition struct {
+				Name        string `json:"name"`
+				Extends     string `json:"extends"`
+				Description string `json:"description"`
+			}
+			line := fmt.Sprintf("  %-16s", name)
+			data, err := os.ReadFile(path)
+			if err == nil {
+				err = json.Unmarshal(data, &definition)
+			}
+			switch {
+			case err != nil:
+				line += " (unreadable: " + err.Error() + ")"
+			default:
+				if definition.Name != "" {
+					line += " " + definition.Name
+				}
+				if definition.Extends != "" {
+					line += " (extends " + definition.Extends + ")"
+				}
+				if definition.Description != "" {
+					line += " - " + definition.Description
+				}
+			}
+			if shadowed {
+				line += " [shadowed]"
+			}
+			if c.model != nil && c.model.source == path {
+				line += " *"
+			}
+			fmt.Println(line)
+		}
+	}
+	if !found {
+		fmt.Printf("  No profiles found in %s\n", strings.Join(c.profileDirs, ", "))
+	}
+	fmt.Println()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadModelJSON(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"base.json":    `{"name": "claude-sonnet-4-5", "parameters": {"max_tokens": 1024, "temperature": 0.5}, "system": "Be brief."}`,
+		"child.json":   `{"extends": "base", "parameters": {"temperature": 0.2}, "system_append": "Use Go."}`,
+		"loop.json":    `{"extends": "loop"}`,
+		"ollama.json":  `{"name": "qwen2.5-coder:7b", "modelfile": "x", "options": {"num_ctx": 8192}, "parameters": {"num_predict": 128}}`,
+		"openai.json":  `{"name": "gpt-4o", "parameters": {"frequency_penalty": 0.1}}`,
+		"invalid.json": `{"name": "x",}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		file    string
+		check   func(t *testing.T, definition map[string]interface{})
+		wantErr string
+	}{
+		{file: "base.json"},
+		{file: "child.json", check: func(t *testing.T, definition map[string]interface{}) {
+			params := definition["parameters"].(map[string]interface{})
+			if params["max_tokens"] != 1024.0 || params["temperature"] != 0.2 {
+				t.Errorf("parameters = %v, want max_tokens from base and temperature from child", params)
+			}
+			if definition["system"] != "Be brief.\n\nUse Go." {
+				t.Errorf("system = %q", definition["system"])
+			}
+		}},
+		{file: "loop.json", wantErr: "extends itself"},
+		{file: "ollama.json", wantErr: "unknown keys in " + filepath.Join(dir, "ollama.json") + ": modelfile, options, parameters.num_predict"},
+		{file: "openai.json", wantErr: "parameters.frequency_penalty"},
+		{file: "invalid.json", wantErr: "failed to parse model file"},
+	}
+	c := &AnthropicClient{}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			definition, _, err := c.loadModelJSON(filepath.Join(dir, tt.file), nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.check != nil {
+				tt.check(t, definition)
+			}
+		})
+	}
+}
+
+// The example files for other APIs are kept to show what the strict key
+// check reports, so they must keep failing with their foreign keys named
+func TestOtherAPIExamples(t *testing.T) {
+	tests := []struct {
+		file    string
+		wantErr string
+	}{
+		{file: "gpt-4.json", wantErr: "parameters.frequency_penalty, parameters.presence_penalty"},
+		{file: "gpt-4o.json", wantErr: "parameters.frequency_penalty, parameters.presence_penalty"},
+		{file: "gpt-4o-mini.json", wantErr: "parameters.frequency_penalty, parameters.presence_penalty"},
+		{file: "qwen2.5-coder0.5b-basic.json", wantErr: "modelfile, options, parameters.num_predict, parameters.repeat_penalty, template"},
+		{file: "qwen2.5-coder7-basic.json", wantErr: "modelfile, options, parameters.num_predict, parameters.repeat_penalty, template"},
+		{file: "qwen2.5-coder32b-basic.json", wantErr: "modelfile, options, parameters.num_predict, parameters.repeat_penalty, template"},
+	}
+	c := &AnthropicClient{}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			_, _, err := c.loadModelJSON(filepath.Join("examples", "other-apis", tt.file), nil)
+			if err == nil || !strings.Contains(err.Error(), "unknown keys") || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want unknown keys %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	mcp_golang "github.com/metoro-io/mcp-golang"
+)
+
+// listResources fetches every page of the server's resource list
+func (s *mcpServer) listResources(ctx context.Context) error {
+	s.resources = nil
+	var cursor *string
+	for {
+		resp, err := s.client.ListResources(ctx, cursor)
+		if err != nil {
+			return err
+		}
+		s.resources = append(s.resources, resp.Resources...)
+		if resp.NextCursor == nil || *resp.NextCursor == "" {
+			return nil
+		}
+		cursor = resp.NextCursor
+	}
+}
+
+// listPrompts fetches every page of the server's prompt list
+func (s *mcpServer) listPrompts(ctx context.Context) error {
+	s.prompts = nil
+	var cursor *string
+	for {
+		resp, err := s.client.ListPrompts(ctx, cursor)
+		if err != nil {
+			return err
+		}
+		s.prompts = append(s.prompts, resp.Prompts...)
+		if resp.NextCursor == nil || *resp.NextCursor == "" {
+			return nil
+		}
+		cursor = resp.NextCursor
+	}
+}
+
+// listExtras lists the resources and prompts of a server that offers them.
+// They are optional, so failures are reported but not fatal.
+func (s *mcpServer) listExtras(ctx context.Context) {
+	capabilities := s.client.GetCapabilities()
+	if capabilities == nil {
+		return
+	}
+	if capabilities.Resources != nil {
+		if err := s.listResources(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  MCP server %s: %v\n", s.config.Name, err)
+		}
+	}
+	if capabilities.Prompts != nil {
+		if err := s.listPrompts(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  MCP server %s: %v\n", s.config.Name, err)
+		}
+	}
+}
+
+// showResources lists the resources of all connected servers
+func (c *AnthropicClient) showResources() {
+	found := false
+	for _, server := range c.mcpServers {
+		if len(server.resources) == 0 {
+			continue
+		}
+		found = true
+		fmt.Printf("%s:\n", server.config.Name)
+		for _, resource := range server.resources {
+			fmt.Printf("  %s", resource.Uri)
+			if resource.Description != nil && *resource.Description != "" {
+				fmt.Printf(" - %s", *resource.Description)
+			}
+			fmt.Println()
+		}
+	}
+	if !found {
+		fmt.Println("No MCP resources available")
+	}
+}
+
+// showPrompts lists the prompts of all connected servers with their arguments
+func (c *AnthropicClient) showPrompts() {
+	found := false
+	for _, server := range c.mcpServers {
+		if len(server.prompts) == 0 {
+			continue
+		}
+		found = true
+		fmt.Printf("%s:\n", server.config.Name)
+		for _, prompt := range server.prompts {
+			fmt.Printf("  %s", prompt.Name)
+			if prompt.Description != nil && *prompt.Description != "" {
+				fmt.Printf(" - %s", *prompt.Description)
+			}
+			fmt.Println()
+			for _, arg := range prompt.Arguments {
+				required := ""
+				if arg.Required != nil && *arg.Required {
+					required = " (required)"
+				}
+				description := ""
+				if arg.Description != nil {
+					description = ": " + *arg.Description
+				}
+				fmt.Printf("      %s%s%s\n", arg.Name, required, description)
+			}
+		}
+	}
+	if !found {
+		fmt.Println("No MCP prompts available")
+	}
+}
+
+// findResource returns the server that lists a resource URI
+func (c *AnthropicClient) findResource(uri string) (*mcpServer, *mcp_golang.ResourceSchema) {
+	for _, server := range c.mcpServers {
+		for _, resource := range server.resources {
+			if resource.Uri == uri {
+				return server, resource
+			}
+		}
+	}
+	return nil, nil
+}
+
+// loadResource reads an MCP resource and adds it to the context like a
+// loaded file
+func (c *AnthropicClient) loadResource(uri string) (string, error) {
+	server, resource := c.findResource(uri)
+	if server == nil {
+		return "", fmt.Errorf("no connected MCP server lists %s (see /resources)", uri)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mcpConnectTimeout)
+	defer cancel()
+	resp, err := server.client.ReadResource(ctx, uri)
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	for _, content := range resp.Contents {
+		switch {
+		case content == nil:
+		case content.TextResourceContents != nil:
+			// The server library reports read errors as contents without a URI
+			if content.TextResourceContents.Uri == "" {
+				return "", fmt.Errorf("server failed to read %s: %s", uri, content.TextResourceContents.Text)
+			}
+			parts = append(parts, content.TextResourceContents.Text)
+		case content.BlobResourceContents != nil:
+			return "", fmt.Errorf("%s is binary and can't be added to the context", uri)
+		}
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("%s is empty", uri)
+	}
+
+	name := resource.Name
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		name = path.Base(u.Path)
+	}
+	if err := c.addContextFile(name, uri, strings.Join(parts, "\n")); err != nil {
+		return "", err
+	}
+	return name, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// retryableStatus reports whether an API response status is worth retrying:
+// rate limiting, overload and transient server errors
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout, 529: // 529: Anthropic "overloaded"
+		return true
+	}
+	return false
+}
+
+// postWithRetry POSTs body to url, retrying according to the retry policy.
+// Only failures before a successful response are retried, so nothing has
+// been streamed to the user yet. The caller closes the returned body.
+func (c *AnthropicClient) postWithRetry(ctx context.Context, url string, body []byte) (*http.Response, error) {
+	policy := c.retry
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	backoff := time.Duration(policy.InitialBackoff)
+
+	for attempt := 1; ; attempt++ {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+		if err := c.addAuthHeaders(httpReq); err != nil {
+			return nil, fmt.Errorf("failed to add auth headers: %v", err)
+		}
+		c.addCustomHeaders(httpReq)
+
+		var wait time.Duration
+		resp, err := c.httpClient.Do(httpReq)
+		switch {
+		case err != nil:
+			if ctx.Err() != nil || attempt >= policy.MaxAttempts {
+				return nil, fmt.Errorf("failed to send request: %v", err)
+			}
+			fmt.Fprintf(os.Stderr, "\n⚠️  Request failed: %v\n", err)
+		case resp.StatusCode == http.StatusOK:
+			return resp, nil
+		default:
+			respBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if !retryableStatus(resp.StatusCode) || attempt >= policy.MaxAttempts {
+				return nil, c.explainAPIError(resp.StatusCode, respBody)
+			}
+			fmt.Fprintf(os.Stderr, "\n⚠️  API request failed with status %d\n", resp.StatusCode)
+			if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				wait = time.Duration(seconds) * time.Second
+			}
+		}
+
+		if wait == 0 {
+			wait = backoff
+			backoff *= 2
+		}
+		if policy.MaxBackoff > 0 && wait > time.Duration(policy.MaxBackoff) {
+			wait = time.Duration(policy.MaxBackoff)
+		}
+		fmt.Fprintf(os.Stderr, "Retrying in %s (attempt %d of %d)...\n", wait, attempt+1, policy.MaxAttempts)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingServer answers API requests with the given statuses in turn,
+// keeping the requests it received
+type recordingServer struct {
+	mu       sync.Mutex
+	statuses []int
+	body     string
+	requests []*http.Request
+}
+
+func (s *recordingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r)
+	status := s.statuses[min(len(s.requests), len(s.statuses))-1]
+	w.WriteHeader(status)
+	io.WriteString(w, s.body)
+}
+
+func newRetryTestClient(t *testing.T, rs *recordingServer, model *ModelDefinition) *AnthropicClient {
+	t.Helper()
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-test")
+	t.Setenv("GATEWAY_TOKEN", "secret")
+	server := httptest.NewServer(rs)
+	t.Cleanup(server.Close)
+	return &AnthropicClient{
+		provider:   "direct",
+		baseURL:    server.URL,
+		version:    "2023-06-01",
+		httpClient: server.Client(),
+		httpConfig: HTTPConfig{Headers: map[string]string{"X-Gateway-Token": "${GATEWAY_TOKEN}"}},
+		model:      model,
+		retry:      RetryConfig{MaxAttempts: 3, InitialBackoff: Duration(time.Millisecond)},
+	}
+}
+
+func TestPostWithRetry(t *testing.T) {
+	rs := &recordingServer{statuses: []int{529, 503, 200}}
+	c := newRetryTestClient(t, rs, &ModelDefinition{AuthStyle: "bearer", Endpoint: "/gateway/messages", Betas: []string{"beta-a", "beta-b"}})
+
+	resp, err := c.postWithRetry(context.Background(), c.messagesURL(), []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(rs.requests) != 3 {
+		t.Fatalf("server got %d requests, want 3", len(rs.requests))
+	}
+	req := rs.requests[2]
+	want := map[string]string{
+		"Authorization":     "Bearer sk-ant-test",
+		"X-Api-Key":         "",
+		"X-Gateway-Token":   "secret",
+		"Anthropic-Version": "2023-06-01",
+		"Anthropic-Beta":    "beta-a,beta-b",
+	}
+	for name, value := range want {
+		if got := req.Header.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if req.URL.Path != "/gateway/messages" {
+		t.Errorf("path = %s, want the model's endpoint", req.URL.Path)
+	}
+}
+
+func TestPostWithRetryExplainsErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		body         string
+		wantRequests int
+		wantErr      string
+	}{
+		{
+			name:         "rejected beta is not retried",
+			statuses:     []int{400},
+			body:         `{"error": {"type": "invalid_request_error", "message": "invalid anthropic-beta value"}}`,
+			wantRequests: 1,
+			wantErr:      "the API rejected the beta features beta-a",
+		},
+		{
+			name:         "rejected version",
+			statuses:     []int{400},
+			body:         `{"error": {"type": "invalid_request_error", "message": "invalid anthropic-version"}}`,
+			wantRequests: 1,
+			wantErr:      `Check the "version" in the model profile`,
+		},
+		{
+			name:         "overloaded until the attempts run out",
+			statuses:     []int{529},
+			body:         `{"error": {"type": "overloaded_error", "message": "Overloaded"}}`,
+			wantRequests: 3,
+			wantErr:      "API request failed with status 529",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := &recordingServer{statuses: tt.statuses, body: tt.body}
+			c := newRetryTestClient(t, rs, &ModelDefinition{Betas: []string{"beta-a"}})
+			_, err := c.postWithRetry(context.Background(), c.messagesURL(), []byte(`{}`))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+			if len(rs.requests) != tt.wantRequests {
+				t.Errorf("server got %d requests, want %d", len(rs.requests), tt.wantRequests)
+			}
+			if got := rs.requests[0].Header.Get("X-Api-Key"); got != "sk-ant-test" {
+				t.Errorf("x-api-key = %q by default", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// maxJSONRetries is how many times a response that fails validation is sent
+// back to the model for correction before giving up
+const maxJSONRetries = 2
+
+// loadSchema resolves the model's "schema" field, which is either an inline
+// JSON Schema object or the path of a schema file relative to dir
+func (m *ModelDefinition) loadSchema(dir string) error {
+	if len(m.Schema) == 0 {
+		return nil
+	}
+
+	data := []byte(m.Schema)
+	var path string
+	if err := json.Unmarshal(m.Schema, &path); err == nil {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if data, err = os.ReadFile(path); err != nil {
+			return fmt.Errorf("failed to read schema file: %v", err)
+		}
+		m.schemaSource = path
+	} else {
+		m.schemaSource = "inline"
+	}
+
+	var schema interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return fmt.Errorf("failed to parse schema: %v", err)
+	}
+	switch schema.(type) {
+	case map[string]interface{}, bool:
+	default:
+		return fmt.Errorf("schema must be a JSON object")
+	}
+	m.schema = schema
+	return nil
+}
+
+// jsonPrefill returns the text used to start the assistant turn so the model
+// continues with a JSON value of the type the schema expects
+func (m *ModelDefinition) jsonPrefill() string {
+	if schema, ok := m.schema.(map[string]interface{}); ok && schema["type"] == "array" {
+		return "["
+	}
+	return "{"
+}
+
+// enforceJSON validates a structured response and, when it is invalid, sends
+// the validation error back to the model and asks again. It returns the
+// validated JSON, pretty-printed.
+func (c *AnthropicClient) enforceJSON(ctx context.Context, req *AnthropicRequest, prefill, text string, out *markdownRenderer, metrics *PerfMetrics) (string, error) {
+	// The last message is the prefilled assistant turn
+	base := req.Messages[:len(req.Messages)-1]
+
+	for attempt := 0; ; attempt++ {
+		response := prefill + text
+		validated, value, err := parseJSONResponse(response)
+		if err == nil && c.model.schema != nil {
+			if err = validateJSONSchema(c.model.schema, value); err != nil {
+				err = fmt.Errorf("response does not match the schema: %v", err)
+			}
+		}
+		if err == nil {
+			return validated, nil
+		}
+		if attempt == maxJSONRetries {
+			return "", fmt.Errorf("%v (after %d attempts)", err, attempt+1)
+		}
+
+		fmt.Fprintf(os.Stderr, "\n\n⚠️  Invalid JSON response: %v\nAsking the model to correct it...\n\n", err)
+
+		correction := fmt.Sprintf("Your previous response was invalid: %v\n\nRespond again with only the corrected JSON and no other text.", err)
+		req.Messages = append(append([]AnthropicMessage{}, base...),
+			AnthropicMessage{Role: "assistant", Content: []AnthropicContent{{Type: "text", Text: response}}},
+			AnthropicMessage{Role: "user", Content: []AnthropicContent{{Type: "text", Text: correction}}},
+			AnthropicMessage{Role: "assistant", Content: []AnthropicContent{{Type: "text", Text: prefill}}},
+		)
+
+		out.Write(prefill)
+		if text, err = c.sendRequest(ctx, req, out, metrics); err != nil {
+			return "", err
+		}
+	}
+}
+
+// describeFormat summarises the response format for status output
+func (m *ModelDefinition) describeFormat() string {
+	format := m.Format
+	if format == "" {
+		format = "markdown"
+	}
+	if m.schemaSource != "" {
+		format += fmt.Sprintf(" (schema: %s)", m.schemaSource)
+	}
+	return format
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/metoro-io/mcp-golang/transport"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TelemetryConfig configures OpenTelemetry tracing
+type TelemetryConfig struct {
+	OTLPEndpoint string `json:"otlp_endpoint,omitempty"` // OTLP/HTTP collector for trace spans, e.g. http://localhost:4318
+}
+
+var tracer = otel.Tracer("herlein.com/client")
+
+// setupTracing installs the tracer provider. Each prompt is traced, with
+// spans for the API calls and tool calls it makes, and MCP servers are sent
+// the trace context so their spans join the same trace. Spans are exported
+// only when an OTLP endpoint is configured here or through the standard
+// OTEL_EXPORTER_OTLP_* variables. The returned function flushes spans that
+// haven't been exported yet.
+func setupTracing(config TelemetryConfig) (func(), error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "gchai"))),
+	}
+	if config.OTLPEndpoint != "" || os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		var exporterOptions []otlptracehttp.Option
+		if config.OTLPEndpoint != "" {
+			exporterOptions = append(exporterOptions, otlptracehttp.WithEndpointURL(config.OTLPEndpoint))
+		}
+		exporter, err := otlptracehttp.New(context.Background(), exporterOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create trace exporter: %v", err)
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Failed to flush trace spans: %v\n", err)
+		}
+	}, nil
+}
+
+// traceTransport adds the caller's trace context to the _meta of each MCP
+// request. Stdio has no headers, and the HTTP transport doesn't let us set
+// them per request, so _meta is the one place that works for both.
+type traceTransport struct {
+	transport.Transport
+}
+
+func (t traceTransport) Send(ctx context.Context, message *transport.BaseJsonRpcMessage) error {
+	if message.Type == transport.BaseMessageTypeJSONRPCRequestType && trace.SpanContextFromContext(ctx).IsValid() {
+		request := message.JsonRpcRequest
+		var params map[string]any
+		if len(request.Params) == 0 || json.Unmarshal(request.Params, &params) == nil {
+			if params == nil {
+				params = make(map[string]any)
+			}
+			meta, _ := params["_meta"].(map[string]any)
+			if meta == nil {
+				meta = make(map[string]any)
+			}
+			carrier := propagation.MapCarrier{}
+			otel.GetTextMapPropagator().Inject(ctx, carrier)
+			for key, value := range carrier {
+				meta[key] = value
+			}
+			params["_meta"] = meta
+			if data, err := json.Marshal(params); err == nil {
+				request.Params = data
+			}
+		}
+	}
+	return t.Transport.Send(ctx, message)
+}
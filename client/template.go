@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// maxIncludeDepth bounds nested {{include}} calls to catch include cycles
+const maxIncludeDepth = 10
+
+// templateEnvVars are the environment variables templates may read.
+// Profiles and prompt files can come with a project, so secrets such as
+// ANTHROPIC_API_KEY are kept from them; other values can be passed with -var.
+var templateEnvVars = []string{"HOME", "USER", "LOGNAME", "SHELL", "LANG", "TERM", "TZ", "EDITOR", "HOSTNAME"}
+
+// templateVars collects -var key=value flags
+type templateVars map[string]string
+
+func (v templateVars) String() string {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+v[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (v templateVars) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	v[strings.TrimSpace(key)] = val
+	return nil
+}
+
+// loadTemplateVars reads a JSON object of template variables from a file
+func loadTemplateVars(path string) (templateVars, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vars file: %v", err)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse vars file: %v", err)
+	}
+	vars := make(templateVars, len(raw))
+	for k, v := range raw {
+		if s, ok := v.(string); ok {
+			vars[k] = s
+		} else {
+			vars[k] = compactJSON(v)
+		}
+	}
+	return vars, nil
+}
+
+// templateData builds the values available to prompt templates. Built-in
+// values are capitalised; user variables from the vars file and -var flags
+// (which take precedence) are available by their own names.
+func (c *AnthropicClient) templateData() map[string]interface{} {
+	now := time.Now()
+	cwd, _ := os.Getwd()
+
+	env := make(map[string]string)
+	for _, name := range templateEnvVars {
+		if value, ok := os.LookupEnv(name); ok {
+			env[name] = value
+		}
+	}
+
+	data := map[string]interface{}{
+		"Now":       now,
+		"Date":      now.Format("2006-01-02"),
+		"Time":      now.Format("15:04"),
+		"Cwd":       cwd,
+		"GitBranch": gitBranch(),
+		"Env":       env,
+	}
+	for k, v := range c.templateVars {
+		data[k] = v
+	}
+	return data
+}
+
+// renderTemplate renders text as a Go text/template. Paths passed to
+// {{include}} are looked up in dir and then at the project root.
+func (c *AnthropicClient) renderTemplate(name, text, dir string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	return c.renderTemplateDepth(name, text, dir, c.templateData(), 0)
+}
+
+func (c *AnthropicClient) renderTemplateDepth(name, text, dir string, data map[string]interface{}, depth int) (string, error) {
+	funcs := template.FuncMap{
+		"env": func(name string) (string, error) {
+			if !slices.Contains(templateEnvVars, name) {
+				return "", fmt.Errorf("$%s isn't available to templates; pass it with -var", name)
+			}
+			return os.Getenv(name), nil
+		},
+		"include": func(name string) (string, error) {
+			if depth >= maxIncludeDepth {
+				return "", fmt.Errorf("includes nested more than %d deep", maxIncludeDepth)
+			}
+			path, err := includePath(dir, name)
+			if err != nil {
+				return "", err
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return "", err
+			}
+			return c.renderTemplateDepth(path, string(content), filepath.Dir(path), data, depth+1)
+		},
+	}
+
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %v", err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render template: %v", err)
+	}
+	return out.String(), nil
+}
+
+// includePath finds a file named by {{include}}, a relative path without
+// "..", next to the including file or else at the project root. Symlinks
+// may not lead out of the directory it was found in.
+func includePath(dir, name string) (string, error) {
+	if !filepath.IsLocal(name) || slices.Contains(strings.Split(filepath.ToSlash(name), "/"), "..") {
+		return "", fmt.Errorf("include %q must be a relative path without ..", name)
+	}
+	bases := []string{dir}
+	if root := findProjectRoot(); root != "" && root != dir {
+		bases = append(bases, root)
+	}
+	for _, base := range bases {
+		path := filepath.Join(base, name)
+		resolved, err := filepath.EvalSymlinks(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		resolvedBase, err := filepath.EvalSymlinks(base)
+		if err != nil {
+			return "", err
+		}
+		if rel, err := filepath.Rel(resolvedBase, resolved); err != nil || !filepath.IsLocal(rel) {
+			return "", fmt.Errorf("include %q leads outside %s", name, base)
+		}
+		return path, nil
+	}
+	return "", fmt.Errorf("include %q: no such file next to the template or at the project root", name)
+}
+
+// renderPromptFile reads a prompt file and renders it as a template
+func (c *AnthropicClient) renderPromptFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt file: %v", err)
+	}
+	return c.renderTemplate(path, string(content), filepath.Dir(path))
+}
+
+// gitBranch returns the current git branch, or "" outside a repository
+func gitBranch() string {
+	out, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
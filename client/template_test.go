@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes files, named by slash-separated paths, under dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	base := t.TempDir()
+	project := filepath.Join(base, "project")
+	models := filepath.Join(project, projectConfigDirName, "models")
+	writeFiles(t, base, map[string]string{
+		"secret.txt":                             "secret",
+		"project/conventions.md":                 "Use tabs.",
+		"project/.gchai/models/style.md":         "Be brief. {{include \"parts/tone.md\"}}",
+		"project/.gchai/models/parts/tone.md":    "Be {{.tone}}.",
+		"project/.gchai/models/loop.md":          "{{include \"loop.md\"}}",
+		"project/.gchai/models/parts/sibling.md": "sibling",
+	})
+	if err := os.Symlink(filepath.Join(base, "secret.txt"), filepath.Join(models, "link.md")); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(project)
+	t.Setenv("HOME", "/home/me")
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-secret")
+
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr string
+	}{
+		{name: "plain text", text: "no actions", want: "no actions"},
+		{name: "user variable", text: "Review {{.project}}", want: "Review gchai"},
+		{name: "built-in value", text: "{{if .Date}}dated{{end}}", want: "dated"},
+		{name: "allowed variable", text: "{{.Env.HOME}} {{env \"HOME\"}}", want: "/home/me /home/me"},
+		{name: "secret through env", text: "{{env \"ANTHROPIC_API_KEY\"}}", wantErr: "$ANTHROPIC_API_KEY isn't available"},
+		{name: "secret through .Env", text: "{{.Env.ANTHROPIC_API_KEY}}", wantErr: "map has no entry for key"},
+		{name: "missing variable", text: "{{.projcet}}", wantErr: "map has no entry for key \"projcet\""},
+		{name: "parse error", text: "{{.project", wantErr: "failed to parse template"},
+		{name: "include next to the file", text: "{{include \"style.md\"}}", want: "Be brief. Be terse."},
+		{name: "nested include relative to its file", text: "{{include \"parts/tone.md\"}}", want: "Be terse."},
+		{name: "include from the project root", text: "{{include \"conventions.md\"}}", want: "Use tabs."},
+		{name: "absolute include", text: "{{include \"" + filepath.Join(base, "secret.txt") + "\"}}", wantErr: "must be a relative path"},
+		{name: "include climbing out", text: "{{include \"../../../secret.txt\"}}", wantErr: "must be a relative path"},
+		{name: "dot-dot inside an include", text: "{{include \"parts/../parts/sibling.md\"}}", wantErr: "must be a relative path"},
+		{name: "include through a symlink", text: "{{include \"link.md\"}}", wantErr: "leads outside"},
+		{name: "missing include", text: "{{include \"nope.md\"}}", wantErr: "no such file"},
+		{name: "include cycle", text: "{{include \"loop.md\"}}", wantErr: "includes nested more than 10 deep"},
+	}
+	c := &AnthropicClient{templateVars: templateVars{"project": "gchai", "tone": "terse"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.renderTemplate("test", tt.text, models)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateVars(t *testing.T) {
+	vars := templateVars{}
+	for _, flag := range []string{"a=1", " b =x=y", "c="} {
+		if err := vars.Set(flag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := vars.String(), "a=1,b=x=y,c="; got != want {
+		t.Errorf("vars = %s, want %s", got, want)
+	}
+	for _, flag := range []string{"novalue", "=1"} {
+		if err := vars.Set(flag); err == nil {
+			t.Errorf("Set(%q) succeeded", flag)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "vars.json")
+	writeFiles(t, filepath.Dir(path), map[string]string{"vars.json": `{"name": "x", "n": 2, "list": [1, 2]}`})
+	loaded, err := loadTemplateVars(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := loaded.String(), "list=[1,2],n=2,name=x"; got != want {
+		t.Errorf("vars = %s, want %s", got, want)
+	}
+}
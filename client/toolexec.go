@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	mcp_golang "github.com/metoro-io/mcp-golang"
+)
+
+// ToolCallsConfig controls how the tool calls in one response are run
+type ToolCallsConfig struct {
+	MaxParallel int                 `json:"max_parallel,omitempty"` // Calls run at the same time
+	Timeout     Duration            `json:"timeout,omitempty"`      // Time a call may take
+	Timeouts    map[string]Duration `json:"timeouts,omitempty"`     // Timeouts for particular tools
+}
+
+// mcpRequestLimit is how long the MCP library waits for any response. A
+// longer tool timeout would never be reached.
+const mcpRequestLimit = 60 * time.Second
+
+// validate checks the limits
+func (config ToolCallsConfig) validate() error {
+	if config.MaxParallel < 1 {
+		return fmt.Errorf("max_parallel must be at least 1")
+	}
+	if config.Timeout <= 0 || time.Duration(config.Timeout) > mcpRequestLimit {
+		return fmt.Errorf("timeout must be between 0 and %v", mcpRequestLimit)
+	}
+	for name, timeout := range config.Timeouts {
+		if timeout <= 0 || time.Duration(timeout) > mcpRequestLimit {
+			return fmt.Errorf("timeouts.%s must be between 0 and %v", name, mcpRequestLimit)
+		}
+	}
+	return nil
+}
+
+// timeout returns how long a tool may run. Like tool policy rules, an
+// entry in timeouts may give the name the model sees or the server's own.
+func (config ToolCallsConfig) timeout(name, tool string) time.Duration {
+	if timeout, ok := config.Timeouts[name]; ok {
+		return time.Duration(timeout)
+	}
+	if timeout, ok := config.Timeouts[tool]; ok {
+		return time.Duration(timeout)
+	}
+	return time.Duration(config.Timeout)
+}
+
+// toolCall is a tool_use block that has been checked and is ready to run,
+// or the reason it can't run
+type toolCall struct {
+	use    AnthropicContent
+	server *mcpServer
+	tool   string // Name of the tool on its server
+	args   map[string]any
+	err    error
+}
+
+// runTools runs the tool_use blocks of one response and returns their
+// tool_result blocks in the same order. Calls are checked and approved one
+// at a time, as approval may need the user, and then run concurrently up to
+// the configured limit. Cancelling ctx cancels the calls still running and
+// stops those that haven't started.
+func (c *AnthropicClient) runTools(ctx context.Context, uses []AnthropicContent) []AnthropicContent {
+	calls := make([]*toolCall, len(uses))
+	for i, use := range uses {
+		calls[i] = c.prepareToolCall(use)
+	}
+
+	results := make([]AnthropicContent, len(calls))
+	slots := make(chan struct{}, max(c.toolCalls.MaxParallel, 1))
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+			}
+			results[i] = c.callTool(ctx, call)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// prepareToolCall finds the server for a tool_use block, decodes its input
+// and applies the tool policy
+func (c *AnthropicClient) prepareToolCall(use AnthropicContent) *toolCall {
+	call := &toolCall{use: use}
+	fmt.Fprintf(os.Stderr, "🔧 %s %s\n", use.Name, truncate(string(use.Input), 200))
+
+	call.server, call.tool = c.findMCPTool(use.Name)
+	if call.server == nil {
+		call.err = fmt.Errorf("unknown tool %q", use.Name)
+		return call
+	}
+	if len(use.Input) > 0 {
+		if err := json.Unmarshal(use.Input, &call.args); err != nil {
+			call.err = fmt.Errorf("invalid tool input: %v", err)
+			return call
+		}
+	}
+	if err := c.authorizeTool(use.Name, call.server.config.Name, call.tool, call.args, use.Input); err != nil {
+		fmt.Fprintf(os.Stderr, "🚫 %v\n", err)
+		call.err = err
+	}
+	return call
+}
+
+// resolveTool finds a tool by the name the model sees or, when only one
+// server has a tool of that name, by the tool's own name
+func (c *AnthropicClient) resolveTool(name string) (*mcpServer, mcp_golang.ToolRetType, error) {
+	var found *mcpServer
+	var match mcp_golang.ToolRetType
+	for _, server := range c.mcpServers {
+		for _, tool := range server.tools {
+			if server.toolName(tool.Name) == name {
+				return server, tool, nil
+			}
+			if tool.Name == name {
+				if found != nil {
+					return nil, match, fmt.Errorf("%s is offered by %s and %s; use %s or %s", name,
+						found.config.Name, server.config.Name, found.toolName(name), server.toolName(name))
+				}
+				found, match = server, tool
+			}
+		}
+	}
+	if found == nil {
+		return nil, match, fmt.Errorf("unknown tool %q (see /tools)", name)
+	}
+	return found, match, nil
+}
+
+// callCommand runs a tool for the user, without the model: "/call <tool>
+// [json]". The arguments are checked against the tool's input schema and
+// the result's content blocks are printed as the server sent them.
+func (c *AnthropicClient) callCommand(input string) error {
+	name, argText, _ := strings.Cut(strings.TrimSpace(input), " ")
+	if name == "" {
+		return fmt.Errorf("usage: /call <tool> [json arguments]")
+	}
+	server, tool, err := c.resolveTool(name)
+	if err != nil {
+		return err
+	}
+
+	var args any = map[string]any{}
+	if argText = strings.TrimSpace(argText); argText != "" {
+		if err := json.Unmarshal([]byte(argText), &args); err != nil {
+			return fmt.Errorf("invalid JSON arguments: %v", err)
+		}
+		if _, ok := args.(map[string]any); !ok {
+			return fmt.Errorf("arguments must be a JSON object")
+		}
+	}
+	if tool.InputSchema != nil {
+		if err := validateJSONSchema(tool.InputSchema, args); err != nil {
+			return fmt.Errorf("arguments don't match the input schema of %s: %v", name, err)
+		}
+	}
+
+	timeout := c.toolCalls.timeout(name, tool.Name)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	resp, err := server.client.CallTool(ctx, tool.Name, args)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("tool %s timed out after %v", name, timeout)
+		}
+		return err
+	}
+	for _, block := range resp.Content {
+		data, err := json.MarshalIndent(block, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format result: %v", err)
+		}
+		fmt.Println(string(data))
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mcp_golang "github.com/metoro-io/mcp-golang"
+	"github.com/metoro-io/mcp-golang/transport/stdio"
+)
+
+// WaitArgs defines the arguments for the test server's wait tool
+type WaitArgs struct {
+	Ms   int    `json:"ms"`
+	Text string `json:"text"`
+}
+
+// waitServer counts the calls of its wait tool running at the same time
+type waitServer struct {
+	mu      sync.Mutex
+	running int
+	peak    int
+}
+
+func (w *waitServer) wait(ctx context.Context, args WaitArgs) (*mcp_golang.ToolResponse, error) {
+	w.mu.Lock()
+	w.running++
+	w.peak = max(w.peak, w.running)
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		w.running--
+		w.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(time.Duration(args.Ms) * time.Millisecond):
+	case <-ctx.Done():
+	}
+	return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(args.Text)), nil
+}
+
+// newTestToolClient returns a client connected to an in-process server
+// named "test" with a wait tool, wired up like the client's local server
+func newTestToolClient(t *testing.T, config ToolCallsConfig) (*AnthropicClient, *waitServer) {
+	t.Helper()
+	toServer, clientOut, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromServer, serverOut, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &waitServer{}
+	server := mcp_golang.NewServer(stdio.NewStdioServerTransportWithIO(toServer, serverOut))
+	if err := server.RegisterTool("wait", "Waits, then returns the text", w.wait); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := (&mcpServer{config: MCPServerConfig{Name: "test"}, stdin: clientOut}).connect(stdio.NewStdioServerTransportWithIO(fromServer, clientOut))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(conn.close)
+
+	policy, err := newToolPolicy(ToolPolicyConfig{Default: toolAllow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &AnthropicClient{mcpServers: []*mcpServer{conn}, toolPolicy: policy, toolCalls: config}, w
+}
+
+// waitUse returns a tool_use block calling the test server's wait tool
+func waitUse(id string, ms int) AnthropicContent {
+	input, _ := json.Marshal(WaitArgs{Ms: ms, Text: "done " + id})
+	return AnthropicContent{Type: "tool_use", ID: id, Name: "test__wait", Input: input}
+}
+
+func TestRunToolsOrder(t *testing.T) {
+	c, _ := newTestToolClient(t, ToolCallsConfig{MaxParallel: 4, Timeout: Duration(10 * time.Second)})
+
+	uses := []AnthropicContent{
+		waitUse("a", 150),
+		{Type: "tool_use", ID: "b", Name: "test__missing"},
+		waitUse("c", 10),
+		{Type: "tool_use", ID: "d", Name: "test__wait", Input: json.RawMessage(`[1]`)},
+		waitUse("e", 80),
+	}
+	results := c.runTools(context.Background(), uses)
+
+	want := []struct {
+		content string
+		isError bool
+	}{
+		{"done a", false},
+		{`unknown tool "test__missing"`, true},
+		{"done c", false},
+		{"invalid tool input", true},
+		{"done e", false},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, result := range results {
+		if result.Type != "tool_result" || result.ToolUseID != uses[i].ID {
+			t.Errorf("result %d is %s for %q, want tool_result for %q", i, result.Type, result.ToolUseID, uses[i].ID)
+		}
+		if !strings.Contains(result.Content, want[i].content) || result.IsError != want[i].isError {
+			t.Errorf("result %d = %q (error %v), want %q (error %v)", i, result.Content, result.IsError, want[i].content, want[i].isError)
+		}
+	}
+}
+
+func TestRunToolsConcurrencyLimit(t *testing.T) {
+	for _, limit := range []int{1, 2, 4} {
+		t.Run(fmt.Sprint(limit), func(t *testing.T) {
+			c, w := newTestToolClient(t, ToolCallsConfig{MaxParallel: limit, Timeout: Duration(10 * time.Second)})
+			var uses []AnthropicContent
+			for i := range 8 {
+				uses = append(uses, waitUse(fmt.Sprint(i), 50))
+			}
+			for i, result := range c.runTools(context.Background(), uses) {
+				if result.IsError {
+					t.Errorf("call %d failed: %s", i, result.Content)
+				}
+			}
+			if w.peak > limit {
+				t.Errorf("%d calls ran at once, limit %d", w.peak, limit)
+			}
+			if limit > 1 && w.peak < 2 {
+				t.Errorf("calls never ran concurrently")
+			}
+		})
+	}
+}
+
+func TestRunToolsTimeout(t *testing.T) {
+	c, _ := newTestToolClient(t, ToolCallsConfig{
+		MaxParallel: 2,
+		Timeout:     Duration(10 * time.Second),
+		Timeouts:    map[string]Duration{"wait": Duration(100 * time.Millisecond)},
+	})
+
+	start := time.Now()
+	results := c.runTools(context.Background(), []AnthropicContent{waitUse("slow", 5000), waitUse("fast", 10)})
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("runTools took %s", elapsed)
+	}
+	if !results[0].IsError || !strings.Contains(results[0].Content, "timed out after 100ms") {
+		t.Errorf("slow call = %q, want a timeout", results[0].Content)
+	}
+	if results[1].IsError || results[1].Content != "done fast" {
+		t.Errorf("fast call = %q", results[1].Content)
+	}
+}
+
+func TestRunToolsCancel(t *testing.T) {
+	c, _ := newTestToolClient(t, ToolCallsConfig{MaxParallel: 1, Timeout: Duration(10 * time.Second)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	results := c.runTools(ctx, []AnthropicContent{waitUse("a", 5000), waitUse("b", 5000), waitUse("c", 5000)})
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("runTools took %s after cancelling", elapsed)
+	}
+	for i, result := range results {
+		if !result.IsError || !strings.Contains(result.Content, "was cancelled") {
+			t.Errorf("result %d = %q, want cancelled", i, result.Content)
+		}
+	}
+
+	// A call is not started once the turn has been cancelled
+	results = c.runTools(ctx, []AnthropicContent{waitUse("d", 0)})
+	if !strings.Contains(results[0].Content, "was cancelled") {
+		t.Errorf("call after cancelling = %q", results[0].Content)
+	}
+}
+
+func TestToolCallTimeout(t *testing.T) {
+	config := ToolCallsConfig{
+		Timeout:  Duration(time.Minute),
+		Timeouts: map[string]Duration{"run_command": Duration(time.Second), "b__run_command": Duration(2 * time.Second)},
+	}
+	tests := []struct {
+		name, tool string
+		want       time.Duration
+	}{
+		{"a__run_command", "run_command", time.Second},
+		{"b__run_command", "run_command", 2 * time.Second},
+		{"a__read_file", "read_file", time.Minute},
+	}
+	for _, tt := range tests {
+		if got := config.timeout(tt.name, tt.tool); got != tt.want {
+			t.Errorf("timeout(%s, %s) = %v, want %v", tt.name, tt.tool, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	mcp_golang "github.com/metoro-io/mcp-golang"
+	"github.com/metoro-io/mcp-golang/transport"
+)
+
+// toolNameSeparator joins a server's name and a tool's name into the name
+// the model sees, e.g. local__read_file
+const toolNameSeparator = "__"
+
+// Names the Messages API accepts for tools, and so for servers and aliases
+var (
+	validToolName   = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+	invalidToolChar = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+)
+
+// toolName returns the name the model sees for one of the server's tools:
+// its alias if it has one, or the tool's name prefixed with the server's.
+// Characters the API doesn't accept become underscores.
+func (s *mcpServer) toolName(tool string) string {
+	if alias, ok := s.config.Aliases[tool]; ok {
+		return alias
+	}
+	return s.config.Name + toolNameSeparator + invalidToolChar.ReplaceAllString(tool, "_")
+}
+
+// addTool adds one of the server's tools to its list unless the name the
+// model would see is too long for the API or already taken by another of
+// its tools, e.g. a.b and a_b, which both become a_b. names maps the names
+// taken so far to their tools.
+func (s *mcpServer) addTool(tool mcp_golang.ToolRetType, names map[string]string) {
+	name := s.toolName(tool.Name)
+	if !validToolName.MatchString(name) {
+		fmt.Fprintf(os.Stderr, "⚠️  MCP server %s: left out tool %s, as %s is longer than 64 characters; give it a shorter alias\n", s.config.Name, tool.Name, name)
+		return
+	}
+	if other, ok := names[name]; ok {
+		fmt.Fprintf(os.Stderr, "⚠️  MCP server %s: left out tool %s, as %s is already the name of its tool %s; give one of them an alias\n", s.config.Name, tool.Name, name, other)
+		return
+	}
+	names[name] = tool.Name
+	s.tools = append(s.tools, tool)
+}
+
+// warnToolClashes reports tools the model can't use because an earlier
+// server offers a tool under the same name, which happens when an alias
+// matches another server's tool
+func (c *AnthropicClient) warnToolClashes() {
+	owners := make(map[string]*mcpServer)
+	for _, server := range c.mcpServers {
+		for _, tool := range server.tools {
+			name := server.toolName(tool.Name)
+			if owner, ok := owners[name]; ok {
+				fmt.Fprintf(os.Stderr, "⚠️  MCP server %s: tool %s is hidden by server %s's tool of the same name %s\n", server.config.Name, tool.Name, owner.config.Name, name)
+				continue
+			}
+			owners[name] = server
+		}
+	}
+}
+
+// offers reports whether the config lets the model use one of the
+// server's tools
+func (s *mcpServer) offers(tool string) bool {
+	included := len(s.config.IncludeTools) == 0
+	for _, pattern := range s.config.IncludeTools {
+		if globPattern(pattern).MatchString(tool) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, pattern := range s.config.ExcludeTools {
+		if globPattern(pattern).MatchString(tool) {
+			return false
+		}
+	}
+	return true
+}
+
+// notifyTransport watches a server's notifications for changes to its
+// tool list. The MCP library doesn't let clients handle notifications, so
+// they are picked up on their way to it.
+type notifyTransport struct {
+	transport.Transport
+	server *mcpServer
+}
+
+func (t notifyTransport) SetMessageHandler(handler func(ctx context.Context, message *transport.BaseJsonRpcMessage)) {
+	t.Transport.SetMessageHandler(func(ctx context.Context, message *transport.BaseJsonRpcMessage) {
+		if message.Type == transport.BaseMessageTypeJSONRPCNotificationType &&
+			message.JsonRpcNotification.Method == "notifications/tools/list_changed" {
+			t.server.toolsChanged.Store(true)
+		}
+		handler(ctx, message)
+	})
+}
+
+// refreshTools lists the tools again of servers that said theirs changed.
+// A server whose list can't be fetched keeps its old one.
+func (c *AnthropicClient) refreshTools() {
+	refreshed := false
+	for _, server := range c.mcpServers {
+		if !server.toolsChanged.Swap(false) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), mcpConnectTimeout)
+		tools := server.tools
+		if err := server.listTools(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  MCP server %s: failed to refresh tools: %v\n", server.config.Name, err)
+			server.tools = tools
+		} else {
+			refreshed = true
+			if !c.oneShot {
+				fmt.Printf("MCP server %s now offers %d tools\n", server.config.Name, len(server.tools))
+			}
+		}
+		cancel()
+	}
+	if refreshed {
+		c.warnToolClashes()
+	}
+}
+
+// showTools lists the tools offered to the model with the server each comes
+// from and its arguments
+func (c *AnthropicClient) showTools() {
+	c.refreshTools()
+	found := false
+	for _, server := range c.mcpServers {
+		if len(server.tools) == 0 {
+			continue
+		}
+		found = true
+		fmt.Printf("%s:\n", server.config.Name)
+		for _, tool := range server.tools {
+			name := server.toolName(tool.Name)
+			fmt.Printf("  %s", name)
+			if name != server.config.Name+toolNameSeparator+tool.Name {
+				fmt.Printf(" (%s)", tool.Name)
+			}
+			if description := toolDescription(tool); description != "" {
+				fmt.Printf(" - %s", description)
+			}
+			fmt.Println()
+			for _, line := range describeSchema(tool.InputSchema) {
+				fmt.Printf("      %s\n", line)
+			}
+		}
+	}
+	if !found {
+		fmt.Println("No tools available")
+	}
+}
+
+// showTool prints a tool's description and full input schema
+func (c *AnthropicClient) showTool(name string) error {
+	server, tool, err := c.resolveTool(name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s from %s", server.toolName(tool.Name), server.config.Name)
+	if description := toolDescription(tool); description != "" {
+		fmt.Printf(" - %s", description)
+	}
+	fmt.Println()
+	schema, err := json.MarshalIndent(tool.InputSchema, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to format schema: %v", err)
+	}
+	fmt.Println(string(schema))
+	return nil
+}
+
+// toolNames returns the names of all tools offered to the model, sorted
+func (c *AnthropicClient) toolNames() []string {
+	var names []string
+	for _, server := range c.mcpServers {
+		for _, tool := range server.tools {
+			names = append(names, server.toolName(tool.Name))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// describeSchema summarises the properties of a tool's input schema, one
+// line per argument
+func describeSchema(schema any) []string {
+	var parsed struct {
+		Properties map[string]struct {
+			Type        any    `json:"type"`
+			Description string `json:"description"`
+		} `json:"properties"`
+		Required []string `json:"required"`
+	}
+	data, err := json.Marshal(schema)
+	if err != nil || json.Unmarshal(data, &parsed) != nil {
+		return nil
+	}
+	required := make(map[string]bool)
+	for _, name := range parsed.Required {
+		required[name] = true
+	}
+	var names []string
+	for name := range parsed.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		property := parsed.Properties[name]
+		var details []string
+		if property.Type != nil {
+			details = append(details, fmt.Sprint(property.Type))
+		}
+		if required[name] {
+			details = append(details, "required")
+		}
+		line := name
+		if len(details) > 0 {
+			line += " (" + strings.Join(details, ", ") + ")"
+		}
+		if property.Description != "" {
+			line += ": " + property.Description
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// toolDescription returns a tool's description, or nothing
+func toolDescription(tool mcp_golang.ToolRetType) string {
+	if tool.Description == nil {
+		return ""
+	}
+	return *tool.Description
+}
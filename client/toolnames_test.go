@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	mcp_golang "github.com/metoro-io/mcp-golang"
+)
+
+// testServer returns a server with the named tools, added as listTools
+// adds them
+func testServer(config MCPServerConfig, tools ...string) *mcpServer {
+	server := &mcpServer{config: config}
+	names := make(map[string]string)
+	for _, tool := range tools {
+		server.addTool(mcp_golang.ToolRetType{Name: tool}, names)
+	}
+	return server
+}
+
+func TestAddTool(t *testing.T) {
+	long := strings.Repeat("x", 60)
+	tests := []struct {
+		name   string
+		config MCPServerConfig
+		tools  []string
+		want   []string
+	}{
+		{name: "distinct names", config: MCPServerConfig{Name: "a"}, tools: []string{"read", "write"}, want: []string{"read", "write"}},
+		{name: "names that sanitize alike", config: MCPServerConfig{Name: "a"}, tools: []string{"a.b", "a_b", "a-b"}, want: []string{"a.b", "a-b"}},
+		{name: "alias clashing with another tool", config: MCPServerConfig{Name: "a", Aliases: map[string]string{"y": "a__x"}}, tools: []string{"x", "y"}, want: []string{"x"}},
+		{name: "too long", config: MCPServerConfig{Name: "server"}, tools: []string{long, "short"}, want: []string{"short"}},
+		{name: "too long but aliased", config: MCPServerConfig{Name: "server", Aliases: map[string]string{long: "short_name"}}, tools: []string{long}, want: []string{long}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, tool := range testServer(tt.config, tt.tools...).tools {
+				got = append(got, tool.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tools = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolClashes(t *testing.T) {
+	first := testServer(MCPServerConfig{Name: "a", Aliases: map[string]string{"read_file": "b__read"}}, "read_file")
+	second := testServer(MCPServerConfig{Name: "b"}, "read", "write")
+	c := &AnthropicClient{mcpServers: []*mcpServer{first, second}}
+	c.warnToolClashes()
+
+	var names []string
+	for _, tool := range c.mcpTools() {
+		names = append(names, tool.Name)
+	}
+	if want := []string{"b__read", "b__write"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("tools = %v, want %v", names, want)
+	}
+	if server, tool := c.findMCPTool("b__read"); server != first || tool != "read_file" {
+		t.Errorf("b__read is %s's %s, want a's read_file", server.config.Name, tool)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthConfig controls who may use the HTTP transport. The stdio transport
+// is only reachable by the process that started the server, so it is not
+// affected.
+type AuthConfig struct {
+	Tokens         []TokenConfig `json:"tokens,omitempty"`          // Bearer tokens that are accepted; none means no token is needed
+	AllowedOrigins []string      `json:"allowed_origins,omitempty"` // Origin header values that are accepted; "*" accepts any
+}
+
+// TokenConfig is a bearer token and the tools it may use
+type TokenConfig struct {
+	Name     string   `json:"name"`                // Identifies the token in logs
+	Token    string   `json:"token,omitempty"`     // The token itself
+	TokenEnv string   `json:"token_env,omitempty"` // Environment variable holding the token, instead of token
+	Tools    []string `json:"tools,omitempty"`     // Tools the token may list and call; all if empty
+}
+
+// TLSConfig configures HTTPS and client certificates
+type TLSConfig struct {
+	CertFile     string `json:"cert_file,omitempty"`
+	KeyFile      string `json:"key_file,omitempty"`
+	ClientCAFile string `json:"client_ca_file,omitempty"` // Require client certificates signed by this CA (mTLS)
+}
+
+// errCodeForbidden is the JSON-RPC error code for a tool the token may not use
+const errCodeForbidden = -32001
+
+// tokenNameKey is the gin context key holding the name of the request's token
+const tokenNameKey = "token"
+
+// enabled reports whether TLS is configured
+func (t TLSConfig) enabled() bool {
+	return t.CertFile != ""
+}
+
+// serverTLSConfig loads the certificates and, for mTLS, the client CA
+func (t TLSConfig) serverTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %v", err)
+	}
+	config.Certificates = []tls.Certificate{cert}
+
+	if t.ClientCAFile != "" {
+		pem, err := os.ReadFile(t.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA %s", t.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// bearerToken is a resolved token with its tool allowlist
+type bearerToken struct {
+	name  string
+	value []byte
+	tools map[string]bool // nil allows every tool
+}
+
+// authenticator checks the Origin header and bearer token of each request
+// and enforces the token's tool allowlist
+type authenticator struct {
+	tokens  []bearerToken
+	origins map[string]bool
+}
+
+// newAuthenticator resolves the configured tokens
+func newAuthenticator(config AuthConfig) (*authenticator, error) {
+	a := &authenticator{origins: make(map[string]bool)}
+	for _, origin := range config.AllowedOrigins {
+		a.origins[strings.TrimSuffix(origin, "/")] = true
+	}
+	for i, token := range config.Tokens {
+		value := token.Token
+		if token.TokenEnv != "" {
+			value = os.Getenv(token.TokenEnv)
+			if value == "" {
+				return nil, fmt.Errorf("auth.tokens[%d]: environment variable %s is not set", i, token.TokenEnv)
+			}
+		}
+		if value == "" {
+			return nil, fmt.Errorf("auth.tokens[%d] needs a token or token_env", i)
+		}
+		resolved := bearerToken{name: token.Name, value: []byte(value)}
+		if len(token.Tools) > 0 {
+			resolved.tools = make(map[string]bool)
+			for _, tool := range token.Tools {
+				resolved.tools[tool] = true
+			}
+		}
+		a.tokens = append(a.tokens, resolved)
+	}
+	return a, nil
+}
+
+// middleware rejects requests from disallowed origins and without a valid
+// token, and keeps tokens to the tools they are allowed
+func (a *authenticator) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Browsers send Origin; refusing unknown ones stops web pages from
+		// reaching a server on localhost (DNS rebinding)
+		if origin := c.GetHeader("Origin"); origin != "" && !a.origins["*"] && !a.origins[strings.TrimSuffix(origin, "/")] {
+			log.Printf("Rejected request from %s: origin %q is not allowed", c.ClientIP(), origin)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "origin not allowed"})
+			return
+		}
+
+		if len(a.tokens) == 0 {
+			c.Next()
+			return
+		}
+		token := a.match(c.GetHeader("Authorization"))
+		if token == nil {
+			log.Printf("Rejected request from %s: missing or invalid bearer token", c.ClientIP())
+			c.Header("WWW-Authenticate", `Bearer realm="mcp"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or missing bearer token"})
+			return
+		}
+		c.Set(tokenNameKey, token.name)
+		// Only MCP requests name tools; /metrics is a GET
+		if token.tools == nil || c.Request.Method != http.MethodPost {
+			c.Next()
+			return
+		}
+		a.enforceTools(c, token)
+	}
+}
+
+// match returns the token an Authorization header carries, comparing in
+// constant time
+func (a *authenticator) match(header string) *bearerToken {
+	value, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return nil
+	}
+	var found *bearerToken
+	for i := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(value), a.tokens[i].value) == 1 {
+			found = &a.tokens[i]
+		}
+	}
+	return found
+}
+
+// enforceTools refuses tools/call for tools outside the token's allowlist
+// and removes them from tools/list results. Resources are only available
+// to tokens that may use read_file.
+func (a *authenticator) enforceTools(c *gin.Context, token *bearerToken) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var request struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params struct {
+			Name string `json:"name"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "request must be a single JSON-RPC message"})
+		return
+	}
+
+	forbid := func(message string) {
+		log.Printf("Token %s: %s", token.name, message)
+		c.AbortWithStatusJSON(http.StatusOK, gin.H{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"error":   gin.H{"code": errCodeForbidden, "message": message},
+		})
+	}
+
+	switch request.Method {
+	case "tools/call":
+		if !token.tools[request.Params.Name] {
+			forbid(fmt.Sprintf("tool %q is not allowed for this token", request.Params.Name))
+			return
+		}
+		c.Next()
+	case "resources/list", "resources/read", "resources/templates/list":
+		// Resources expose the same files as read_file
+		if !token.tools["read_file"] {
+			forbid("resources are not allowed for this token")
+			return
+		}
+		c.Next()
+	case "tools/list":
+		// Hold the response back so the tool list can be filtered
+		writer := &bufferedWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+		c.Writer.Write(filterToolList(writer.body.Bytes(), token.tools))
+	default:
+		c.Next()
+	}
+}
+
+// filterToolList removes tools that aren't allowed from a tools/list
+// response. Anything it can't parse is passed through unchanged.
+func filterToolList(body []byte, allowed map[string]bool) []byte {
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(body, &response); err != nil || response["result"] == nil {
+		return body
+	}
+	var result map[string]json.RawMessage
+	if err := json.Unmarshal(response["result"], &result); err != nil {
+		return body
+	}
+	var tools []json.RawMessage
+	if err := json.Unmarshal(result["tools"], &tools); err != nil {
+		return body
+	}
+
+	kept := []json.RawMessage{}
+	for _, tool := range tools {
+		var named struct {
+			Name string `json:"name"`
+		}
+		if json.Unmarshal(tool, &named) == nil && allowed[named.Name] {
+			kept = append(kept, tool)
+		}
+	}
+	result["tools"], _ = json.Marshal(kept)
+	response["result"], _ = json.Marshal(result)
+	filtered, err := json.Marshal(response)
+	if err != nil {
+		return body
+	}
+	return filtered
+}
+
+// bufferedWriter captures a response body instead of sending it
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// isLoopback reports whether a listen address only accepts local connections
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ServerConfig holds the server settings. Values come from the defaults,
+// then the -config file, then command line flags.
+type ServerConfig struct {
+	Transport       string          `json:"transport,omitempty"`        // "http" or "stdio"
+	Addr            string          `json:"addr,omitempty"`             // Listen address
+	Endpoint        string          `json:"endpoint,omitempty"`         // MCP endpoint path
+	Name            string          `json:"name,omitempty"`             // Server name reported to clients
+	Version         string          `json:"version,omitempty"`          // Server version reported to clients
+	Instructions    string          `json:"instructions,omitempty"`     // Instructions reported to clients
+	ShutdownTimeout Duration        `json:"shutdown_timeout,omitempty"` // How long to wait for in-flight calls on shutdown
+	Tools           ToolsConfig     `json:"tools"`
+	Resources       ResourcesConfig `json:"resources"`
+	Prompts         PromptsConfig   `json:"prompts"`
+	Auth            AuthConfig      `json:"auth"` // Tokens and origins accepted over HTTP
+	TLS             TLSConfig       `json:"tls"`  // HTTPS and client certificates
+	Telemetry       TelemetryConfig `json:"telemetry"`
+}
+
+// ToolsConfig enables the tool modules and holds their settings
+type ToolsConfig struct {
+	Time       TimeConfig       `json:"time"`
+	Filesystem FilesystemConfig `json:"filesystem"`
+	Shell      ShellConfig      `json:"shell"`
+	Fetch      FetchConfig      `json:"fetch"`
+}
+
+// toolModules lists the module names accepted by -tools
+var toolModules = []string{"time", "filesystem", "shell", "fetch"}
+
+// Duration is a time.Duration written as a string such as "30s" or "5m"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// defaultServerConfig returns the built-in settings
+func defaultServerConfig() *ServerConfig {
+	return &ServerConfig{
+		Transport:       "http",
+		Addr:            "127.0.0.1:8081",
+		Endpoint:        "/mcp",
+		Name:            "mcp-golang-stateless-http-example",
+		Version:         "0.0.1",
+		Instructions:    "A simple example of a stateless HTTP server using mcp-golang",
+		ShutdownTimeout: Duration(30 * time.Second),
+		Tools: ToolsConfig{
+			Time: TimeConfig{Enabled: true},
+			Filesystem: FilesystemConfig{
+				Enabled:     true,
+				Root:        ".",
+				ReadOnly:    true, // write_file needs read_only set to false
+				MaxFileSize: 1 << 20,
+			},
+			Shell: ShellConfig{
+				Enabled:    true,
+				Timeout:    Duration(30 * time.Second),
+				MaxTimeout: Duration(5 * time.Minute),
+				MaxOutput:  64 << 10,
+			},
+			Fetch: FetchConfig{
+				Enabled:  true,
+				Timeout:  Duration(30 * time.Second),
+				MaxBytes: 256 << 10,
+			},
+		},
+		Resources: ResourcesConfig{
+			MaxFiles: 1000,
+		},
+		Prompts: PromptsConfig{Enabled: true},
+		Telemetry: TelemetryConfig{
+			LogFormat: "json",
+			Metrics:   true,
+		},
+	}
+}
+
+// loadFile layers a JSON config file over cfg. Only keys present in the
+// file change. Relative paths are resolved against the file's directory.
+func (cfg *ServerConfig) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	before := *cfg
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	for _, p := range []struct{ value, previous *string }{
+		{&cfg.Tools.Filesystem.Root, &before.Tools.Filesystem.Root},
+		{&cfg.Tools.Shell.Dir, &before.Tools.Shell.Dir},
+		{&cfg.TLS.CertFile, &before.TLS.CertFile},
+		{&cfg.TLS.KeyFile, &before.TLS.KeyFile},
+		{&cfg.TLS.ClientCAFile, &before.TLS.ClientCAFile},
+	} {
+		if *p.value != *p.previous && *p.value != "" && !filepath.IsAbs(*p.value) {
+			*p.value = filepath.Join(dir, *p.value)
+		}
+	}
+	return nil
+}
+
+// enableOnly enables exactly the named tool modules
+func (cfg *ServerConfig) enableOnly(modules []string) error {
+	enabled := make(map[string]bool)
+	for _, name := range modules {
+		known := false
+		for _, module := range toolModules {
+			known = known || module == name
+		}
+		if !known {
+			return fmt.Errorf("unknown tool module %q (available: %s)", name, strings.Join(toolModules, ", "))
+		}
+		enabled[name] = true
+	}
+	cfg.Tools.Time.Enabled = enabled["time"]
+	cfg.Tools.Filesystem.Enabled = enabled["filesystem"]
+	cfg.Tools.Shell.Enabled = enabled["shell"]
+	cfg.Tools.Fetch.Enabled = enabled["fetch"]
+	return nil
+}
+
+// validate checks settings that can't be checked while decoding
+func (cfg *ServerConfig) validate() error {
+	switch cfg.Transport {
+	case "http":
+		if cfg.Addr == "" {
+			return fmt.Errorf("addr is required")
+		}
+		// Anyone who can reach the address could use the tools
+		if !isLoopback(cfg.Addr) && len(cfg.Auth.Tokens) == 0 && cfg.TLS.ClientCAFile == "" {
+			return fmt.Errorf("addr %s is not a loopback address; listening on it needs auth.tokens or tls.client_ca_file", cfg.Addr)
+		}
+		if !strings.HasPrefix(cfg.Endpoint, "/") {
+			return fmt.Errorf("endpoint must start with '/'")
+		}
+		if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+			return fmt.Errorf("tls.cert_file and tls.key_file must be set together")
+		}
+		if cfg.TLS.ClientCAFile != "" && cfg.TLS.CertFile == "" {
+			return fmt.Errorf("tls.client_ca_file requires tls.cert_file and tls.key_file")
+		}
+		if cfg.Telemetry.Metrics && cfg.Telemetry.MetricsAddr == "" && cfg.Endpoint == "/metrics" {
+			return fmt.Errorf("endpoint can't be /metrics while metrics are served on the same address")
+		}
+	case "stdio":
+	default:
+		return fmt.Errorf("transport must be \"http\" or \"stdio\"")
+	}
+	if cfg.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if cfg.Tools.Shell.Enabled && cfg.Tools.Shell.Timeout <= 0 {
+		return fmt.Errorf("tools.shell.timeout must be positive")
+	}
+	if cfg.Tools.Fetch.Enabled && cfg.Tools.Fetch.MaxBytes <= 0 {
+		return fmt.Errorf("tools.fetch.max_bytes must be positive")
+	}
+	if cfg.Telemetry.LogFormat != "json" && cfg.Telemetry.LogFormat != "text" {
+		return fmt.Errorf("telemetry.log_format must be \"json\" or \"text\"")
+	}
+	if cfg.Resources.Enabled && cfg.Resources.MaxFiles <= 0 {
+		return fmt.Errorf("resources.max_files must be positive")
+	}
+	return nil
+}
+
+// redacted returns a copy of the settings without token values, for
+// showing to clients
+func (cfg *ServerConfig) redacted() ServerConfig {
+	copied := *cfg
+	copied.Auth.Tokens = make([]TokenConfig, len(cfg.Auth.Tokens))
+	for i, token := range cfg.Auth.Tokens {
+		if token.Token != "" {
+			token.Token = "[redacted]"
+		}
+		copied.Auth.Tokens[i] = token
+	}
+	return copied
+}
+
+// enabledModules lists the enabled tool modules for logging
+func (cfg *ServerConfig) enabledModules() []string {
+	var modules []string
+	if cfg.Tools.Time.Enabled {
+		modules = append(modules, "time")
+	}
+	if cfg.Tools.Filesystem.Enabled {
+		modules = append(modules, "filesystem")
+	}
+	if cfg.Tools.Shell.Enabled && len(cfg.Tools.Shell.Allow) > 0 {
+		modules = append(modules, "shell")
+	}
+	if cfg.Tools.Fetch.Enabled && len(cfg.Tools.Fetch.AllowedHosts) > 0 {
+		modules = append(modules, "fetch")
+	}
+	return modules
+}
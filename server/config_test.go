@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(cfg *ServerConfig)
+		wantErr string
+	}{
+		{name: "defaults", modify: func(cfg *ServerConfig) {}},
+		{name: "zero max_bytes", modify: func(cfg *ServerConfig) { cfg.Tools.Fetch.MaxBytes = 0 }, wantErr: "max_bytes must be positive"},
+		{name: "negative max_bytes", modify: func(cfg *ServerConfig) { cfg.Tools.Fetch.MaxBytes = -1 }, wantErr: "max_bytes must be positive"},
+		{name: "max_bytes unused when fetch is off", modify: func(cfg *ServerConfig) {
+			cfg.Tools.Fetch.Enabled = false
+			cfg.Tools.Fetch.MaxBytes = -1
+		}},
+		{name: "zero shell timeout", modify: func(cfg *ServerConfig) { cfg.Tools.Shell.Timeout = 0 }, wantErr: "timeout must be positive"},
+		{name: "all interfaces without auth", modify: func(cfg *ServerConfig) { cfg.Addr = ":8081" }, wantErr: "not a loopback address"},
+		{name: "public address without auth", modify: func(cfg *ServerConfig) { cfg.Addr = "192.0.2.1:8081" }, wantErr: "not a loopback address"},
+		{name: "localhost", modify: func(cfg *ServerConfig) { cfg.Addr = "localhost:8081" }},
+		{name: "IPv6 loopback", modify: func(cfg *ServerConfig) { cfg.Addr = "[::1]:8081" }},
+		{name: "all interfaces with tokens", modify: func(cfg *ServerConfig) {
+			cfg.Addr = ":8081"
+			cfg.Auth.Tokens = []TokenConfig{{Name: "ci", Token: "secret"}}
+		}},
+		{name: "all interfaces with client certificates", modify: func(cfg *ServerConfig) {
+			cfg.Addr = ":8081"
+			cfg.TLS = TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", ClientCAFile: "ca.pem"}
+		}},
+		{name: "stdio ignores addr", modify: func(cfg *ServerConfig) {
+			cfg.Transport = "stdio"
+			cfg.Addr = ":8081"
+		}},
+		{name: "unknown transport", modify: func(cfg *ServerConfig) { cfg.Transport = "udp" }, wantErr: "transport must be"},
+		{name: "cert without key", modify: func(cfg *ServerConfig) { cfg.TLS.CertFile = "cert.pem" }, wantErr: "must be set together"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultServerConfig()
+			tt.modify(cfg)
+			err := cfg.validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatal(err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,40 +1,148 @@
 package main
 
 import (
+	"flag"
 	"log"
-	"time"
+	"os"
+	"strings"
 
 	mcp_golang "github.com/metoro-io/mcp-golang"
-	"github.com/metoro-io/mcp-golang/transport/http"
 )
 
-// TimeArgs defines the arguments for the time tool
-type TimeArgs struct {
-	Format string `json:"format" jsonschema:"description=The time format to use"`
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// registerTools registers the enabled tool modules
+func registerTools(server *mcp_golang.Server, tools ToolsConfig) error {
+	if err := registerTimeTools(server, tools.Time); err != nil {
+		return err
+	}
+	if err := registerFilesystemTools(server, tools.Filesystem); err != nil {
+		return err
+	}
+	if tools.Shell.Dir == "" {
+		tools.Shell.Dir = tools.Filesystem.Root
+	}
+	if err := registerShellTools(server, tools.Shell); err != nil {
+		return err
+	}
+	return registerFetchTools(server, tools.Fetch)
 }
 
 func main() {
-	// Create an HTTP transport that listens on /mcp endpoint
-	transport := http.NewHTTPTransport("/mcp").WithAddr(":8081")
-
-	// Create a new server with the transport
-	server := mcp_golang.NewServer(
-		transport,
-		mcp_golang.WithName("mcp-golang-stateless-http-example"),
-		mcp_golang.WithInstructions("A simple example of a stateless HTTP server using mcp-golang"),
-		mcp_golang.WithVersion("0.0.1"),
-	)
-
-	// Register a simple tool
-	err := server.RegisterTool("time", "Returns the current time in the specified format", func(args TimeArgs) (*mcp_golang.ToolResponse, error) {
-		format := args.Format
-		return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(time.Now().Format(format))), nil
+	var flags struct {
+		config        string
+		transport     string
+		addr          string
+		endpoint      string
+		name          string
+		version       string
+		instructions  string
+		tools         string
+		root          string
+		readOnly      bool
+		allowCommands string
+		allowHosts    string
+		tlsCert       string
+		tlsKey        string
+		tlsClientCA   string
+		logFormat     string
+		metricsAddr   string
+		otlpEndpoint  string
+	}
+	defaults := defaultServerConfig()
+	flag.StringVar(&flags.config, "config", "", "Path to a JSON config file")
+	flag.StringVar(&flags.transport, "transport", defaults.Transport, "Transport to serve on: http or stdio")
+	flag.StringVar(&flags.addr, "addr", defaults.Addr, "Address to listen on")
+	flag.StringVar(&flags.endpoint, "endpoint", defaults.Endpoint, "MCP endpoint path")
+	flag.StringVar(&flags.name, "name", defaults.Name, "Server name reported to clients")
+	flag.StringVar(&flags.version, "version", defaults.Version, "Server version reported to clients")
+	flag.StringVar(&flags.instructions, "instructions", defaults.Instructions, "Instructions reported to clients")
+	flag.StringVar(&flags.tools, "tools", "", "Comma-separated tool modules to enable: "+strings.Join(toolModules, ", ")+" (default: all)")
+	flag.StringVar(&flags.root, "root", defaults.Tools.Filesystem.Root, "Directory the file and command tools are confined to")
+	flag.BoolVar(&flags.readOnly, "read-only", true, "Leave out the write_file tool; -read-only=false registers it")
+	flag.StringVar(&flags.allowCommands, "allow-commands", "", "Comma-separated commands run_command may run (run_command is disabled if empty)")
+	flag.StringVar(&flags.allowHosts, "allow-hosts", "", "Comma-separated hosts http_fetch may fetch, e.g. example.com,*.example.org (http_fetch is disabled if empty)")
+	flag.StringVar(&flags.tlsCert, "tls-cert", "", "TLS certificate file; serves HTTPS when set with -tls-key")
+	flag.StringVar(&flags.tlsKey, "tls-key", "", "TLS private key file")
+	flag.StringVar(&flags.tlsClientCA, "tls-client-ca", "", "CA file for verifying client certificates (enables mTLS)")
+	flag.StringVar(&flags.logFormat, "log-format", defaults.Telemetry.LogFormat, "Log format: json or text")
+	flag.StringVar(&flags.metricsAddr, "metrics-addr", "", "Serve Prometheus metrics on this address instead of the MCP one")
+	flag.StringVar(&flags.otlpEndpoint, "otlp-endpoint", "", "OTLP/HTTP endpoint to export trace spans to, e.g. http://localhost:4318")
+	flag.Parse()
+
+	// In stdio mode stdout carries JSON-RPC, so logs must only go to stderr
+	log.SetOutput(os.Stderr)
+
+	// Layer the config file and then explicitly set flags over the defaults
+	cfg := defaultServerConfig()
+	if flags.config != "" {
+		if err := cfg.loadFile(flags.config); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var flagErr error
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "transport":
+			cfg.Transport = flags.transport
+		case "addr":
+			cfg.Addr = flags.addr
+		case "endpoint":
+			cfg.Endpoint = flags.endpoint
+		case "name":
+			cfg.Name = flags.name
+		case "version":
+			cfg.Version = flags.version
+		case "instructions":
+			cfg.Instructions = flags.instructions
+		case "tools":
+			flagErr = cfg.enableOnly(splitList(flags.tools))
+		case "root":
+			cfg.Tools.Filesystem.Root = flags.root
+		case "read-only":
+			cfg.Tools.Filesystem.ReadOnly = flags.readOnly
+		case "allow-commands":
+			cfg.Tools.Shell.Allow = splitList(flags.allowCommands)
+		case "allow-hosts":
+			cfg.Tools.Fetch.AllowedHosts = splitList(flags.allowHosts)
+		case "tls-cert":
+			cfg.TLS.CertFile = flags.tlsCert
+		case "tls-key":
+			cfg.TLS.KeyFile = flags.tlsKey
+		case "tls-client-ca":
+			cfg.TLS.ClientCAFile = flags.tlsClientCA
+		case "log-format":
+			cfg.Telemetry.LogFormat = flags.logFormat
+		case "metrics-addr":
+			cfg.Telemetry.MetricsAddr = flags.metricsAddr
+		case "otlp-endpoint":
+			cfg.Telemetry.OTLPEndpoint = flags.otlpEndpoint
+		}
 	})
+	if flagErr != nil {
+		log.Fatal(flagErr)
+	}
+	if err := cfg.validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	flushTelemetry, err := setupTelemetry(cfg)
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
+	defer flushTelemetry()
 
-	// Start the server
-	log.Println("Starting HTTP server on :8081...")
-	server.Serve()
+	if cfg.Transport == "stdio" {
+		serveStdio(cfg)
+	} else {
+		serveHTTP(cfg)
+	}
 }
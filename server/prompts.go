@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	mcp_golang "github.com/metoro-io/mcp-golang"
+)
+
+// PromptsConfig configures the prompt library
+type PromptsConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+// CodeReviewArgs defines the arguments for the code-review prompt. Prompt
+// arguments may only be strings, and descriptions can't contain commas.
+type CodeReviewArgs struct {
+	Code     string  `json:"code" jsonschema:"required,description=The code to review"`
+	Language *string `json:"language" jsonschema:"description=Programming language of the code"`
+	Focus    *string `json:"focus" jsonschema:"description=What to concentrate on such as security or performance"`
+}
+
+// ExplainDiffArgs defines the arguments for the explain-diff prompt
+type ExplainDiffArgs struct {
+	Diff     string  `json:"diff" jsonschema:"required,description=Unified diff to explain"`
+	Audience *string `json:"audience" jsonschema:"description=Who the explanation is for such as reviewers or release notes"`
+}
+
+// registerPrompts registers the reusable prompt templates
+func registerPrompts(server *mcp_golang.Server, config PromptsConfig) error {
+	if !config.Enabled {
+		return nil
+	}
+	if err := server.RegisterPrompt("code-review", "Review code for bugs, readability and maintainability", codeReviewPrompt); err != nil {
+		return err
+	}
+	return server.RegisterPrompt("explain-diff", "Explain what a diff changes and why it matters", explainDiffPrompt)
+}
+
+func codeReviewPrompt(args CodeReviewArgs) (*mcp_golang.PromptResponse, error) {
+	if strings.TrimSpace(args.Code) == "" {
+		return nil, fmt.Errorf("code is required")
+	}
+	var text strings.Builder
+	text.WriteString("Review the following code. Point out bugs, unclear naming, missing error handling and anything that will be hard to maintain. ")
+	text.WriteString("For each issue give the location, why it matters and a suggested fix. Say so if the code looks good.\n")
+	if args.Focus != nil && *args.Focus != "" {
+		fmt.Fprintf(&text, "Concentrate on %s.\n", *args.Focus)
+	}
+	language := ""
+	if args.Language != nil {
+		language = *args.Language
+	}
+	fmt.Fprintf(&text, "\n```%s\n%s\n```\n", language, strings.TrimRight(args.Code, "\n"))
+	return mcp_golang.NewPromptResponse("Code review", mcp_golang.NewPromptMessage(mcp_golang.NewTextContent(text.String()), mcp_golang.RoleUser)), nil
+}
+
+func explainDiffPrompt(args ExplainDiffArgs) (*mcp_golang.PromptResponse, error) {
+	if strings.TrimSpace(args.Diff) == "" {
+		return nil, fmt.Errorf("diff is required")
+	}
+	var text strings.Builder
+	text.WriteString("Explain the following diff. Summarise what it changes, then go through the changes file by file, ")
+	text.WriteString("noting behaviour changes, risks and anything a reviewer should check.\n")
+	if args.Audience != nil && *args.Audience != "" {
+		fmt.Fprintf(&text, "Write for %s.\n", *args.Audience)
+	}
+	fmt.Fprintf(&text, "\n```diff\n%s\n```\n", strings.TrimRight(args.Diff, "\n"))
+	return mcp_golang.NewPromptResponse("Diff explanation", mcp_golang.NewPromptMessage(mcp_golang.NewTextContent(text.String()), mcp_golang.RoleUser)), nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	mcp_golang "github.com/metoro-io/mcp-golang"
+)
+
+// ResourcesConfig configures the project files and settings exposed as MCP
+// resources. Files come from the filesystem root.
+type ResourcesConfig struct {
+	Enabled  bool     `json:"enabled"`             // Lists project files to every client; off by default
+	Patterns []string `json:"patterns,omitempty"`  // Globs matched against file names, e.g. "*.go"; all text files if empty
+	MaxFiles int      `json:"max_files,omitempty"` // Files listed at most
+}
+
+// configResourceURI is the resource holding the server's settings
+const configResourceURI = "config://server"
+
+// registerResources registers a resource for each text file under the
+// filesystem root, and one for the server's settings, when resources are
+// enabled. Files are listed once, at startup, and read when a client asks
+// for them.
+func registerResources(server *mcp_golang.Server, cfg *ServerConfig) error {
+	config := cfg.Resources
+	if !config.Enabled {
+		return nil
+	}
+
+	settings, err := json.MarshalIndent(cfg.redacted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	err = server.RegisterResource(configResourceURI, "server-config", "The settings this server is running with", "application/json", func() (*mcp_golang.ResourceResponse, error) {
+		return mcp_golang.NewResourceResponse(mcp_golang.NewTextEmbeddedResource(configResourceURI, string(settings), "application/json")), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	files, err := newFileTools(cfg.Tools.Filesystem)
+	if err != nil {
+		return err
+	}
+	names, err := files.resourceFiles(config)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := files.registerFileResource(server, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resourceFiles lists the text files under the root that match the
+// patterns. Hidden directories are skipped, and so are hidden files such as
+// .env unless a pattern starting with a dot names them.
+func (t *fileTools) resourceFiles(config ResourcesConfig) ([]string, error) {
+	var names []string
+	err := fs.WalkDir(t.root.FS(), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip unreadable entries
+		}
+		hidden := strings.HasPrefix(d.Name(), ".") && p != "."
+		if d.IsDir() {
+			if hidden || d.Name() == "node_modules" {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if hidden && !matchesHidden(config.Patterns, d.Name()) {
+			return nil
+		}
+		if !d.Type().IsRegular() || !matchesAny(config.Patterns, d.Name()) || !t.looksLikeText(p) {
+			return nil
+		}
+		if len(names) >= config.MaxFiles {
+			log.Printf("Listing only the first %d files as resources", config.MaxFiles)
+			return fs.SkipAll
+		}
+		names = append(names, p)
+		return nil
+	})
+	return names, err
+}
+
+// registerFileResource registers one file, identified by its file:// URI
+func (t *fileTools) registerFileResource(server *mcp_golang.Server, name string) error {
+	uri := (&url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(t.rootPath, name))}).String()
+	mimeType := mime.TypeByExtension(path.Ext(name))
+	if mimeType == "" {
+		mimeType = "text/plain"
+	}
+	return server.RegisterResource(uri, name, fmt.Sprintf("Project file %s", name), mimeType, func() (*mcp_golang.ResourceResponse, error) {
+		text, err := t.readText(name)
+		if err != nil {
+			return nil, err
+		}
+		return mcp_golang.NewResourceResponse(mcp_golang.NewTextEmbeddedResource(uri, text, mimeType)), nil
+	})
+}
+
+// looksLikeText reports whether a file is within the size limit and its
+// start doesn't look binary
+func (t *fileTools) looksLikeText(name string) bool {
+	info, err := t.root.Stat(name)
+	if err != nil || (t.config.MaxFileSize > 0 && info.Size() > t.config.MaxFileSize) {
+		return false
+	}
+	f, err := t.root.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 8000)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false
+	}
+	return !isBinary(head[:n])
+}
+
+// matchesHidden reports whether a pattern that starts with a dot matches
+// name, so "*" never matches .env but ".env.example" does
+func matchesHidden(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, ".") {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesAny reports whether name matches one of the glob patterns, or
+// whether there are no patterns
+func matchesAny(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/metoro-io/mcp-golang/transport"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TelemetryConfig configures request logging, Prometheus metrics and
+// OpenTelemetry tracing
+type TelemetryConfig struct {
+	LogFormat    string `json:"log_format,omitempty"`    // "json" or "text"
+	Metrics      bool   `json:"metrics"`                 // Serve Prometheus metrics at /metrics
+	MetricsAddr  string `json:"metrics_addr,omitempty"`  // Serve metrics on their own address instead of the MCP one; needed with stdio
+	OTLPEndpoint string `json:"otlp_endpoint,omitempty"` // OTLP/HTTP collector for trace spans, e.g. http://localhost:4318
+}
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcp_requests_total",
+		Help: "JSON-RPC requests answered, by method and status (ok, error or tool_error).",
+	}, []string{"method", "status"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mcp_request_duration_seconds",
+		Help:    "Time taken to answer JSON-RPC requests, by method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+	requestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "mcp_requests_in_flight",
+		Help: "JSON-RPC requests that haven't been answered yet.",
+	})
+	toolCallsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcp_tool_calls_total",
+		Help: "Tool calls, by tool and status (ok or tool_error).",
+	}, []string{"tool", "status"})
+	toolCallDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mcp_tool_call_duration_seconds",
+		Help:    "Time taken by tool calls, by tool.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"tool"})
+)
+
+// mcpMethods are the methods that get their own metric labels. Anything
+// else a client sends is counted as "other".
+var mcpMethods = map[string]bool{
+	"initialize": true, "ping": true,
+	"tools/list": true, "tools/call": true,
+	"resources/list": true, "resources/read": true, "resources/templates/list": true,
+	"prompts/list": true, "prompts/get": true,
+}
+
+var tracer = otel.Tracer("herlein.com/server")
+
+// setupTelemetry sets the log format and the trace exporter. Spans are
+// always created, so request logs carry trace IDs, but they are only
+// exported when an OTLP endpoint is configured here or through the standard
+// OTEL_EXPORTER_OTLP_* variables. The returned function flushes spans that
+// haven't been exported yet.
+func setupTelemetry(cfg *ServerConfig) (func(), error) {
+	if cfg.Telemetry.LogFormat == "json" {
+		// log.Printf goes through the default slog handler too
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	}
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", cfg.Name),
+			attribute.String("service.version", cfg.Version),
+		)),
+	}
+	endpoint := cfg.Telemetry.OTLPEndpoint
+	if endpoint != "" || os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		var exporterOptions []otlptracehttp.Option
+		if endpoint != "" {
+			exporterOptions = append(exporterOptions, otlptracehttp.WithEndpointURL(endpoint))
+		}
+		exporter, err := otlptracehttp.New(context.Background(), exporterOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create trace exporter: %v", err)
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			log.Printf("Failed to flush trace spans: %v", err)
+		}
+	}, nil
+}
+
+// serveMetrics serves /metrics on its own address until the process exits
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	log.Printf("Serving metrics on http://%s/metrics", addr)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Metrics server failed: %v", err)
+		}
+	}()
+}
+
+// pendingRequest is a request that hasn't been answered yet
+type pendingRequest struct {
+	method string
+	tool   string
+	client string // Token name, for HTTP requests with a token
+	start  time.Time
+	span   trace.Span
+}
+
+// telemetryTransport logs, measures and traces every JSON-RPC request, and
+// counts requests that haven't been answered yet. The library handles each
+// request in its own goroutine, so counting is the only way to know when it
+// is safe to exit.
+type telemetryTransport struct {
+	transport.Transport
+	inFlight atomic.Int64
+
+	mu      sync.Mutex
+	pending map[transport.RequestId]*pendingRequest
+}
+
+func newTelemetryTransport(t transport.Transport) *telemetryTransport {
+	return &telemetryTransport{Transport: t, pending: make(map[transport.RequestId]*pendingRequest)}
+}
+
+func (t *telemetryTransport) SetMessageHandler(handler func(ctx context.Context, message *transport.BaseJsonRpcMessage)) {
+	t.Transport.SetMessageHandler(func(ctx context.Context, message *transport.BaseJsonRpcMessage) {
+		if message.Type == transport.BaseMessageTypeJSONRPCRequestType {
+			ctx = t.begin(ctx, message.JsonRpcRequest)
+		}
+		handler(ctx, message)
+	})
+}
+
+func (t *telemetryTransport) Send(ctx context.Context, message *transport.BaseJsonRpcMessage) error {
+	switch message.Type {
+	case transport.BaseMessageTypeJSONRPCResponseType:
+		t.end(message.JsonRpcResponse.Id, message.JsonRpcResponse.Result, nil)
+	case transport.BaseMessageTypeJSONRPCErrorType:
+		t.end(message.JsonRpcError.Id, nil, &message.JsonRpcError.Error)
+	}
+	return t.Transport.Send(ctx, message)
+}
+
+// begin starts a span for a request, continuing the client's trace, and
+// remembers the request until it is answered
+func (t *telemetryTransport) begin(ctx context.Context, request *transport.BaseJSONRPCRequest) context.Context {
+	var params struct {
+		Name string         `json:"name"`
+		Meta map[string]any `json:"_meta"`
+	}
+	// Params are optional and their shape depends on the method
+	json.Unmarshal(request.Params, &params)
+
+	p := &pendingRequest{method: request.Method, start: time.Now()}
+	if request.Method == "tools/call" {
+		p.tool = params.Name
+	}
+
+	// Clients put the trace context in _meta, as HTTP headers can't carry
+	// it over stdio. Over HTTP, headers are used when _meta has none.
+	carrier := propagation.MapCarrier{}
+	for key, value := range params.Meta {
+		if s, ok := value.(string); ok {
+			carrier[key] = s
+		}
+	}
+	var textCarrier propagation.TextMapCarrier = carrier
+	if c, ok := ctx.Value("ginContext").(*gin.Context); ok {
+		if carrier.Get("traceparent") == "" {
+			textCarrier = propagation.HeaderCarrier(c.Request.Header)
+		}
+		p.client = c.GetString(tokenNameKey)
+	}
+	ctx = otel.GetTextMapPropagator().Extract(ctx, textCarrier)
+
+	name := request.Method
+	attributes := []attribute.KeyValue{
+		attribute.String("rpc.system", "jsonrpc"),
+		attribute.String("mcp.method.name", request.Method),
+	}
+	if p.tool != "" {
+		name += " " + p.tool
+		attributes = append(attributes, attribute.String("gen_ai.tool.name", p.tool))
+	}
+	ctx, p.span = tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attributes...))
+
+	t.mu.Lock()
+	t.pending[request.Id] = p
+	t.mu.Unlock()
+	t.inFlight.Add(1)
+	requestsInFlight.Inc()
+	return ctx
+}
+
+// end logs and records a request when its response is sent
+func (t *telemetryTransport) end(id transport.RequestId, result json.RawMessage, rpcErr *transport.BaseJSONRPCErrorInner) {
+	t.mu.Lock()
+	p := t.pending[id]
+	delete(t.pending, id)
+	t.mu.Unlock()
+	if p == nil {
+		// Errors for unparseable messages answer nothing we counted
+		return
+	}
+	t.inFlight.Add(-1)
+	requestsInFlight.Dec()
+	elapsed := time.Since(p.start)
+
+	status, message := "ok", ""
+	switch {
+	case rpcErr != nil:
+		status, message = "error", rpcErr.Message
+	case p.tool != "":
+		if text, failed := toolError(result); failed {
+			status, message = "tool_error", text
+		}
+	}
+
+	method := p.method
+	if !mcpMethods[method] {
+		method = "other"
+	}
+	requestsTotal.WithLabelValues(method, status).Inc()
+	requestDuration.WithLabelValues(method).Observe(elapsed.Seconds())
+	// Unknown tools are JSON-RPC errors, so only real tools get a label
+	if p.tool != "" && rpcErr == nil {
+		toolCallsTotal.WithLabelValues(p.tool, status).Inc()
+		toolCallDuration.WithLabelValues(p.tool).Observe(elapsed.Seconds())
+	}
+
+	if message != "" {
+		p.span.SetStatus(codes.Error, message)
+	}
+	p.span.End()
+
+	attrs := []any{"method", p.method}
+	if p.tool != "" {
+		attrs = append(attrs, "tool", p.tool)
+	}
+	attrs = append(attrs, "status", status, "duration_ms", float64(elapsed.Microseconds())/1000)
+	if message != "" {
+		attrs = append(attrs, "error", message)
+	}
+	if p.client != "" {
+		attrs = append(attrs, "client", p.client)
+	}
+	if span := p.span.SpanContext(); span.IsValid() {
+		attrs = append(attrs, "trace_id", span.TraceID().String(), "span_id", span.SpanID().String())
+	}
+	level := slog.LevelInfo
+	if status != "ok" {
+		level = slog.LevelWarn
+	}
+	slog.Log(context.Background(), level, "request", attrs...)
+}
+
+// toolError returns the text of a tool result that reports an error
+func toolError(result json.RawMessage) (string, bool) {
+	var response struct {
+		IsError bool `json:"isError"`
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	if json.Unmarshal(result, &response) != nil || !response.IsError {
+		return "", false
+	}
+	if len(response.Content) == 0 {
+		return "tool error", true
+	}
+	return response.Content[0].Text, true
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	mcp_golang "github.com/metoro-io/mcp-golang"
+)
+
+// FilesystemConfig configures the sandboxed file tools
+type FilesystemConfig struct {
+	Enabled     bool   `json:"enabled"`
+	Root        string `json:"root,omitempty"`          // Directory the tools are confined to
+	ReadOnly    bool   `json:"read_only"`               // Leave out write_file; on by default
+	MaxFileSize int64  `json:"max_file_size,omitempty"` // Largest file read_file, write_file and search will handle
+}
+
+// ReadFileArgs defines the arguments for the read_file tool
+type ReadFileArgs struct {
+	Path   string `json:"path" jsonschema:"required,description=File path relative to the sandbox root"`
+	Offset int    `json:"offset,omitempty" jsonschema:"description=First line to return (1-based); defaults to the start of the file"`
+	Limit  int    `json:"limit,omitempty" jsonschema:"description=Maximum number of lines to return; defaults to the whole file"`
+}
+
+// ListDirArgs defines the arguments for the list_dir tool
+type ListDirArgs struct {
+	Path       string `json:"path,omitempty" jsonschema:"description=Directory path relative to the sandbox root; defaults to the root"`
+	Recursive  bool   `json:"recursive,omitempty" jsonschema:"description=List subdirectories recursively"`
+	MaxEntries int    `json:"max_entries,omitempty" jsonschema:"description=Maximum number of entries to return (default 1000)"`
+}
+
+// WriteFileArgs defines the arguments for the write_file tool
+type WriteFileArgs struct {
+	Path    string `json:"path" jsonschema:"required,description=File path relative to the sandbox root; parent directories are created"`
+	Content string `json:"content" jsonschema:"required,description=Content to write"`
+	Append  bool   `json:"append,omitempty" jsonschema:"description=Append to the file instead of replacing it"`
+}
+
+// SearchArgs defines the arguments for the search tool
+type SearchArgs struct {
+	Pattern    string `json:"pattern" jsonschema:"required,description=Regular expression (RE2 syntax) to search for"`
+	Path       string `json:"path,omitempty" jsonschema:"description=Directory or file to search relative to the sandbox root; defaults to the root"`
+	Glob       string `json:"glob,omitempty" jsonschema:"description=Only search files whose name matches this glob (e.g. *.go)"`
+	IgnoreCase bool   `json:"ignore_case,omitempty" jsonschema:"description=Match case-insensitively"`
+	MaxResults int    `json:"max_results,omitempty" jsonschema:"description=Maximum number of matching lines to return (default 100)"`
+}
+
+const (
+	defaultMaxEntries = 1000
+	defaultMaxResults = 100
+)
+
+// fileTools implements the filesystem tools on top of an os.Root, which
+// refuses any path, including via symlinks, that resolves outside the root
+type fileTools struct {
+	root     *os.Root
+	rootPath string
+	config   FilesystemConfig
+}
+
+// registerFilesystemTools registers read_file, list_dir, search and, unless
+// the config is read-only, write_file, when the module is enabled
+func registerFilesystemTools(server *mcp_golang.Server, config FilesystemConfig) error {
+	if !config.Enabled {
+		return nil
+	}
+	t, err := newFileTools(config)
+	if err != nil {
+		return err
+	}
+
+	if err := server.RegisterTool("read_file", "Reads a text file from the sandbox, optionally a range of lines", t.readFile); err != nil {
+		return err
+	}
+	if err := server.RegisterTool("list_dir", "Lists the entries of a directory in the sandbox", t.listDir); err != nil {
+		return err
+	}
+	if err := server.RegisterTool("search", "Searches files in the sandbox for lines matching a regular expression", t.search); err != nil {
+		return err
+	}
+	if !config.ReadOnly {
+		if err := server.RegisterTool("write_file", "Writes or appends to a text file in the sandbox", t.writeFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newFileTools opens the configured root
+func newFileTools(config FilesystemConfig) (*fileTools, error) {
+	rootPath, err := filepath.Abs(config.Root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filesystem root: %v", err)
+	}
+	root, err := os.OpenRoot(rootPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open filesystem root: %v", err)
+	}
+	return &fileTools{root: root, rootPath: rootPath, config: config}, nil
+}
+
+// resolve turns a tool path argument into a path relative to the root.
+// Absolute paths are accepted only if they lie inside the root.
+func (t *fileTools) resolve(name string) (string, error) {
+	if name == "" {
+		return ".", nil
+	}
+	if filepath.IsAbs(name) {
+		rel, err := filepath.Rel(t.rootPath, name)
+		if err != nil {
+			return "", fmt.Errorf("path %q is outside the sandbox", name)
+		}
+		name = rel
+	}
+	name = filepath.Clean(name)
+	if !filepath.IsLocal(name) && name != "." {
+		return "", fmt.Errorf("path %q is outside the sandbox", name)
+	}
+	return name, nil
+}
+
+func (t *fileTools) readFile(args ReadFileArgs) (*mcp_golang.ToolResponse, error) {
+	name, err := t.resolve(args.Path)
+	if err != nil {
+		return nil, err
+	}
+	if args.Offset < 0 || args.Limit < 0 {
+		return nil, fmt.Errorf("offset and limit must not be negative")
+	}
+
+	content, err := t.readText(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.Offset > 0 || args.Limit > 0 {
+		lines := strings.SplitAfter(content, "\n")
+		start := 0
+		if args.Offset > 0 {
+			start = args.Offset - 1
+		}
+		if start >= len(lines) {
+			return nil, fmt.Errorf("offset %d is past the end of the file (%d lines)", args.Offset, len(lines))
+		}
+		end := len(lines)
+		if args.Limit > 0 && start+args.Limit < end {
+			end = start + args.Limit
+		}
+		content = strings.Join(lines[start:end], "")
+	}
+	return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(content)), nil
+}
+
+// readText reads a file, refusing ones that are too large or look binary
+func (t *fileTools) readText(name string) (string, error) {
+	info, err := t.root.Stat(name)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", name)
+	}
+	if t.config.MaxFileSize > 0 && info.Size() > t.config.MaxFileSize {
+		return "", fmt.Errorf("%s is %d bytes, larger than the %d byte limit", name, info.Size(), t.config.MaxFileSize)
+	}
+	data, err := fs.ReadFile(t.root.FS(), filepath.ToSlash(name))
+	if err != nil {
+		return "", err
+	}
+	if isBinary(data) {
+		return "", fmt.Errorf("%s appears to be a binary file", name)
+	}
+	return string(data), nil
+}
+
+func (t *fileTools) listDir(args ListDirArgs) (*mcp_golang.ToolResponse, error) {
+	name, err := t.resolve(args.Path)
+	if err != nil {
+		return nil, err
+	}
+	maxEntries := args.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxEntries
+	}
+
+	var out strings.Builder
+	count := 0
+	truncated := false
+	err = fs.WalkDir(t.root.FS(), filepath.ToSlash(name), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == filepath.ToSlash(name) {
+			if !d.IsDir() {
+				return fmt.Errorf("%s is not a directory", name)
+			}
+			return nil
+		}
+		if count >= maxEntries {
+			truncated = true
+			return fs.SkipAll
+		}
+		count++
+
+		rel := p
+		if name != "." {
+			rel = strings.TrimPrefix(p, filepath.ToSlash(name)+"/")
+		}
+		if d.IsDir() {
+			out.WriteString(rel + "/\n")
+			if !args.Recursive {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			fmt.Fprintf(&out, "%s (%d bytes)\n", rel, info.Size())
+		} else {
+			out.WriteString(rel + "\n")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		out.WriteString("(empty directory)\n")
+	}
+	if truncated {
+		fmt.Fprintf(&out, "[listing truncated after %d entries]\n", maxEntries)
+	}
+	return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(out.String())), nil
+}
+
+func (t *fileTools) writeFile(args WriteFileArgs) (*mcp_golang.ToolResponse, error) {
+	if args.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	name, err := t.resolve(args.Path)
+	if err != nil {
+		return nil, err
+	}
+	if name == "." {
+		return nil, fmt.Errorf("path must name a file")
+	}
+	if t.config.MaxFileSize > 0 && int64(len(args.Content)) > t.config.MaxFileSize {
+		return nil, fmt.Errorf("content is %d bytes, larger than the %d byte limit", len(args.Content), t.config.MaxFileSize)
+	}
+
+	if err := t.mkdirAll(filepath.Dir(name)); err != nil {
+		return nil, err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if args.Append {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := t.root.OpenFile(name, flags, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(f, args.Content); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	action := "Wrote"
+	if args.Append {
+		action = "Appended"
+	}
+	return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(fmt.Sprintf("%s %d bytes to %s", action, len(args.Content), filepath.ToSlash(name)))), nil
+}
+
+// mkdirAll creates dir and any missing parents inside the root
+func (t *fileTools) mkdirAll(dir string) error {
+	if dir == "." {
+		return nil
+	}
+	current := ""
+	for _, part := range strings.Split(filepath.ToSlash(dir), "/") {
+		current = path.Join(current, part)
+		err := t.root.Mkdir(current, 0o755)
+		if err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *fileTools) search(args SearchArgs) (*mcp_golang.ToolResponse, error) {
+	if args.Pattern == "" {
+		return nil, fmt.Errorf("pattern is required")
+	}
+	pattern := args.Pattern
+	if args.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %v", err)
+	}
+	if args.Glob != "" {
+		if _, err := path.Match(args.Glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob: %v", err)
+		}
+	}
+	name, err := t.resolve(args.Path)
+	if err != nil {
+		return nil, err
+	}
+	maxResults := args.MaxResults
+	if maxResults <= 0 {
+		maxResults = defaultMaxResults
+	}
+
+	var out strings.Builder
+	matches := 0
+	truncated := false
+	fsys := t.root.FS()
+	err = fs.WalkDir(fsys, filepath.ToSlash(name), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" || d.Name() == "node_modules" {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if args.Glob != "" {
+			if ok, _ := path.Match(args.Glob, d.Name()); !ok {
+				return nil
+			}
+		}
+		if info, err := d.Info(); err != nil || (t.config.MaxFileSize > 0 && info.Size() > t.config.MaxFileSize) {
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil || isBinary(data) {
+			return nil
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if re.MatchString(scanner.Text()) {
+				if matches >= maxResults {
+					truncated = true
+					return fs.SkipAll
+				}
+				matches++
+				fmt.Fprintf(&out, "%s:%d: %s\n", p, line, scanner.Text())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case matches == 0:
+		out.WriteString("No matches found\n")
+	case truncated:
+		fmt.Fprintf(&out, "[results truncated after %d matches]\n", maxResults)
+	}
+	return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(out.String())), nil
+}
+
+// isBinary reports whether data looks like a binary file
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
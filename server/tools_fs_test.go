@@ -0,0 +1,180 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mcp_golang "github.com/metoro-io/mcp-golang"
+)
+
+// responseText returns the text of a tool response's first content item
+func responseText(t *testing.T, resp *mcp_golang.ToolResponse) string {
+	t.Helper()
+	if resp == nil || len(resp.Content) == 0 || resp.Content[0].TextContent == nil {
+		t.Fatalf("response has no text content: %+v", resp)
+	}
+	return resp.Content[0].TextContent.Text
+}
+
+// newTestFileTools opens a sandbox holding inside.txt, next to a directory
+// holding secret.txt, and links to the secret from inside the sandbox
+func newTestFileTools(t *testing.T) (*fileTools, string) {
+	t.Helper()
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{root, outside} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "inside.txt"), []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "abs-link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../outside", filepath.Join(root, "rel-link")); err != nil {
+		t.Fatal(err)
+	}
+	tools, err := newFileTools(FilesystemConfig{Enabled: true, Root: root, MaxFileSize: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tools.root.Close() })
+	return tools, base
+}
+
+func TestFileToolsSandbox(t *testing.T) {
+	tools, base := newTestFileTools(t)
+	root := filepath.Join(base, "root")
+	secret := filepath.Join(base, "outside", "secret.txt")
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "relative path", path: "inside.txt", want: "one\ntwo\nthree\n"},
+		{name: "absolute path inside the root", path: filepath.Join(root, "inside.txt"), want: "one\ntwo\nthree\n"},
+		{name: "dot-dot path", path: "../outside/secret.txt", wantErr: true},
+		{name: "dot-dot after a directory", path: "sub/../../outside/secret.txt", wantErr: true},
+		{name: "absolute path outside the root", path: secret, wantErr: true},
+		{name: "absolute path to the parent", path: base, wantErr: true},
+		{name: "symlink to an absolute path outside", path: "abs-link", wantErr: true},
+		{name: "symlinked directory outside", path: "rel-link/secret.txt", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tools.readFile(ReadFileArgs{Path: tt.path})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("read %q succeeded: %q", tt.path, responseText(t, resp))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := responseText(t, resp); got != tt.want {
+				t.Errorf("read %q = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("write through a symlinked directory", func(t *testing.T) {
+		if _, err := tools.writeFile(WriteFileArgs{Path: "rel-link/new.txt", Content: "x"}); err == nil {
+			t.Error("write succeeded")
+		}
+		if _, err := os.Stat(filepath.Join(base, "outside", "new.txt")); !os.IsNotExist(err) {
+			t.Errorf("file was created outside the root: %v", err)
+		}
+	})
+	t.Run("write with dot-dot", func(t *testing.T) {
+		if _, err := tools.writeFile(WriteFileArgs{Path: "../escape.txt", Content: "x"}); err == nil {
+			t.Error("write succeeded")
+		}
+	})
+	t.Run("list a symlinked directory", func(t *testing.T) {
+		if _, err := tools.listDir(ListDirArgs{Path: "rel-link"}); err == nil {
+			t.Error("list succeeded")
+		}
+	})
+	t.Run("search outside the root", func(t *testing.T) {
+		if _, err := tools.search(SearchArgs{Pattern: "secret", Path: "../outside"}); err == nil {
+			t.Error("search succeeded")
+		}
+	})
+}
+
+func TestFileToolsReadRange(t *testing.T) {
+	tools, _ := newTestFileTools(t)
+
+	tests := []struct {
+		name    string
+		args    ReadFileArgs
+		want    string
+		wantErr bool
+	}{
+		{name: "offset", args: ReadFileArgs{Path: "inside.txt", Offset: 2}, want: "two\nthree\n"},
+		{name: "limit", args: ReadFileArgs{Path: "inside.txt", Limit: 1}, want: "one\n"},
+		{name: "offset and limit", args: ReadFileArgs{Path: "inside.txt", Offset: 2, Limit: 1}, want: "two\n"},
+		{name: "offset past the end", args: ReadFileArgs{Path: "inside.txt", Offset: 10}, wantErr: true},
+		{name: "negative limit", args: ReadFileArgs{Path: "inside.txt", Limit: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tools.readFile(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("read succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := responseText(t, resp); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileToolsWrite(t *testing.T) {
+	tools, base := newTestFileTools(t)
+
+	if _, err := tools.writeFile(WriteFileArgs{Path: "a/b/c.txt", Content: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tools.writeFile(WriteFileArgs{Path: "a/b/c.txt", Content: " world", Append: true}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(base, "root", "a", "b", "c.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello world" {
+		t.Errorf("file holds %q", data)
+	}
+
+	resp, err := tools.search(SearchArgs{Pattern: "WORLD", IgnoreCase: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := responseText(t, resp); !strings.Contains(got, "a/b/c.txt:1: hello world") {
+		t.Errorf("search = %q", got)
+	}
+}
+
+func TestWriteFileOffByDefault(t *testing.T) {
+	if !defaultServerConfig().Tools.Filesystem.ReadOnly {
+		t.Error("write_file is registered by default")
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	mcp_golang "github.com/metoro-io/mcp-golang"
+)
+
+// FetchConfig configures the http_fetch tool
+type FetchConfig struct {
+	Enabled      bool     `json:"enabled"`
+	AllowedHosts []string `json:"allowed_hosts,omitempty"` // Hosts that may be fetched; "*.example.com" matches subdomains
+	Timeout      Duration `json:"timeout,omitempty"`       // Time limit for a request, including redirects
+	MaxBytes     int64    `json:"max_bytes,omitempty"`     // Bytes of response body returned
+}
+
+// HTTPFetchArgs defines the arguments for the http_fetch tool
+type HTTPFetchArgs struct {
+	URL     string            `json:"url" jsonschema:"required,description=http or https URL on an allowed host"`
+	Method  string            `json:"method,omitempty" jsonschema:"enum=GET,enum=HEAD,description=HTTP method (default GET)"`
+	Headers map[string]string `json:"headers,omitempty" jsonschema:"description=Extra request headers"`
+}
+
+// maxRedirects bounds how many redirects http_fetch follows
+const maxRedirects = 5
+
+type fetchTool struct {
+	config FetchConfig
+	client *http.Client
+}
+
+// registerFetchTools registers http_fetch. It is not registered when the
+// module is disabled or no hosts are allowed.
+func registerFetchTools(server *mcp_golang.Server, config FetchConfig) error {
+	if !config.Enabled || len(config.AllowedHosts) == 0 {
+		return nil
+	}
+	t := newFetchTool(config)
+	description := fmt.Sprintf("Fetches a URL over HTTP(S) and returns the status, headers and body. Allowed hosts: %s", strings.Join(config.AllowedHosts, ", "))
+	return server.RegisterTool("http_fetch", description, t.fetch)
+}
+
+// newFetchTool builds the HTTP client, which checks every redirect target
+// against the allowlist too
+func newFetchTool(config FetchConfig) *fetchTool {
+	t := &fetchTool{config: config}
+	t.client = &http.Client{
+		Timeout: time.Duration(config.Timeout),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return t.checkURL(req.URL)
+		},
+	}
+	return t
+}
+
+// checkURL rejects URLs that aren't http(s) or whose host isn't allowed
+func (t *fetchTool) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("only http and https URLs are allowed")
+	}
+	if !hostAllowed(t.config.AllowedHosts, u) {
+		return fmt.Errorf("host %q is not allowed; allowed hosts: %s", u.Host, strings.Join(t.config.AllowedHosts, ", "))
+	}
+	return nil
+}
+
+// hostAllowed matches a URL against the allowlist. Entries with a port must
+// match host:port exactly; "*.example.com" matches any subdomain.
+func hostAllowed(allowed []string, u *url.URL) bool {
+	hostname := strings.ToLower(u.Hostname())
+	for _, entry := range allowed {
+		entry = strings.ToLower(entry)
+		switch {
+		case entry == "*":
+			return true
+		case strings.HasPrefix(entry, "*."):
+			if strings.HasSuffix(hostname, entry[1:]) {
+				return true
+			}
+		case strings.Contains(entry, ":"):
+			if strings.ToLower(u.Host) == entry {
+				return true
+			}
+		case hostname == entry:
+			return true
+		}
+	}
+	return false
+}
+
+func (t *fetchTool) fetch(ctx context.Context, args HTTPFetchArgs) (*mcp_golang.ToolResponse, error) {
+	u, err := url.Parse(args.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q", args.URL)
+	}
+	if err := t.checkURL(u); err != nil {
+		return nil, err
+	}
+
+	method := strings.ToUpper(args.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	if method != http.MethodGet && method != http.MethodHead {
+		return nil, fmt.Errorf("method must be GET or HEAD")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range args.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "%s %s\n", resp.Proto, resp.Status)
+	if resp.Request.URL.String() != u.String() {
+		fmt.Fprintf(&out, "Final-URL: %s\n", resp.Request.URL)
+	}
+	for _, name := range []string{"Content-Type", "Content-Length", "Last-Modified", "Location"} {
+		if value := resp.Header.Get(name); value != "" {
+			fmt.Fprintf(&out, "%s: %s\n", name, value)
+		}
+	}
+	out.WriteString("\n")
+
+	if method == http.MethodHead {
+		return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(out.String())), nil
+	}
+
+	if !isTextContent(resp.Header.Get("Content-Type")) {
+		out.WriteString("[binary content not shown]\n")
+		return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(out.String())), nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, t.config.MaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	if int64(len(body)) > t.config.MaxBytes {
+		out.Write(body[:t.config.MaxBytes])
+		fmt.Fprintf(&out, "\n[body truncated at %d bytes]\n", t.config.MaxBytes)
+	} else {
+		out.Write(body)
+	}
+	return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(out.String())), nil
+}
+
+// isTextContent reports whether a Content-Type is worth returning as text
+func isTextContent(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"),
+		mediaType == "application/json", mediaType == "application/xml",
+		mediaType == "application/javascript", mediaType == "application/x-www-form-urlencoded":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostAllowed(t *testing.T) {
+	tests := []struct {
+		allowed []string
+		url     string
+		want    bool
+	}{
+		{[]string{"example.com"}, "https://example.com/x", true},
+		{[]string{"example.com"}, "https://EXAMPLE.com/x", true},
+		{[]string{"example.com"}, "https://example.com:8443/x", true},
+		{[]string{"example.com"}, "https://api.example.com/x", false},
+		{[]string{"example.com"}, "https://example.com.evil.net/x", false},
+		{[]string{"*.example.com"}, "https://api.example.com/x", true},
+		{[]string{"*.example.com"}, "https://a.b.example.com/x", true},
+		{[]string{"*.example.com"}, "https://example.com/x", false},
+		{[]string{"*.example.com"}, "https://evilexample.com/x", false},
+		{[]string{"localhost:8080"}, "http://localhost:8080/x", true},
+		{[]string{"localhost:8080"}, "http://localhost:9090/x", false},
+		{[]string{"localhost:8080"}, "http://localhost/x", false},
+		{[]string{"*"}, "https://anything.net/", true},
+		{nil, "https://example.com/", false},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hostAllowed(tt.allowed, u); got != tt.want {
+			t.Errorf("hostAllowed(%v, %s) = %v, want %v", tt.allowed, tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("other"))
+	}))
+	defer other.Close()
+
+	var allowed *httptest.Server
+	allowed = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/text":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("0123456789"))
+		case "/binary":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte{0x89, 'P', 'N', 'G'})
+		case "/redirect-here":
+			http.Redirect(w, r, "/text", http.StatusFound)
+		case "/redirect-away":
+			http.Redirect(w, r, other.URL+"/", http.StatusFound)
+		case "/redirect-scheme":
+			http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		}
+	}))
+	defer allowed.Close()
+
+	tool := newFetchTool(FetchConfig{
+		Enabled:      true,
+		AllowedHosts: []string{strings.TrimPrefix(allowed.URL, "http://")},
+		Timeout:      Duration(5 * time.Second),
+		MaxBytes:     4,
+	})
+
+	tests := []struct {
+		name    string
+		args    HTTPFetchArgs
+		want    []string
+		wantErr string
+	}{
+		{name: "body truncated at max_bytes", args: HTTPFetchArgs{URL: allowed.URL + "/text"}, want: []string{"200 OK", "\n0123\n[body truncated at 4 bytes]"}},
+		{name: "binary body left out", args: HTTPFetchArgs{URL: allowed.URL + "/binary"}, want: []string{"[binary content not shown]"}},
+		{name: "HEAD has no body", args: HTTPFetchArgs{URL: allowed.URL + "/text", Method: "head"}, want: []string{"Content-Type: text/plain"}},
+		{name: "redirect on the allowed host", args: HTTPFetchArgs{URL: allowed.URL + "/redirect-here"}, want: []string{"Final-URL: " + allowed.URL + "/text", "0123"}},
+		{name: "host not allowed", args: HTTPFetchArgs{URL: other.URL + "/"}, wantErr: "is not allowed"},
+		{name: "redirect to a host not allowed", args: HTTPFetchArgs{URL: allowed.URL + "/redirect-away"}, wantErr: "is not allowed"},
+		{name: "redirect to another scheme", args: HTTPFetchArgs{URL: allowed.URL + "/redirect-scheme"}, wantErr: "only http and https"},
+		{name: "redirect loop", args: HTTPFetchArgs{URL: allowed.URL + "/loop"}, wantErr: "stopped after 5 redirects"},
+		{name: "file URL", args: HTTPFetchArgs{URL: "file:///etc/passwd"}, wantErr: "invalid URL"},
+		{name: "POST", args: HTTPFetchArgs{URL: allowed.URL + "/text", Method: "POST"}, wantErr: "GET or HEAD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tool.fetch(context.Background(), tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := responseText(t, resp)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("response doesn't contain %q:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
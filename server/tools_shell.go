@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	mcp_golang "github.com/metoro-io/mcp-golang"
+)
+
+// ShellConfig configures the run_command tool
+type ShellConfig struct {
+	Enabled    bool     `json:"enabled"`
+	Allow      []string `json:"allow,omitempty"`       // Commands that may be run, by name or absolute path
+	Dir        string   `json:"dir,omitempty"`         // Working directory commands run in and below; defaults to the filesystem root
+	Timeout    Duration `json:"timeout,omitempty"`     // Default time limit for a command
+	MaxTimeout Duration `json:"max_timeout,omitempty"` // Upper bound for a requested timeout
+	MaxOutput  int      `json:"max_output,omitempty"`  // Bytes of combined output returned
+}
+
+// RunCommandArgs defines the arguments for the run_command tool
+type RunCommandArgs struct {
+	Command        string   `json:"command" jsonschema:"required,description=Program to run; must be on the server's allowlist. No shell is involved."`
+	Args           []string `json:"args,omitempty" jsonschema:"description=Arguments passed to the program"`
+	Dir            string   `json:"dir,omitempty" jsonschema:"description=Working directory relative to the sandbox root"`
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty" jsonschema:"description=Time limit in seconds; capped by the server"`
+}
+
+// commandEnv is the environment passed to commands. The server's own
+// environment may hold secrets, so only these variables are passed through.
+var commandEnv = []string{"PATH", "HOME", "LANG", "LC_ALL", "TMPDIR"}
+
+type shellTool struct {
+	config ShellConfig
+	dir    string
+	allow  map[string]bool
+}
+
+// registerShellTools registers run_command. It is not registered when the
+// module is disabled or no commands are allowed.
+func registerShellTools(server *mcp_golang.Server, config ShellConfig) error {
+	if !config.Enabled || len(config.Allow) == 0 {
+		return nil
+	}
+	t, err := newShellTool(config)
+	if err != nil {
+		return err
+	}
+
+	description := fmt.Sprintf("Runs an allowlisted command (%s) without a shell and returns its exit code and output", strings.Join(config.Allow, ", "))
+	return server.RegisterTool("run_command", description, t.runCommand)
+}
+
+// newShellTool resolves the command directory and indexes the allowlist
+func newShellTool(config ShellConfig) (*shellTool, error) {
+	dir, err := filepath.Abs(config.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command directory: %v", err)
+	}
+	t := &shellTool{config: config, dir: dir, allow: make(map[string]bool)}
+	for _, name := range config.Allow {
+		t.allow[name] = true
+	}
+	return t, nil
+}
+
+func (t *shellTool) runCommand(ctx context.Context, args RunCommandArgs) (*mcp_golang.ToolResponse, error) {
+	if args.Command == "" {
+		return nil, fmt.Errorf("command is required")
+	}
+	if !t.allow[args.Command] {
+		return nil, fmt.Errorf("command %q is not allowed; allowed commands: %s", args.Command, strings.Join(t.config.Allow, ", "))
+	}
+	if strings.ContainsRune(args.Command, os.PathSeparator) && !filepath.IsAbs(args.Command) {
+		return nil, fmt.Errorf("command %q must be a name or an absolute path", args.Command)
+	}
+
+	dir := t.dir
+	if args.Dir != "" {
+		rel := filepath.Clean(args.Dir)
+		if !filepath.IsLocal(rel) && rel != "." {
+			return nil, fmt.Errorf("dir %q is outside the sandbox", args.Dir)
+		}
+		dir = filepath.Join(t.dir, rel)
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return nil, err
+		}
+		if within, _ := filepath.Rel(t.dir, resolved); !filepath.IsLocal(within) && within != "." {
+			return nil, fmt.Errorf("dir %q is outside the sandbox", args.Dir)
+		}
+	}
+
+	timeout := time.Duration(t.config.Timeout)
+	if args.TimeoutSeconds > 0 {
+		timeout = time.Duration(args.TimeoutSeconds) * time.Second
+	}
+	if t.config.MaxTimeout > 0 && timeout > time.Duration(t.config.MaxTimeout) {
+		timeout = time.Duration(t.config.MaxTimeout)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args.Command, args.Args...)
+	cmd.Dir = dir
+	cmd.Env = []string{}
+	for _, name := range commandEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	elapsed := time.Since(start).Round(time.Millisecond)
+
+	exitCode := 0
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return nil, fmt.Errorf("command timed out after %s", timeout)
+	case errors.As(err, &exitErr):
+		exitCode = exitErr.ExitCode()
+	case err != nil:
+		return nil, fmt.Errorf("failed to run command: %v", err)
+	}
+
+	text := output.String()
+	if t.config.MaxOutput > 0 && len(text) > t.config.MaxOutput {
+		text = text[:t.config.MaxOutput] + fmt.Sprintf("\n[output truncated at %d bytes]", t.config.MaxOutput)
+	}
+	result := fmt.Sprintf("exit code: %d (%s)\n\n%s", exitCode, elapsed, text)
+	return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(result)), nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestShellTool(t *testing.T, config ShellConfig) *shellTool {
+	t.Helper()
+	config.Enabled = true
+	if config.Dir == "" {
+		config.Dir = t.TempDir()
+	}
+	if config.Timeout == 0 {
+		config.Timeout = Duration(10 * time.Second)
+	}
+	tool, err := newShellTool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tool
+}
+
+func TestRunCommandAllowlist(t *testing.T) {
+	tool := newTestShellTool(t, ShellConfig{Allow: []string{"echo", "true"}})
+
+	tests := []struct {
+		name    string
+		args    RunCommandArgs
+		wantErr string
+	}{
+		{name: "allowed command", args: RunCommandArgs{Command: "echo", Args: []string{"hi"}}},
+		{name: "command not on the list", args: RunCommandArgs{Command: "sh", Args: []string{"-c", "echo hi"}}, wantErr: "not allowed"},
+		{name: "path to an allowed name", args: RunCommandArgs{Command: "/bin/echo"}, wantErr: "not allowed"},
+		{name: "empty command", args: RunCommandArgs{}, wantErr: "required"},
+		{name: "dir outside the sandbox", args: RunCommandArgs{Command: "true", Dir: ".."}, wantErr: "outside the sandbox"},
+		{name: "absolute dir", args: RunCommandArgs{Command: "true", Dir: "/"}, wantErr: "outside the sandbox"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tool.runCommand(context.Background(), tt.args)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatal(err)
+			case tt.wantErr != "" && err == nil:
+				t.Fatalf("command ran, want an error containing %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Fatalf("error %q doesn't contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunCommandRelativePathRejected(t *testing.T) {
+	tool := newTestShellTool(t, ShellConfig{Allow: []string{"./script"}})
+	if _, err := tool.runCommand(context.Background(), RunCommandArgs{Command: "./script"}); err == nil || !strings.Contains(err.Error(), "absolute path") {
+		t.Fatalf("err = %v, want a name or absolute path error", err)
+	}
+}
+
+func TestRunCommandSymlinkedDir(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	if err := os.Mkdir(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(base, filepath.Join(root, "up")); err != nil {
+		t.Fatal(err)
+	}
+	tool := newTestShellTool(t, ShellConfig{Allow: []string{"true"}, Dir: root})
+	if _, err := tool.runCommand(context.Background(), RunCommandArgs{Command: "true", Dir: "up"}); err == nil {
+		t.Fatal("command ran in a directory outside the sandbox")
+	}
+}
+
+func TestRunCommandEnv(t *testing.T) {
+	t.Setenv("GCHAI_TEST_SECRET", "hunter2")
+	t.Setenv("LANG", "C")
+	tool := newTestShellTool(t, ShellConfig{Allow: []string{"env"}})
+
+	resp, err := tool.runCommand(context.Background(), RunCommandArgs{Command: "env"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := responseText(t, resp)
+	if strings.Contains(out, "GCHAI_TEST_SECRET") || strings.Contains(out, "hunter2") {
+		t.Errorf("command saw a variable that isn't on the list:\n%s", out)
+	}
+	if !strings.Contains(out, "LANG=C") {
+		t.Errorf("command didn't see LANG:\n%s", out)
+	}
+}
+
+func TestRunCommandExitCodeAndOutput(t *testing.T) {
+	tool := newTestShellTool(t, ShellConfig{Allow: []string{"sh"}, MaxOutput: 5})
+
+	resp, err := tool.runCommand(context.Background(), RunCommandArgs{Command: "sh", Args: []string{"-c", "echo 0123456789; exit 3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := responseText(t, resp)
+	if !strings.HasPrefix(out, "exit code: 3 ") {
+		t.Errorf("output doesn't start with the exit code:\n%s", out)
+	}
+	if !strings.Contains(out, "01234\n[output truncated at 5 bytes]") || strings.Contains(out, "56789") {
+		t.Errorf("output wasn't truncated:\n%s", out)
+	}
+}
+
+func TestRunCommandTimeout(t *testing.T) {
+	tool := newTestShellTool(t, ShellConfig{
+		Allow:      []string{"sleep"},
+		Timeout:    Duration(100 * time.Millisecond),
+		MaxTimeout: Duration(200 * time.Millisecond),
+	})
+
+	for _, args := range []RunCommandArgs{
+		{Command: "sleep", Args: []string{"10"}},
+		{Command: "sleep", Args: []string{"10"}, TimeoutSeconds: 60}, // Capped by max_timeout
+	} {
+		start := time.Now()
+		_, err := tool.runCommand(context.Background(), args)
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Fatalf("err = %v, want a timeout", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("command was killed after %s", elapsed)
+		}
+	}
+}
@@ -0,0 +1,731 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // IANA zones work on hosts without a zoneinfo database
+
+	mcp_golang "github.com/metoro-io/mcp-golang"
+)
+
+// TimeConfig configures the time tools
+type TimeConfig struct {
+	Enabled  bool     `json:"enabled"`
+	Timezone string   `json:"timezone,omitempty"` // IANA zone for times given without an offset; the server's local zone if empty
+	Holidays []string `json:"holidays,omitempty"` // Dates (YYYY-MM-DD) that business-day calculations skip
+}
+
+// TimeArgs defines the arguments for the time tool
+type TimeArgs struct {
+	Format   string `json:"format,omitempty" jsonschema:"description=Output format: a preset (rfc3339 iso8601 date time datetime rfc1123 kitchen human unix unix_ms) or a strftime pattern such as %Y-%m-%d %H:%M; defaults to rfc3339"`
+	Timezone string `json:"timezone,omitempty" jsonschema:"description=IANA time zone such as Europe/Berlin or UTC; defaults to the server's zone"`
+}
+
+// ConvertTimeArgs defines the arguments for the convert_time tool
+type ConvertTimeArgs struct {
+	Time   string `json:"time" jsonschema:"required,description=Time to convert; ISO 8601 or a common written form"`
+	From   string `json:"from,omitempty" jsonschema:"description=IANA time zone of the time when it has no offset; defaults to the server's zone"`
+	To     string `json:"to" jsonschema:"required,description=IANA time zone to convert to"`
+	Format string `json:"format,omitempty" jsonschema:"description=Output format preset or strftime pattern; defaults to rfc3339"`
+}
+
+// ParseTimeArgs defines the arguments for the parse_time tool
+type ParseTimeArgs struct {
+	Text     string `json:"text" jsonschema:"required,description=Date or time to parse such as 2024-03-01T09:00:00Z or March 1 2024 9:00 AM or tomorrow or 3 days ago"`
+	Timezone string `json:"timezone,omitempty" jsonschema:"description=IANA time zone for text without an offset; defaults to the server's zone"`
+}
+
+// AddDurationArgs defines the arguments for the add_duration tool
+type AddDurationArgs struct {
+	Time     string `json:"time,omitempty" jsonschema:"description=Start time; defaults to now"`
+	Duration string `json:"duration" jsonschema:"required,description=Duration to add such as 1h30m or 3d or 2w or 1y2mo or P1DT12H; prefix with - to subtract"`
+	Timezone string `json:"timezone,omitempty" jsonschema:"description=IANA time zone for the calculation and result; days follow the calendar across daylight saving changes"`
+	Format   string `json:"format,omitempty" jsonschema:"description=Output format preset or strftime pattern; defaults to rfc3339"`
+}
+
+// TimeDifferenceArgs defines the arguments for the time_difference tool
+type TimeDifferenceArgs struct {
+	Start    string `json:"start" jsonschema:"required,description=Start time"`
+	End      string `json:"end,omitempty" jsonschema:"description=End time; defaults to now"`
+	Timezone string `json:"timezone,omitempty" jsonschema:"description=IANA time zone for times without an offset"`
+}
+
+// BusinessDaysArgs defines the arguments for the business_days tool
+type BusinessDaysArgs struct {
+	Start    string   `json:"start" jsonschema:"required,description=Start date"`
+	End      string   `json:"end,omitempty" jsonschema:"description=Count the business days from start to end including both; give end or days"`
+	Days     *int     `json:"days,omitempty" jsonschema:"description=Number of business days to add to start; negative counts backwards"`
+	Holidays []string `json:"holidays,omitempty" jsonschema:"description=Extra dates (YYYY-MM-DD) to skip besides weekends and the server's holidays"`
+	Timezone string   `json:"timezone,omitempty" jsonschema:"description=IANA time zone that decides which day start falls on"`
+}
+
+// maxBusinessDays bounds business-day calculations, about 100 years
+const maxBusinessDays = 36525
+
+// timeFormats are the format presets, by lowercase name
+var timeFormats = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"iso8601":     time.RFC3339,
+	"date":        time.DateOnly,
+	"time":        time.TimeOnly,
+	"datetime":    time.DateTime,
+	"rfc1123":     time.RFC1123,
+	"rfc1123z":    time.RFC1123Z,
+	"rfc822":      time.RFC822,
+	"rfc822z":     time.RFC822Z,
+	"ansic":       time.ANSIC,
+	"unixdate":    time.UnixDate,
+	"kitchen":     time.Kitchen,
+	"human":       "Monday, January 2, 2006 3:04 PM MST",
+	"weekday":     "Monday",
+}
+
+// parseLayouts are tried in order by parse. Layouts without an offset
+// are read in the caller's zone.
+var parseLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 -0700 MST",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC850,
+	time.RFC822Z,
+	time.RFC822,
+	time.ANSIC,
+	time.UnixDate,
+	time.RubyDate,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04",
+	time.DateOnly,
+	"2006/01/02",
+	"2006/01/02 15:04",
+	"2006/01/02 15:04:05",
+	"20060102",
+	"January 2, 2006",
+	"January 2 2006",
+	"Jan 2, 2006",
+	"Jan 2 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+	"Monday, January 2, 2006",
+	"Mon, Jan 2, 2006",
+	"Mon Jan 2 2006",
+	"January 2, 2006 3:04 PM",
+	"January 2, 2006 3:04PM",
+	"January 2, 2006 15:04",
+	"January 2 2006 3:04 PM",
+	"January 2 2006 15:04",
+	"Jan 2, 2006 3:04 PM",
+	"Jan 2, 2006 15:04",
+	"Jan 2 2006 3:04 PM",
+	"Jan 2 2006 15:04",
+	"2 January 2006 15:04",
+	"2 Jan 2006 15:04",
+	"Monday, January 2, 2006 3:04 PM",
+	"Monday, January 2, 2006 3:04 PM MST",
+}
+
+type timeTools struct {
+	location *time.Location
+	holidays map[string]bool
+	now      func() time.Time
+}
+
+// registerTimeTools registers the time, conversion, parsing and calendar
+// tools
+func registerTimeTools(server *mcp_golang.Server, config TimeConfig) error {
+	if !config.Enabled {
+		return nil
+	}
+	location, err := loadLocation(config.Timezone, time.Local)
+	if err != nil {
+		return fmt.Errorf("tools.time.timezone: %v", err)
+	}
+	t := &timeTools{location: location, holidays: make(map[string]bool), now: time.Now}
+	for _, day := range config.Holidays {
+		date, err := time.Parse(time.DateOnly, day)
+		if err != nil {
+			return fmt.Errorf("tools.time.holidays: invalid date %q: must be YYYY-MM-DD", day)
+		}
+		t.holidays[date.Format(time.DateOnly)] = true
+	}
+
+	tools := []struct {
+		name        string
+		description string
+		handler     any
+	}{
+		{"time", "Returns the current time. Format is a preset such as rfc3339 or date or unix, or a strftime pattern such as %Y-%m-%d.", t.currentTime},
+		{"convert_time", "Converts a time to another IANA time zone", t.convertTime},
+		{"parse_time", "Parses an ISO 8601 or written date or time and returns it in standard forms", t.parseTime},
+		{"add_duration", "Adds or subtracts a duration such as 1h30m or 3d or 1mo or P1W to a time", t.addDuration},
+		{"time_difference", "Returns the time between two times", t.timeDifference},
+		{"business_days", "Counts business days between two dates or adds business days to a date. Weekends and configured holidays are skipped.", t.businessDays},
+	}
+	for _, tool := range tools {
+		if err := server.RegisterTool(tool.name, tool.description, tool.handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *timeTools) currentTime(args TimeArgs) (*mcp_golang.ToolResponse, error) {
+	location, err := loadLocation(args.Timezone, t.location)
+	if err != nil {
+		return nil, err
+	}
+	text, err := formatTime(t.now().In(location), args.Format)
+	if err != nil {
+		return nil, err
+	}
+	return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(text)), nil
+}
+
+func (t *timeTools) convertTime(args ConvertTimeArgs) (*mcp_golang.ToolResponse, error) {
+	if args.To == "" {
+		return nil, fmt.Errorf("to is required")
+	}
+	from, err := loadLocation(args.From, t.location)
+	if err != nil {
+		return nil, err
+	}
+	to, err := loadLocation(args.To, t.location)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := t.parse(args.Time, from)
+	if err != nil {
+		return nil, err
+	}
+	text, err := formatTime(parsed.In(to), args.Format)
+	if err != nil {
+		return nil, err
+	}
+	return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(text)), nil
+}
+
+func (t *timeTools) parseTime(args ParseTimeArgs) (*mcp_golang.ToolResponse, error) {
+	location, err := loadLocation(args.Timezone, t.location)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := t.parse(args.Text, location)
+	if err != nil {
+		return nil, err
+	}
+	year, week := parsed.ISOWeek()
+	var text strings.Builder
+	fmt.Fprintf(&text, "rfc3339: %s\n", parsed.Format(time.RFC3339Nano))
+	fmt.Fprintf(&text, "utc: %s\n", parsed.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(&text, "unix: %d\n", parsed.Unix())
+	fmt.Fprintf(&text, "weekday: %s\n", parsed.Weekday())
+	fmt.Fprintf(&text, "iso_week: %d-W%02d\n", year, week)
+	fmt.Fprintf(&text, "day_of_year: %d\n", parsed.YearDay())
+	return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(strings.TrimSuffix(text.String(), "\n"))), nil
+}
+
+func (t *timeTools) addDuration(args AddDurationArgs) (*mcp_golang.ToolResponse, error) {
+	location, err := loadLocation(args.Timezone, t.location)
+	if err != nil {
+		return nil, err
+	}
+	start := t.now().In(location)
+	if args.Time != "" {
+		if start, err = t.parse(args.Time, location); err != nil {
+			return nil, err
+		}
+		start = start.In(location)
+	}
+	p, err := parsePeriod(args.Duration)
+	if err != nil {
+		return nil, err
+	}
+	text, err := formatTime(p.addTo(start), args.Format)
+	if err != nil {
+		return nil, err
+	}
+	return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(text)), nil
+}
+
+func (t *timeTools) timeDifference(args TimeDifferenceArgs) (*mcp_golang.ToolResponse, error) {
+	location, err := loadLocation(args.Timezone, t.location)
+	if err != nil {
+		return nil, err
+	}
+	start, err := t.parse(args.Start, location)
+	if err != nil {
+		return nil, fmt.Errorf("start: %v", err)
+	}
+	end := t.now()
+	if args.End != "" {
+		if end, err = t.parse(args.End, location); err != nil {
+			return nil, fmt.Errorf("end: %v", err)
+		}
+	}
+	d := end.Sub(start)
+	var text strings.Builder
+	fmt.Fprintf(&text, "duration: %s\n", describeDuration(d))
+	fmt.Fprintf(&text, "go_duration: %s\n", d)
+	fmt.Fprintf(&text, "seconds: %s\n", strconv.FormatFloat(d.Seconds(), 'f', -1, 64))
+	fmt.Fprintf(&text, "hours: %.2f\n", d.Hours())
+	fmt.Fprintf(&text, "days: %.2f\n", d.Hours()/24)
+	return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(strings.TrimSuffix(text.String(), "\n"))), nil
+}
+
+func (t *timeTools) businessDays(args BusinessDaysArgs) (*mcp_golang.ToolResponse, error) {
+	if (args.End == "") == (args.Days == nil) {
+		return nil, fmt.Errorf("give either end or days")
+	}
+	location, err := loadLocation(args.Timezone, t.location)
+	if err != nil {
+		return nil, err
+	}
+	holidays := t.holidays
+	if len(args.Holidays) > 0 {
+		holidays = make(map[string]bool)
+		for day := range t.holidays {
+			holidays[day] = true
+		}
+		for _, day := range args.Holidays {
+			date, err := time.Parse(time.DateOnly, day)
+			if err != nil {
+				return nil, fmt.Errorf("invalid holiday %q: must be YYYY-MM-DD", day)
+			}
+			holidays[date.Format(time.DateOnly)] = true
+		}
+	}
+	isBusinessDay := func(day time.Time) bool {
+		weekday := day.Weekday()
+		return weekday != time.Saturday && weekday != time.Sunday && !holidays[day.Format(time.DateOnly)]
+	}
+
+	start, err := t.parseDate(args.Start, location)
+	if err != nil {
+		return nil, fmt.Errorf("start: %v", err)
+	}
+
+	if args.Days != nil {
+		days := *args.Days
+		if days > maxBusinessDays || days < -maxBusinessDays {
+			return nil, fmt.Errorf("days must be between %d and %d", -maxBusinessDays, maxBusinessDays)
+		}
+		step := 1
+		if days < 0 {
+			step = -1
+		}
+		day := start
+		for remaining := days; remaining != 0; {
+			day = day.AddDate(0, 0, step)
+			if isBusinessDay(day) {
+				remaining -= step
+			}
+		}
+		text := fmt.Sprintf("%s (%s)", day.Format(time.DateOnly), day.Weekday())
+		return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(text)), nil
+	}
+
+	end, err := t.parseDate(args.End, location)
+	if err != nil {
+		return nil, fmt.Errorf("end: %v", err)
+	}
+	sign := 1
+	if end.Before(start) {
+		start, end = end, start
+		sign = -1
+	}
+	if end.Sub(start) > maxBusinessDays*24*time.Hour {
+		return nil, fmt.Errorf("start and end may be at most %d days apart", maxBusinessDays)
+	}
+	count, calendarDays := 0, 0
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		calendarDays++
+		if isBusinessDay(day) {
+			count++
+		}
+	}
+	text := fmt.Sprintf("business days: %d\ncalendar days: %d", sign*count, sign*calendarDays)
+	return mcp_golang.NewToolResponse(mcp_golang.NewTextContent(text)), nil
+}
+
+// parseDate parses a time and returns midnight UTC of the day it falls on
+// in location, so that days can be stepped without DST surprises
+func (t *timeTools) parseDate(text string, location *time.Location) (time.Time, error) {
+	parsed, err := t.parse(text, location)
+	if err != nil {
+		return time.Time{}, err
+	}
+	year, month, day := parsed.In(location).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC), nil
+}
+
+// relativePattern matches "in <duration>" and "<duration> ago"
+var relativePattern = regexp.MustCompile(`^(?:in\s+(.+)|(.+?)\s+ago)$`)
+
+// parse reads an ISO 8601 or written time, a Unix timestamp, or a relative
+// time such as "tomorrow" or "3 days ago". Text without an offset is read in
+// location.
+func (t *timeTools) parse(text string, location *time.Location) (time.Time, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return time.Time{}, fmt.Errorf("time is required")
+	}
+	now := t.now().In(location)
+	year, month, day := now.Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, location)
+	switch strings.ToLower(text) {
+	case "now":
+		return now, nil
+	case "today":
+		return today, nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	}
+	if match := relativePattern.FindStringSubmatch(strings.ToLower(text)); match != nil {
+		if match[1] != "" {
+			p, err := parsePeriod(match[1])
+			if err != nil {
+				return time.Time{}, err
+			}
+			return p.addTo(now), nil
+		}
+		p, err := parsePeriod(match[2])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return p.negate().addTo(now), nil
+	}
+
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil && len(text) >= 9 {
+		// Timestamps with 13 or more digits are taken as milliseconds
+		if len(strings.TrimPrefix(text, "-")) >= 13 {
+			return time.UnixMilli(n).In(location), nil
+		}
+		return time.Unix(n, 0).In(location), nil
+	}
+
+	for _, layout := range parseLayouts {
+		if parsed, err := time.ParseInLocation(layout, text, location); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("can't parse %q as a time; use ISO 8601 such as 2024-03-01 or 2024-03-01T09:00:00Z", text)
+}
+
+// loadLocation resolves an IANA zone name, "local", or a fixed offset such
+// as "+05:30". An empty name gives def.
+func loadLocation(name string, def *time.Location) (*time.Location, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return def, nil
+	case "local":
+		return time.Local, nil
+	case "utc", "z", "gmt":
+		return time.UTC, nil
+	}
+	if name[0] == '+' || name[0] == '-' {
+		offset, err := time.Parse("-07:00", name)
+		if err != nil {
+			if offset, err = time.Parse("-0700", name); err != nil {
+				return nil, fmt.Errorf("invalid offset %q: use +hh:mm", name)
+			}
+		}
+		_, seconds := offset.Zone()
+		return time.FixedZone(name, seconds), nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q: use an IANA name such as America/New_York or UTC", name)
+	}
+	return location, nil
+}
+
+// formatTime formats t with a preset name or a strftime pattern. Go layouts
+// are accepted too.
+func formatTime(t time.Time, format string) (string, error) {
+	name := strings.ToLower(strings.TrimSpace(format))
+	switch name {
+	case "":
+		return t.Format(time.RFC3339), nil
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10), nil
+	case "unix_ms":
+		return strconv.FormatInt(t.UnixMilli(), 10), nil
+	case "iso8601-week":
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d-%d", year, week, isoWeekday(t)), nil
+	}
+	if layout, ok := timeFormats[name]; ok {
+		return t.Format(layout), nil
+	}
+	if strings.Contains(format, "%") {
+		return strftime(t, format)
+	}
+	// A Go layout changes when formatted; text such as YYYY-MM-DD doesn't
+	if (time.Time{}).Format(format) != format {
+		return t.Format(format), nil
+	}
+	return "", fmt.Errorf("unknown format %q: use a preset (rfc3339, iso8601, date, time, datetime, rfc1123, kitchen, human, unix, unix_ms) or a strftime pattern such as %%Y-%%m-%%d", format)
+}
+
+// strftimeLayouts maps strftime directives to Go layouts
+var strftimeLayouts = map[byte]string{
+	'Y': "2006", 'y': "06", 'm': "01", 'd': "02", 'e': "_2",
+	'H': "15", 'I': "03", 'l': "3", 'M': "04", 'S': "05", 'p': "PM",
+	'b': "Jan", 'h': "Jan", 'B': "January", 'a': "Mon", 'A': "Monday",
+	'Z': "MST", 'z': "-0700", 'j': "002",
+	'F': time.DateOnly, 'T': time.TimeOnly, 'R': "15:04", 'D': "01/02/06",
+	'c': time.ANSIC, 'x': "01/02/06", 'X': time.TimeOnly,
+}
+
+// strftime formats t with a C strftime pattern
+func strftime(t time.Time, format string) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			out.WriteByte(format[i])
+			continue
+		}
+		i++
+		if i == len(format) {
+			return "", fmt.Errorf("format %q ends with %%", format)
+		}
+		directive := format[i]
+		if layout, ok := strftimeLayouts[directive]; ok {
+			out.WriteString(t.Format(layout))
+			continue
+		}
+		switch directive {
+		case '%':
+			out.WriteByte('%')
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case 'f':
+			fmt.Fprintf(&out, "%06d", t.Nanosecond()/1000)
+		case 's':
+			out.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case 'u':
+			out.WriteString(strconv.Itoa(isoWeekday(t)))
+		case 'w':
+			out.WriteString(strconv.Itoa(int(t.Weekday())))
+		case 'G':
+			year, _ := t.ISOWeek()
+			out.WriteString(strconv.Itoa(year))
+		case 'V':
+			_, week := t.ISOWeek()
+			fmt.Fprintf(&out, "%02d", week)
+		default:
+			return "", fmt.Errorf("unsupported strftime directive %%%c in %q", directive, format)
+		}
+	}
+	return out.String(), nil
+}
+
+// isoWeekday returns the ISO 8601 day of the week, Monday being 1
+func isoWeekday(t time.Time) int {
+	if t.Weekday() == time.Sunday {
+		return 7
+	}
+	return int(t.Weekday())
+}
+
+// period is a duration with calendar parts, which vary in length and are
+// applied with AddDate
+type period struct {
+	years, months, days int
+	clock               time.Duration
+}
+
+func (p period) addTo(t time.Time) time.Time {
+	return t.AddDate(p.years, p.months, p.days).Add(p.clock)
+}
+
+func (p period) negate() period {
+	return period{-p.years, -p.months, -p.days, -p.clock}
+}
+
+// Bounds on the parts of a period, which keep the arithmetic on periods and
+// on the times they are added to from overflowing
+const (
+	maxPeriodYears  = 10000
+	maxPeriodMonths = maxPeriodYears * 12
+	maxPeriodDays   = maxPeriodYears * 366
+	maxPeriodClock  = 100 * 366 * 24 * time.Hour
+)
+
+// clockUnits are the sizes of the units that make up a period's clock part
+var clockUnits = map[string]time.Duration{
+	"h": time.Hour, "m": time.Minute, "s": time.Second,
+	"ms": time.Millisecond, "us": time.Microsecond, "ns": time.Nanosecond,
+}
+
+// add adds value of a unit, as periodUnits names it, to the period. It
+// reports false, leaving the period alone, when a part would exceed its
+// bound.
+func (p *period) add(value float64, unit string) bool {
+	var part *int
+	var limit float64
+	switch unit {
+	case "y":
+		part, limit = &p.years, maxPeriodYears
+	case "mo":
+		part, limit = &p.months, maxPeriodMonths
+	case "w":
+		part, limit, value = &p.days, maxPeriodDays, value*7
+	case "d":
+		part, limit = &p.days, maxPeriodDays
+	default:
+		d := value * float64(clockUnits[unit])
+		if math.Abs(float64(p.clock)+d) > float64(maxPeriodClock) {
+			return false
+		}
+		p.clock += time.Duration(math.Round(d))
+		return true
+	}
+	if math.Abs(float64(*part)+value) > limit {
+		return false
+	}
+	*part += int(value)
+	return true
+}
+
+var (
+	// isoPeriodPattern matches ISO 8601 durations such as P1Y2M3DT4H5M6.5S
+	isoPeriodPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+	// periodPartPattern matches one part of a duration such as "3d" or "2 weeks"
+	periodPartPattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([a-zµ]+)`)
+)
+
+// periodUnits maps unit names to calendar units or clock durations
+var periodUnits = map[string]string{
+	"y": "y", "yr": "y", "yrs": "y", "year": "y", "years": "y",
+	"mo": "mo", "mon": "mo", "month": "mo", "months": "mo",
+	"w": "w", "wk": "w", "wks": "w", "week": "w", "weeks": "w",
+	"d": "d", "day": "d", "days": "d",
+	"h": "h", "hr": "h", "hrs": "h", "hour": "h", "hours": "h",
+	"m": "m", "min": "m", "mins": "m", "minute": "m", "minutes": "m",
+	"s": "s", "sec": "s", "secs": "s", "second": "s", "seconds": "s",
+	"ms": "ms", "millisecond": "ms", "milliseconds": "ms",
+	"us": "us", "µs": "us", "ns": "ns",
+}
+
+// parsePeriod parses a Go duration ("1h30m"), a duration with calendar units
+// ("1y 2mo 3d", "2 weeks") or an ISO 8601 duration ("P1DT12H"). Years,
+// months, weeks and days must be whole numbers.
+func parsePeriod(s string) (period, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return period{}, fmt.Errorf("duration is required")
+	}
+	invalid := fmt.Errorf("invalid duration %q: use a form such as 1h30m or 3d or 2w or 1y2mo or P1DT12H", s)
+	outOfRange := fmt.Errorf("duration %q is out of range: up to %d years, with at most %d days in hours, minutes and seconds", s, maxPeriodYears, maxPeriodClock/(24*time.Hour))
+	if d, err := time.ParseDuration(s); err == nil {
+		if d > maxPeriodClock || d < -maxPeriodClock {
+			return period{}, outOfRange
+		}
+		return period{clock: d}, nil
+	}
+
+	// The pattern also matches an empty "P" or a trailing "T", which aren't
+	// valid durations
+	upper := strings.ToUpper(s)
+	if match := isoPeriodPattern.FindStringSubmatch(upper); match != nil && !strings.HasSuffix(upper, "P") && !strings.HasSuffix(upper, "T") {
+		var p period
+		for i, unit := range []string{2: "y", 3: "mo", 4: "w", 5: "d", 6: "h", 7: "m", 8: "s"} {
+			if unit == "" || match[i] == "" {
+				continue
+			}
+			value, err := strconv.ParseFloat(match[i], 64)
+			if err != nil || !p.add(value, unit) {
+				return period{}, outOfRange
+			}
+		}
+		if match[1] == "-" {
+			p = p.negate()
+		}
+		return p, nil
+	}
+
+	rest := strings.ToLower(s)
+	negative := false
+	if rest[0] == '-' || rest[0] == '+' {
+		negative = rest[0] == '-'
+		rest = strings.TrimSpace(rest[1:])
+	}
+	var p period
+	for rest != "" {
+		match := periodPartPattern.FindStringSubmatch(rest)
+		if match == nil {
+			return period{}, invalid
+		}
+		unit, ok := periodUnits[match[2]]
+		if !ok {
+			return period{}, fmt.Errorf("unknown unit %q in duration %q", match[2], s)
+		}
+		value, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return period{}, outOfRange
+		}
+		if _, clock := clockUnits[unit]; !clock && value != math.Trunc(value) {
+			return period{}, fmt.Errorf("%s in duration %q must be a whole number", match[2], s)
+		}
+		if !p.add(value, unit) {
+			return period{}, outOfRange
+		}
+		rest = strings.TrimLeft(rest[len(match[0]):], " ,")
+		rest = strings.TrimPrefix(rest, "and ")
+	}
+	if negative {
+		p = p.negate()
+	}
+	return p, nil
+}
+
+// describeDuration writes a duration in days, hours, minutes and seconds
+func describeDuration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	parts := []struct {
+		unit string
+		size time.Duration
+	}{
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+		{"second", time.Second},
+	}
+	var out []string
+	for _, part := range parts {
+		n := d / part.size
+		d -= n * part.size
+		if n == 0 {
+			continue
+		}
+		unit := part.unit
+		if n != 1 {
+			unit += "s"
+		}
+		out = append(out, fmt.Sprintf("%d %s", n, unit))
+	}
+	if len(out) == 0 {
+		return "0 seconds"
+	}
+	return sign + strings.Join(out, " ")
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// testNow is the current time of the time tools under test, a Friday
+var testNow = time.Date(2024, 3, 8, 10, 30, 0, 0, time.UTC)
+
+// newTestTimeTools returns time tools whose clock is stopped at testNow
+func newTestTimeTools(t *testing.T, zone string, holidays ...string) *timeTools {
+	t.Helper()
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tools := &timeTools{location: location, holidays: make(map[string]bool), now: func() time.Time { return testNow }}
+	for _, day := range holidays {
+		tools.holidays[day] = true
+	}
+	return tools
+}
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    period
+		wantErr string
+	}{
+		{text: "1h30m", want: period{clock: 90 * time.Minute}},
+		{text: "-90s", want: period{clock: -90 * time.Second}},
+		{text: "3d", want: period{days: 3}},
+		{text: "2 weeks", want: period{days: 14}},
+		{text: "1y 2mo 3d", want: period{years: 1, months: 2, days: 3}},
+		{text: "1 year, 2 months and 4 hours", want: period{years: 1, months: 2, clock: 4 * time.Hour}},
+		{text: "2d 1.5h", want: period{days: 2, clock: 90 * time.Minute}},
+		{text: "- 1d 2h", want: period{days: -1, clock: -2 * time.Hour}},
+		{text: "P1Y2M3DT4H5M6.5S", want: period{years: 1, months: 2, days: 3, clock: 4*time.Hour + 5*time.Minute + 6500*time.Millisecond}},
+		{text: "P1W2D", want: period{days: 9}},
+		{text: "-P1D", want: period{days: -1}},
+		{text: "p1dt12h", want: period{days: 1, clock: 12 * time.Hour}},
+		{text: "10000y", want: period{years: 10000}},
+		{text: "", wantErr: "duration is required"},
+		{text: "P", wantErr: "invalid duration"},
+		{text: "P1DT", wantErr: "invalid duration"},
+		{text: "soon", wantErr: "invalid duration"},
+		{text: "1.5d", wantErr: "must be a whole number"},
+		{text: "3 fortnights", wantErr: "unknown unit"},
+		{text: "10001y", wantErr: "out of range"},
+		{text: "5000y 5001y", wantErr: "out of range"},
+		{text: "1000000000000000000y", wantErr: "out of range"},
+		{text: "P99999999999999999999Y", wantErr: "out of range"},
+		{text: "P" + strings.Repeat("9", 400) + "D", wantErr: "out of range"},
+		{text: "P1000000000000W", wantErr: "out of range"},
+		{text: "PT9999999999999H", wantErr: "out of range"},
+		{text: "2562047h", wantErr: "out of range"},
+		{text: "99999999999999999999h", wantErr: "out of range"},
+		{text: "876000h 1000000h", wantErr: "out of range"},
+	}
+	for _, tt := range tests {
+		got, err := parsePeriod(tt.text)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parsePeriod(%q) = %+v, %v, want an error containing %q", tt.text, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePeriod(%q): %v", tt.text, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parsePeriod(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	moment := time.Date(2024, 3, 8, 14, 5, 9, 123456789, time.UTC)
+	tests := []struct {
+		format  string
+		want    string
+		wantErr string
+	}{
+		{format: "", want: "2024-03-08T14:05:09Z"},
+		{format: "RFC3339", want: "2024-03-08T14:05:09Z"},
+		{format: "date", want: "2024-03-08"},
+		{format: "time", want: "14:05:09"},
+		{format: "datetime", want: "2024-03-08 14:05:09"},
+		{format: "kitchen", want: "2:05PM"},
+		{format: "human", want: "Friday, March 8, 2024 2:05 PM UTC"},
+		{format: "unix", want: "1709906709"},
+		{format: "unix_ms", want: "1709906709123"},
+		{format: "iso8601-week", want: "2024-W10-5"},
+		{format: "%Y-%m-%d %H:%M:%S", want: "2024-03-08 14:05:09"},
+		{format: "%a %A %b %B %e %I%p %j", want: "Fri Friday Mar March  8 02PM 068"},
+		{format: "%u %w %G-W%V %f %s %%", want: "5 5 2024-W10 123456 1709906709 %"},
+		{format: "%F%n%T", want: "2024-03-08\n14:05:09"},
+		{format: "2006/01/02", want: "2024/03/08"},
+		{format: "%Q", wantErr: "unsupported strftime directive %Q"},
+		{format: "100%", wantErr: "ends with %"},
+		{format: "YYYY-MM-DD", wantErr: "unknown format"},
+	}
+	for _, tt := range tests {
+		got, err := formatTime(moment, tt.format)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("formatTime(%q) = %q, %v, want an error containing %q", tt.format, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("formatTime(%q): %v", tt.format, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("formatTime(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	tools := newTestTimeTools(t, "Europe/Berlin")
+	tests := []struct {
+		text    string
+		want    string // RFC 3339 in UTC
+		wantErr string
+	}{
+		{text: "2024-03-01T09:00:00Z", want: "2024-03-01T09:00:00Z"},
+		{text: "2024-03-01T09:00:00+05:30", want: "2024-03-01T03:30:00Z"},
+		{text: "2024-03-01 09:00", want: "2024-03-01T08:00:00Z"},
+		{text: "2024-07-01 09:00", want: "2024-07-01T07:00:00Z"},
+		{text: "March 1, 2024 9:00 AM", want: "2024-03-01T08:00:00Z"},
+		{text: "1709283600", want: "2024-03-01T09:00:00Z"},
+		{text: "1709283600000", want: "2024-03-01T09:00:00Z"},
+		{text: "now", want: "2024-03-08T10:30:00Z"},
+		{text: "today", want: "2024-03-07T23:00:00Z"},
+		{text: "Tomorrow", want: "2024-03-08T23:00:00Z"},
+		{text: "3 days ago", want: "2024-03-05T10:30:00Z"},
+		{text: "in 2 hours", want: "2024-03-08T12:30:00Z"},
+		{text: "in 99999y", wantErr: "out of range"},
+		{text: "", wantErr: "time is required"},
+		{text: "the day after", wantErr: "can't parse"},
+	}
+	for _, tt := range tests {
+		got, err := tools.parse(tt.text, tools.location)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parse(%q) = %v, %v, want an error containing %q", tt.text, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parse(%q): %v", tt.text, err)
+			continue
+		}
+		if utc := got.UTC().Format(time.RFC3339); utc != tt.want {
+			t.Errorf("parse(%q) = %s, want %s", tt.text, utc, tt.want)
+		}
+	}
+}
+
+func TestAddDuration(t *testing.T) {
+	tools := newTestTimeTools(t, "UTC")
+	tests := []struct {
+		args    AddDurationArgs
+		want    string
+		wantErr string
+	}{
+		{args: AddDurationArgs{Duration: "1h"}, want: "2024-03-08T11:30:00Z"},
+		{args: AddDurationArgs{Duration: "-P1W"}, want: "2024-03-01T10:30:00Z"},
+		{args: AddDurationArgs{Time: "2024-01-31", Duration: "1mo", Format: "date"}, want: "2024-03-02"},
+		// New York moves its clocks forward on 2024-03-10: a day keeps the
+		// wall clock, 24 hours don't
+		{args: AddDurationArgs{Time: "2024-03-09T12:00:00", Duration: "1d", Timezone: "America/New_York"}, want: "2024-03-10T12:00:00-04:00"},
+		{args: AddDurationArgs{Time: "2024-03-09T12:00:00", Duration: "24h", Timezone: "America/New_York"}, want: "2024-03-10T13:00:00-04:00"},
+		{args: AddDurationArgs{Time: "2024-11-02T12:00:00", Duration: "P1D", Timezone: "America/New_York"}, want: "2024-11-03T12:00:00-05:00"},
+		{args: AddDurationArgs{Duration: "P99999999999999999999Y"}, wantErr: "out of range"},
+		{args: AddDurationArgs{Duration: "1d", Timezone: "Mars/Olympus"}, wantErr: "unknown time zone"},
+	}
+	for _, tt := range tests {
+		resp, err := tools.addDuration(tt.args)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("addDuration(%+v) error = %v, want one containing %q", tt.args, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("addDuration(%+v): %v", tt.args, err)
+			continue
+		}
+		if got := responseText(t, resp); got != tt.want {
+			t.Errorf("addDuration(%+v) = %s, want %s", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestBusinessDays(t *testing.T) {
+	tools := newTestTimeTools(t, "UTC", "2024-03-11")
+	days := func(n int) *int { return &n }
+	tests := []struct {
+		name    string
+		args    BusinessDaysArgs
+		want    string
+		wantErr string
+	}{
+		{name: "skips the weekend and a holiday", args: BusinessDaysArgs{Start: "2024-03-08", Days: days(1)}, want: "2024-03-12 (Tuesday)"},
+		{name: "backwards", args: BusinessDaysArgs{Start: "2024-03-12", Days: days(-1)}, want: "2024-03-08 (Friday)"},
+		{name: "zero", args: BusinessDaysArgs{Start: "2024-03-09", Days: days(0)}, want: "2024-03-09 (Saturday)"},
+		{name: "extra holidays", args: BusinessDaysArgs{Start: "2024-03-08", Days: days(1), Holidays: []string{"2024-03-12"}}, want: "2024-03-13 (Wednesday)"},
+		{name: "start in another zone", args: BusinessDaysArgs{Start: "2024-03-08T23:30:00Z", Days: days(1), Timezone: "Asia/Tokyo"}, want: "2024-03-12 (Tuesday)"},
+		{name: "count", args: BusinessDaysArgs{Start: "2024-03-08", End: "2024-03-15"}, want: "business days: 5\ncalendar days: 8"},
+		{name: "count backwards", args: BusinessDaysArgs{Start: "2024-03-15", End: "2024-03-08"}, want: "business days: -5\ncalendar days: -8"},
+		{name: "days at the bound", args: BusinessDaysArgs{Start: "2024-03-08", Days: days(-maxBusinessDays)}},
+		{name: "days past the bound", args: BusinessDaysArgs{Start: "2024-03-08", Days: days(maxBusinessDays + 1)}, wantErr: "days must be between"},
+		{name: "range past the bound", args: BusinessDaysArgs{Start: "1900-01-01", End: "2024-03-08"}, wantErr: "at most 36525 days apart"},
+		{name: "neither end nor days", args: BusinessDaysArgs{Start: "2024-03-08"}, wantErr: "give either end or days"},
+		{name: "invalid holiday", args: BusinessDaysArgs{Start: "2024-03-08", Days: days(1), Holidays: []string{"March 12"}}, wantErr: "invalid holiday"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tools.businessDays(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := responseText(t, resp); tt.want != "" && got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	mcp_golang "github.com/metoro-io/mcp-golang"
+	"github.com/metoro-io/mcp-golang/transport"
+	mcphttp "github.com/metoro-io/mcp-golang/transport/http"
+	"github.com/metoro-io/mcp-golang/transport/stdio"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// newServer creates the MCP server on a transport, registers the enabled
+// tools, resources and prompts, and starts serving
+func newServer(cfg *ServerConfig, t transport.Transport) (*mcp_golang.Server, error) {
+	server := mcp_golang.NewServer(
+		t,
+		mcp_golang.WithName(cfg.Name),
+		mcp_golang.WithInstructions(cfg.Instructions),
+		mcp_golang.WithVersion(cfg.Version),
+	)
+	if err := registerTools(server, cfg.Tools); err != nil {
+		return nil, err
+	}
+	if err := registerResources(server, cfg); err != nil {
+		return nil, err
+	}
+	if err := registerPrompts(server, cfg.Prompts); err != nil {
+		return nil, err
+	}
+	if err := server.Serve(); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// shutdownSignals returns a channel that receives SIGTERM and SIGINT
+func shutdownSignals() <-chan os.Signal {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	return stop
+}
+
+// serveHTTP serves MCP over HTTP until SIGTERM or SIGINT
+func serveHTTP(cfg *ServerConfig) {
+	// The Gin transport lets us run our own http.Server, which can shut
+	// down gracefully
+	t := mcphttp.NewGinTransport()
+	if _, err := newServer(cfg, newTelemetryTransport(t)); err != nil {
+		log.Fatal(err)
+	}
+	auth, err := newAuthenticator(cfg.Auth)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Count in-flight requests so shutdown can report what it is waiting for
+	var inFlight atomic.Int64
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.POST(cfg.Endpoint, func(c *gin.Context) {
+		inFlight.Add(1)
+		defer inFlight.Add(-1)
+		c.Next()
+	}, auth.middleware(), t.Handler())
+	switch {
+	case cfg.Telemetry.MetricsAddr != "":
+		serveMetrics(cfg.Telemetry.MetricsAddr)
+	case cfg.Telemetry.Metrics:
+		router.GET("/metrics", auth.middleware(), gin.WrapH(promhttp.Handler()))
+	}
+
+	httpServer := &http.Server{Addr: cfg.Addr, Handler: router}
+	scheme := "http"
+	if cfg.TLS.enabled() {
+		if httpServer.TLSConfig, err = cfg.TLS.serverTLSConfig(); err != nil {
+			log.Fatal(err)
+		}
+		scheme = "https"
+	}
+	if !isLoopback(cfg.Addr) && !cfg.TLS.enabled() {
+		log.Printf("Warning: bearer tokens are sent in the clear without TLS")
+	}
+
+	// On SIGTERM or SIGINT, stop accepting connections and let in-flight
+	// tool calls finish
+	stop := shutdownSignals()
+	done := make(chan struct{})
+	go func() {
+		sig := <-stop
+		log.Printf("Received %s, shutting down (%d requests in flight)...", sig, inFlight.Load())
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			log.Printf("Shutdown timed out with %d requests in flight: %v", inFlight.Load(), err)
+			httpServer.Close()
+		}
+		close(done)
+	}()
+
+	// Start the server
+	log.Printf("Starting %s %s on %s://%s%s with tools: %s", cfg.Name, cfg.Version, scheme, cfg.Addr, cfg.Endpoint, strings.Join(cfg.enabledModules(), ", "))
+	if cfg.TLS.enabled() {
+		// The certificates are already loaded into TLSConfig
+		err = httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-done
+	log.Println("Server stopped")
+}
+
+// serveStdio serves MCP over stdin and stdout until stdin is closed or the
+// process receives SIGTERM or SIGINT. This is how clients run the server as
+// a child process.
+func serveStdio(cfg *ServerConfig) {
+	// stdout carries the JSON-RPC stream. Point os.Stdout at stderr so a
+	// stray print anywhere in the process can't corrupt it.
+	out := os.Stdout
+	os.Stdout = os.Stderr
+
+	in := newEOFReader(os.Stdin)
+	t := newTelemetryTransport(stdio.NewStdioServerTransportWithIO(in, out))
+	if _, err := newServer(cfg, t); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.Telemetry.MetricsAddr != "" {
+		serveMetrics(cfg.Telemetry.MetricsAddr)
+	}
+	log.Printf("Starting %s %s on stdio with tools: %s", cfg.Name, cfg.Version, strings.Join(cfg.enabledModules(), ", "))
+
+	// Serve runs in the background; wait for the client to go away
+	select {
+	case <-in.done:
+		log.Printf("stdin closed, shutting down (%d requests in flight)...", t.inFlight.Load())
+	case sig := <-shutdownSignals():
+		log.Printf("Received %s, shutting down (%d requests in flight)...", sig, t.inFlight.Load())
+	}
+
+	// Give in-flight tool calls a chance to finish and send their results
+	deadline := time.Now().Add(time.Duration(cfg.ShutdownTimeout))
+	for t.inFlight.Load() > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if n := t.inFlight.Load(); n > 0 {
+		log.Printf("Shutdown timed out with %d requests in flight", n)
+	}
+	log.Println("Server stopped")
+}
+
+// eofReader closes done once its reader returns an error, which for stdin
+// means the client has gone away
+type eofReader struct {
+	r    io.Reader
+	done chan struct{}
+	once sync.Once
+}
+
+func newEOFReader(r io.Reader) *eofReader {
+	return &eofReader{r: r, done: make(chan struct{})}
+}
+
+func (e *eofReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err != nil {
+		e.once.Do(func() { close(e.done) })
+	}
+	return n, err
+}